@@ -63,6 +63,7 @@ var _ = Describe("CNSim Server", func() {
 			NumHosts:            1000,
 			NumApps:             10000,
 			MeanInstancesPerApp: 2,
+			Seed:                42,
 		}
 		var responseData models.SteadyStateResponse
 		var apiError models.APIError
@@ -76,6 +77,9 @@ var _ = Describe("CNSim Server", func() {
 		By("checking the original request is included with the response")
 		Expect(responseData.Request).To(Equal(requestData))
 
+		By("checking the seed is echoed back")
+		Expect(responseData.Seed).To(Equal(int64(42)))
+
 		By("checking the mean instances per host")
 		Expect(responseData.MeanInstancesPerHost).To(Equal(20.0))
 
@@ -83,6 +87,45 @@ var _ = Describe("CNSim Server", func() {
 		Expect(responseData.Apps).To(HaveLen(10000))
 	})
 
+	It("should accept a JSON request POSTed to /steady_state", func() {
+		requestData := models.SteadyStateRequest{
+			NumApps:             100,
+			MeanInstancesPerApp: 2,
+			Seed:                42,
+			HostClasses: []models.HostClass{
+				{Name: "small", Count: 5, Slots: 10},
+				{Name: "large", Count: 5, Slots: 100},
+			},
+		}
+		var responseData models.SteadyStateResponse
+		var apiError models.APIError
+		resp, err := apiClient.New().Post("/steady_state").BodyJSON(requestData).Receive(&responseData, &apiError)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(responseData.Request.NumHosts).To(Equal(10))
+		Expect(responseData.Capacity.HostClasses).To(HaveLen(2))
+	})
+
+	It("should simulate churn on /churn", func() {
+		requestData := models.ChurnRequest{
+			NumHosts:              10,
+			NumApps:               100,
+			MeanInstancesPerApp:   2,
+			DurationSeconds:       60,
+			SampleIntervalSeconds: 10,
+			PushesPerSecond:       1,
+		}
+		var responseData models.ChurnResponse
+		var apiError models.APIError
+		resp, err := apiClient.New().Get("/churn").QueryStruct(requestData).Receive(&responseData, &apiError)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(200))
+		Expect(responseData.Request).To(Equal(requestData))
+		Expect(responseData.Samples).To(HaveLen(6))
+	})
+
 	Describe("Web form", func() {
 		var page *agouti.Page
 
@@ -0,0 +1,94 @@
+package acceptance_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("CNSim CLI", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "cnsim-cli")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	run := func(args ...string) *gexec.Session {
+		session, err := gexec.Start(exec.Command(pathToServer, args...), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, "10s").Should(gexec.Exit())
+		return session
+	}
+
+	It("should simulate without starting the server", func() {
+		session := run("simulate", "--hosts", "100", "--apps", "300", "--mean-instances", "5", "--seed", "42")
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var responseData models.SteadyStateResponse
+		Expect(json.Unmarshal(session.Out.Contents(), &responseData)).To(Succeed())
+		Expect(responseData.Seed).To(Equal(int64(42)))
+		Expect(responseData.MeanInstancesPerHost).To(Equal(15.0))
+		Expect(responseData.Apps).To(HaveLen(300))
+	})
+
+	It("should write CSV to a file", func() {
+		outPath := filepath.Join(tempDir, "out.csv")
+		session := run("simulate", "--hosts", "10", "--apps", "30", "--mean-instances", "2", "--seed", "42",
+			"--format", "csv", "--table", "apps", "-o", outPath)
+		Expect(session.ExitCode()).To(Equal(0))
+		Expect(session.Out.Contents()).To(BeEmpty())
+
+		contents, err := ioutil.ReadFile(outPath)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+		Expect(lines[1]).To(Equal("# Seed: 42"))
+		Expect(lines[3]).To(Equal("Id,Size,MemoryMB"))
+		Expect(lines).To(HaveLen(4 + 30))
+	})
+
+	It("should read the request from a file, with flags overriding it", func() {
+		requestPath := filepath.Join(tempDir, "request.json")
+		Expect(ioutil.WriteFile(requestPath, []byte(`{
+			"NumApps": 100,
+			"MeanInstancesPerApp": 2,
+			"HostClasses": [{"Name": "small", "Count": 5, "Slots": 10}, {"Name": "large", "Count": 5, "Slots": 100}]
+		}`), 0600)).To(Succeed())
+
+		session := run("simulate", "-request", requestPath, "--apps", "50")
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var responseData models.SteadyStateResponse
+		Expect(json.Unmarshal(session.Out.Contents(), &responseData)).To(Succeed())
+		Expect(responseData.Request.NumHosts).To(Equal(10))
+		Expect(responseData.Request.NumApps).To(Equal(50))
+		Expect(responseData.Capacity.HostClasses).To(HaveLen(2))
+	})
+
+	It("should validate the request as the server does", func() {
+		session := run("simulate", "--hosts", "0", "--apps", "300", "--mean-instances", "5")
+		Expect(session.ExitCode()).To(Equal(2))
+		Expect(session.Err).To(gbytes.Say("validation: NumHosts must be 1 - 1000"))
+		Expect(session.Out.Contents()).To(BeEmpty())
+	})
+
+	It("should reject unknown commands", func() {
+		session := run("banana")
+		Expect(session.ExitCode()).To(Equal(2))
+		Expect(session.Err).To(gbytes.Say(`unknown command "banana"`))
+	})
+})
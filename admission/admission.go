@@ -0,0 +1,89 @@
+// Package admission limits the total estimated cost of the work in flight.
+package admission
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = 5 * time.Second
+
+// Controller admits work while the total cost admitted and not yet released
+// stays within Budget. Work that costs more than the whole Budget is never
+// admitted.
+type Controller struct {
+	Budget int64
+	Wait   time.Duration // suggested to rejected clients, defaults to 5 seconds
+
+	lock     sync.Mutex
+	inFlight int64
+}
+
+// TooLargeError is the error that Admit returns for work that costs more
+// than the whole budget, which retrying cannot help.
+type TooLargeError struct {
+	Cost   int64
+	Budget int64
+}
+
+func (e TooLargeError) Error() string {
+	return fmt.Sprintf("estimated cost %d exceeds the whole budget of %d", e.Cost, e.Budget)
+}
+
+// Admit reserves cost against the budget, returning a function that
+// releases it, or an error if the budget is spent. The error is a
+// TooLargeError if the cost exceeds the whole budget.
+func (c *Controller) Admit(cost int64) (func(), error) {
+	if err := c.Fits(cost); err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.inFlight+cost > c.Budget {
+		return nil, fmt.Errorf("estimated cost %d exceeds the %d left of the budget of %d", cost, c.remaining(), c.Budget)
+	}
+	c.inFlight += cost
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			c.inFlight -= cost
+		})
+	}, nil
+}
+
+// Fits returns a TooLargeError if cost exceeds the whole budget, for work
+// that is admitted in parts.
+func (c *Controller) Fits(cost int64) error {
+	if cost > c.Budget {
+		return TooLargeError{Cost: cost, Budget: c.Budget}
+	}
+	return nil
+}
+
+// InFlight returns the total cost admitted and not yet released.
+func (c *Controller) InFlight() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.inFlight
+}
+
+func (c *Controller) RetryAfter() time.Duration {
+	if c.Wait <= 0 {
+		return defaultRetryAfter
+	}
+	return c.Wait
+}
+
+// remaining must be called with lock held.
+func (c *Controller) remaining() int64 {
+	if c.inFlight > c.Budget {
+		return 0
+	}
+	return c.Budget - c.inFlight
+}
@@ -0,0 +1,88 @@
+package admission_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/admission"
+)
+
+var _ = Describe("Controller", func() {
+	var controller *admission.Controller
+
+	BeforeEach(func() {
+		controller = &admission.Controller{Budget: 100}
+	})
+
+	admit := func(cost int64) func() {
+		release, err := controller.Admit(cost)
+		Expect(err).NotTo(HaveOccurred())
+		return release
+	}
+
+	It("admits work within the budget", func() {
+		admit(60)
+		admit(40)
+		Expect(controller.InFlight()).To(Equal(int64(100)))
+	})
+
+	It("refuses work beyond the budget", func() {
+		admit(60)
+		release, err := controller.Admit(41)
+		Expect(err).To(MatchError("estimated cost 41 exceeds the 40 left of the budget of 100"))
+		Expect(err).NotTo(BeAssignableToTypeOf(admission.TooLargeError{}))
+		Expect(release).To(BeNil())
+		Expect(controller.InFlight()).To(Equal(int64(60)))
+	})
+
+	It("admits more once work is released", func() {
+		release := admit(60)
+		release()
+		admit(100)
+	})
+
+	It("releases each admission only once", func() {
+		release := admit(60)
+		admit(10)
+		release()
+		release()
+		Expect(controller.InFlight()).To(Equal(int64(10)))
+	})
+
+	It("refuses work that costs more than the whole budget, even when nothing else is in flight", func() {
+		release, err := controller.Admit(101)
+		Expect(err).To(MatchError("estimated cost 101 exceeds the whole budget of 100"))
+		Expect(err).To(Equal(admission.TooLargeError{Cost: 101, Budget: 100}))
+		Expect(release).To(BeNil())
+		Expect(controller.InFlight()).To(BeZero())
+	})
+
+	It("tells whether work that is admitted in parts fits the whole budget", func() {
+		admit(60)
+		Expect(controller.Fits(100)).To(Succeed())
+		Expect(controller.Fits(101)).To(Equal(admission.TooLargeError{Cost: 101, Budget: 100}))
+	})
+
+	It("is safe to use concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if release, err := controller.Admit(10); err == nil {
+					release()
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(controller.InFlight()).To(BeZero())
+	})
+
+	It("suggests clients retry after 5 seconds by default", func() {
+		Expect(controller.RetryAfter()).To(Equal(5 * time.Second))
+		controller.Wait = time.Minute
+		Expect(controller.RetryAfter()).To(Equal(time.Minute))
+	})
+})
@@ -0,0 +1,128 @@
+package distributions
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+const MaxEmpiricalSize = 10000
+
+// Empirical samples app sizes from an observed histogram, using Vose's alias
+// method so that each sample takes constant time. When the desired mean
+// differs from the mean of the histogram, samples are scaled by the ratio of
+// the two and rounded at random, which keeps the shape of the histogram and
+// approximately honors the desired mean.
+type Empirical struct {
+	sizes []int
+	prob  []float64
+	alias []int
+	mean  float64
+}
+
+// CheckHistogram returns the error that NewEmpirical would, without
+// building the distribution.
+func CheckHistogram(histogram map[int]int) error {
+	total := 0
+	for size, count := range histogram {
+		if size < 1 || size > MaxEmpiricalSize {
+			return fmt.Errorf("histogram sizes must be 1 - %d", MaxEmpiricalSize)
+		}
+		if count < 0 {
+			return fmt.Errorf("histogram counts must not be negative")
+		}
+		total += count
+	}
+	if total == 0 {
+		return fmt.Errorf("histogram must count at least one app")
+	}
+	return nil
+}
+
+// NewEmpirical builds a distribution from a histogram of size to count.
+func NewEmpirical(histogram map[int]int) (*Empirical, error) {
+	if err := CheckHistogram(histogram); err != nil {
+		return nil, err
+	}
+	sizes := make([]int, 0, len(histogram))
+	total := 0
+	for size, count := range histogram {
+		if count > 0 {
+			sizes = append(sizes, size)
+			total += count
+		}
+	}
+	// map iteration order is random, but samples must be reproducible
+	sort.Ints(sizes)
+
+	n := len(sizes)
+	e := &Empirical{
+		sizes: sizes,
+		prob:  make([]float64, n),
+		alias: make([]int, n),
+	}
+
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, size := range sizes {
+		count := histogram[size]
+		e.mean += float64(size) * float64(count) / float64(total)
+		scaled[i] = float64(count) * float64(n) / float64(total)
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		s := small[len(small)-1]
+		small = small[:len(small)-1]
+		l := large[len(large)-1]
+		large = large[:len(large)-1]
+
+		e.prob[s] = scaled[s]
+		e.alias[s] = l
+		scaled[l] += scaled[s] - 1
+		if scaled[l] < 1 {
+			small = append(small, l)
+		} else {
+			large = append(large, l)
+		}
+	}
+	// whatever remains is 1, up to rounding error
+	for _, i := range append(small, large...) {
+		e.prob[i] = 1
+	}
+	return e, nil
+}
+
+// Mean is the mean of the histogram.
+func (e *Empirical) Mean() float64 {
+	return e.mean
+}
+
+func (e *Empirical) Sample(_ context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	if desiredMean < 1 {
+		return -1, fmt.Errorf("desiredMean must be >= 1")
+	}
+
+	i := rng.Intn(len(e.sizes))
+	if rng.Float64() >= e.prob[i] {
+		i = e.alias[i]
+	}
+	size := e.sizes[i]
+	if desiredMean == e.mean {
+		return size, nil
+	}
+
+	scaled := float64(size) * desiredMean / e.mean
+	rounded := int(scaled)
+	if rng.Float64() < scaled-float64(rounded) {
+		rounded++
+	}
+	if rounded < 1 {
+		rounded = 1
+	}
+	return rounded, nil
+}
@@ -0,0 +1,109 @@
+package distributions_test
+
+import (
+	"context"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/distributions"
+)
+
+var _ = Describe("Empirical Distribution built from a histogram", func() {
+	var (
+		histogram map[int]int
+		dist      *distributions.Empirical
+		rng       *rand.Rand
+	)
+
+	BeforeEach(func() {
+		histogram = map[int]int{1: 50, 2: 30, 5: 0, 10: 20}
+
+		var err error
+		dist, err = distributions.NewEmpirical(histogram)
+		Expect(err).NotTo(HaveOccurred())
+		rng = rand.New(rand.NewSource(rand.Int63()))
+	})
+
+	It("computes the mean of the histogram", func() {
+		Expect(dist.Mean()).To(BeNumerically("~", 3.1, 1e-9))
+	})
+
+	It("samples sizes in proportion to their counts when asked for the histogram mean", func() {
+		const numSamples = 100000
+		counts := make(map[int]int)
+		for i := 0; i < numSamples; i++ {
+			sample, err := dist.Sample(context.Background(), rng, dist.Mean())
+			if err != nil {
+				Fail(err.Error())
+			}
+			counts[sample]++
+		}
+
+		Expect(counts).To(HaveLen(3))
+		Expect(float64(counts[1]) / numSamples).To(BeNumerically("~", 0.5, 0.01))
+		Expect(float64(counts[2]) / numSamples).To(BeNumerically("~", 0.3, 0.01))
+		Expect(float64(counts[10]) / numSamples).To(BeNumerically("~", 0.2, 0.01))
+	})
+
+	It("scales samples to honor a larger desired mean", func() {
+		const numSamples = 100000
+		var desiredMean = 10.0
+		total := 0
+		for i := 0; i < numSamples; i++ {
+			sample, err := dist.Sample(context.Background(), rng, desiredMean)
+			if err != nil {
+				Fail(err.Error())
+			}
+			total += sample
+		}
+		sampleMean := float64(total) / float64(numSamples)
+		Expect(sampleMean).To(BeNumerically("~", desiredMean, 0.05*desiredMean))
+	})
+
+	It("never samples less than 1 when scaling down", func() {
+		for i := 0; i < 10000; i++ {
+			sample, err := dist.Sample(context.Background(), rng, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sample).To(BeNumerically(">=", 1))
+		}
+	})
+
+	It("draws the same samples from identically seeded sources and histograms", func() {
+		other, err := distributions.NewEmpirical(histogram)
+		Expect(err).NotTo(HaveOccurred())
+
+		seed := rand.Int63()
+		rngA := rand.New(rand.NewSource(seed))
+		rngB := rand.New(rand.NewSource(seed))
+		for i := 0; i < 100; i++ {
+			a, err := dist.Sample(context.Background(), rngA, 5)
+			Expect(err).NotTo(HaveOccurred())
+			b, err := other.Sample(context.Background(), rngB, 5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a).To(Equal(b))
+		}
+	})
+
+	It("returns an error when the desired mean is less than 1", func() {
+		_, err := dist.Sample(context.Background(), rng, 0.5)
+		Expect(err).To(MatchError("desiredMean must be >= 1"))
+	})
+
+	It("rejects invalid histograms", func() {
+		_, err := distributions.NewEmpirical(map[int]int{})
+		Expect(err).To(MatchError("histogram must count at least one app"))
+
+		_, err = distributions.NewEmpirical(map[int]int{3: 0})
+		Expect(err).To(MatchError("histogram must count at least one app"))
+
+		_, err = distributions.NewEmpirical(map[int]int{0: 10})
+		Expect(err).To(MatchError("histogram sizes must be 1 - 10000"))
+
+		_, err = distributions.NewEmpirical(map[int]int{10001: 10})
+		Expect(err).To(MatchError("histogram sizes must be 1 - 10000"))
+
+		_, err = distributions.NewEmpirical(map[int]int{1: -1})
+		Expect(err).To(MatchError("histogram counts must not be negative"))
+	})
+})
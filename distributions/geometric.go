@@ -1,26 +1,32 @@
 package distributions
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"math/rand"
 )
 
 type GeometricWithPositiveSupport struct{}
 
-func (_ *GeometricWithPositiveSupport) Sample(desiredMean float64) (int, error) {
+func (_ *GeometricWithPositiveSupport) Sample(_ context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
 	if desiredMean < 1 {
 		return -1, fmt.Errorf("desiredMean must be >= 1")
 	}
+	if desiredMean == 1 {
+		return 1, nil
+	}
 	probSuccess := 1.0 / desiredMean
-	return countTrialsBeforeSuccess(probSuccess)
+	return trialsUntilSuccess(rng, probSuccess), nil
 }
 
-func countTrialsBeforeSuccess(probSuccess float64) (int, error) {
-	const MAX_TRIALS = 1 << 16
-	for i := 1; i < MAX_TRIALS; i++ {
-		if rand.Float64() < probSuccess {
-			return i, nil
-		}
+// trialsUntilSuccess inverts the CDF 1 - (1-p)^k, so it takes constant time
+// regardless of p.
+func trialsUntilSuccess(rng *rand.Rand, probSuccess float64) int {
+	u := 1 - rng.Float64() // in (0, 1], so the log is finite
+	trials := math.Ceil(math.Log(u) / math.Log1p(-probSuccess))
+	if trials < 1 {
+		return 1
 	}
-	return -1, fmt.Errorf("exceeded max trials: %d", MAX_TRIALS)
+	return int(trials)
 }
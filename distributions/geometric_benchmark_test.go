@@ -0,0 +1,49 @@
+package distributions_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/rosenhouse/cnsim/distributions"
+)
+
+// trialLoop is the original sampler, which counted Bernoulli trials until the
+// first success, kept here as a baseline.
+func trialLoop(rng *rand.Rand, desiredMean float64) int {
+	const maxTrials = 1 << 16
+	probSuccess := 1.0 / desiredMean
+	for i := 1; i < maxTrials; i++ {
+		if rng.Float64() < probSuccess {
+			return i
+		}
+	}
+	return -1
+}
+
+func benchmarkGeometric(b *testing.B, desiredMean float64) {
+	dist := &distributions.GeometricWithPositiveSupport{}
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dist.Sample(context.Background(), rng, desiredMean); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkTrialLoop(b *testing.B, desiredMean float64) {
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trialLoop(rng, desiredMean)
+	}
+}
+
+func BenchmarkGeometricMean2(b *testing.B)     { benchmarkGeometric(b, 2) }
+func BenchmarkGeometricMean100(b *testing.B)   { benchmarkGeometric(b, 100) }
+func BenchmarkGeometricMean10000(b *testing.B) { benchmarkGeometric(b, 10000) }
+
+func BenchmarkTrialLoopMean2(b *testing.B)     { benchmarkTrialLoop(b, 2) }
+func BenchmarkTrialLoopMean100(b *testing.B)   { benchmarkTrialLoop(b, 100) }
+func BenchmarkTrialLoopMean10000(b *testing.B) { benchmarkTrialLoop(b, 10000) }
@@ -1,6 +1,9 @@
 package distributions_test
 
 import (
+	"context"
+	"math/rand"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -10,10 +13,12 @@ import (
 var _ = Describe("Geometric Distribution with support on the positive integers", func() {
 	var (
 		dist *distributions.GeometricWithPositiveSupport
+		rng  *rand.Rand
 	)
 
 	BeforeEach(func() {
 		dist = &distributions.GeometricWithPositiveSupport{}
+		rng = rand.New(rand.NewSource(rand.Int63()))
 	})
 
 	DescribeTable("sample means",
@@ -22,7 +27,7 @@ var _ = Describe("Geometric Distribution with support on the positive integers",
 			var tolerance = 0.05 * desiredMean // prob test suite failure < 0.01
 			total := 0
 			for i := 0; i < numSamples; i++ {
-				sample, err := dist.Sample(desiredMean)
+				sample, err := dist.Sample(context.Background(), rng, desiredMean)
 				Expect(err).NotTo(HaveOccurred())
 				total += sample
 			}
@@ -39,5 +44,32 @@ var _ = Describe("Geometric Distribution with support on the positive integers",
 		Entry("p=0.25", 4.0),
 		Entry("p=0.1", 10.0),
 		Entry("p=0.01", 100.0),
+		Entry("p=0.0001", 10000.0),
 	)
+
+	It("samples large means without failing", func() {
+		for i := 0; i < 1000; i++ {
+			sample, err := dist.Sample(context.Background(), rng, 1e6)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sample).To(BeNumerically(">=", 1))
+		}
+	})
+
+	It("draws the same samples from identically seeded sources", func() {
+		seed := rand.Int63()
+		rngA := rand.New(rand.NewSource(seed))
+		rngB := rand.New(rand.NewSource(seed))
+		for i := 0; i < 100; i++ {
+			a, err := dist.Sample(context.Background(), rngA, 5)
+			Expect(err).NotTo(HaveOccurred())
+			b, err := dist.Sample(context.Background(), rngB, 5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a).To(Equal(b))
+		}
+	})
+
+	It("returns an error when the desired mean is less than 1", func() {
+		_, err := dist.Sample(context.Background(), rng, 0.5)
+		Expect(err).To(MatchError("desiredMean must be >= 1"))
+	})
 })
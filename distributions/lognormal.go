@@ -0,0 +1,112 @@
+package distributions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const DefaultLogNormalSigma = 1.0
+
+// LogNormal is a log-normal distribution discretized by rounding up and
+// capped at Cap. The location parameter is chosen to give the desired mean.
+type LogNormal struct {
+	Sigma float64 // shape; defaults to DefaultLogNormalSigma
+	Cap   int     // defaults to DefaultCap
+
+	tabulated tabulated
+}
+
+func (l *LogNormal) Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	sigma := l.Sigma
+	if sigma <= 0 {
+		sigma = DefaultLogNormalSigma
+	}
+	cap := capOrDefault(l.Cap)
+	return l.tabulated.sample(ctx, rng, desiredMean, family{
+		cap: cap,
+		survival: func(mu float64, cap int) []float64 {
+			table := make([]float64, cap-1)
+			for k := 1; k < cap; k++ {
+				// P(ceil(Y) > k) = P(Y > k)
+				table[k-1] = 0.5 * math.Erfc((math.Log(float64(k))-mu)/(sigma*math.Sqrt2))
+			}
+			return table
+		},
+		minParam:       -50,
+		maxParam:       math.Log(float64(cap)) + 10*sigma,
+		meanIncreasing: true,
+	})
+}
+
+// RoundedLogNormal is also a log-normal distribution rounded up and capped
+// at Cap, but samples without a table, so it suits large caps such as
+// memory in MB. The location parameter is solved from the closed-form mean
+// of the capped distribution, which rounding up adds about a half to, so
+// sample means are only close to the desired mean when it is well above 1.
+type RoundedLogNormal struct {
+	Sigma float64 // shape; defaults to DefaultLogNormalSigma
+	Cap   int     // defaults to DefaultCap
+
+	// the location solved for the mean last sampled, which is usually the
+	// next mean sampled too
+	mutex            sync.Mutex
+	lastMean, lastMu float64
+}
+
+func (l *RoundedLogNormal) Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	sigma := l.Sigma
+	if sigma <= 0 {
+		sigma = DefaultLogNormalSigma
+	}
+	cap := capOrDefault(l.Cap)
+	if desiredMean < 1 {
+		return -1, fmt.Errorf("desiredMean must be >= 1")
+	}
+	if desiredMean >= float64(cap) {
+		return -1, fmt.Errorf("desiredMean must be < %d", cap)
+	}
+	if desiredMean == 1 {
+		return 1, nil
+	}
+
+	l.mutex.Lock()
+	mu, ok := l.lastMu, l.lastMean == desiredMean
+	l.mutex.Unlock()
+	if !ok {
+		mu = roundedLogNormalLocation(desiredMean, sigma, cap)
+		l.mutex.Lock()
+		l.lastMean, l.lastMu = desiredMean, mu
+		l.mutex.Unlock()
+	}
+
+	sample := math.Ceil(math.Exp(mu + sigma*rng.NormFloat64()))
+	return int(math.Max(1, math.Min(sample, float64(cap)))), nil
+}
+
+// roundedLogNormalLocation bisects for the location whose capped mean is
+// the desired mean less the half that rounding up adds.
+func roundedLogNormalLocation(desiredMean, sigma float64, cap int) float64 {
+	target := math.Max(desiredMean-0.5, 1)
+	logCap := math.Log(float64(cap))
+	lo, hi := -50.0, logCap+10*sigma
+	for i := 0; i < calibrationIterations; i++ {
+		mu := (lo + hi) / 2
+		if cappedLogNormalMean(mu, sigma, logCap) < target {
+			lo = mu
+		} else {
+			hi = mu
+		}
+	}
+	return lo
+}
+
+// cappedLogNormalMean is E[min(Y, cap)] for log-normal Y.
+func cappedLogNormalMean(mu, sigma, logCap float64) float64 {
+	normalCDF := func(x float64) float64 { return 0.5 * math.Erfc(-x/math.Sqrt2) }
+	belowCap := math.Exp(mu+sigma*sigma/2) * normalCDF((logCap-mu-sigma*sigma)/sigma)
+	aboveCap := math.Exp(logCap) * normalCDF((mu-logCap)/sigma)
+	return belowCap + aboveCap
+}
@@ -0,0 +1,59 @@
+package distributions_test
+
+import (
+	"context"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/distributions"
+)
+
+var _ = Describe("Rounded log-normal Distribution", func() {
+	var (
+		dist *distributions.RoundedLogNormal
+		rng  *rand.Rand
+	)
+
+	BeforeEach(func() {
+		dist = &distributions.RoundedLogNormal{Cap: 65536}
+		rng = rand.New(rand.NewSource(rand.Int63()))
+	})
+
+	DescribeTable("sample means",
+		func(desiredMean float64) {
+			const numSamples = 20000
+			total := 0
+			for i := 0; i < numSamples; i++ {
+				sample, err := dist.Sample(context.Background(), rng, desiredMean)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sample).To(BeNumerically(">=", 1))
+				Expect(sample).To(BeNumerically("<=", 65536))
+				total += sample
+			}
+			sampleMean := float64(total) / numSamples
+			Expect(sampleMean).To(BeNumerically("~", desiredMean, 0.05*desiredMean))
+		},
+		Entry("mean=1", 1.0),
+		Entry("mean=10", 10.0),
+		Entry("mean=1024", 1024.0),
+		Entry("mean=32768, half the cap", 32768.0),
+	)
+
+	It("samples a new mean without calibrating a table", func() {
+		dist.Cap = 1 << 30
+		for mean := 1000.0; mean < 1100; mean++ {
+			_, err := dist.Sample(context.Background(), rng, mean)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("returns an error when the desired mean is out of range", func() {
+		_, err := dist.Sample(context.Background(), rng, 0.5)
+		Expect(err).To(MatchError("desiredMean must be >= 1"))
+
+		_, err = dist.Sample(context.Background(), rng, 65536)
+		Expect(err).To(MatchError("desiredMean must be < 65536"))
+	})
+})
@@ -0,0 +1,39 @@
+package distributions
+
+import (
+	"context"
+	"math"
+	"math/rand"
+)
+
+const DefaultParetoShape = 1.5
+
+// ParetoWithCap is a Pareto distribution discretized by rounding up and
+// capped at Cap. The scale parameter is chosen to give the desired mean.
+type ParetoWithCap struct {
+	Shape float64 // tail index; defaults to DefaultParetoShape
+	Cap   int     // defaults to DefaultCap
+
+	tabulated tabulated
+}
+
+func (p *ParetoWithCap) Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	shape := p.Shape
+	if shape <= 0 {
+		shape = DefaultParetoShape
+	}
+	cap := capOrDefault(p.Cap)
+	return p.tabulated.sample(ctx, rng, desiredMean, family{
+		cap: cap,
+		survival: func(scale float64, cap int) []float64 {
+			table := make([]float64, cap-1)
+			for k := 1; k < cap; k++ {
+				table[k-1] = math.Min(1, math.Pow(scale/float64(k), shape))
+			}
+			return table
+		},
+		minParam:       0,
+		maxParam:       float64(cap),
+		meanIncreasing: true,
+	})
+}
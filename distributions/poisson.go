@@ -0,0 +1,45 @@
+package distributions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PoissonWithPositiveSupport is one plus a Poisson random variable.
+type PoissonWithPositiveSupport struct{}
+
+func (_ *PoissonWithPositiveSupport) Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	if desiredMean < 1 {
+		return -1, fmt.Errorf("desiredMean must be >= 1")
+	}
+	count, err := samplePoisson(ctx, rng, desiredMean-1)
+	if err != nil {
+		return -1, err
+	}
+	return 1 + count, nil
+}
+
+// samplePoisson uses Knuth's multiplication method, splitting large rates
+// into chunks so that exp(-lambda) does not underflow. Large rates take long
+// enough that it gives up between chunks once ctx is done.
+func samplePoisson(ctx context.Context, rng *rand.Rand, lambda float64) (int, error) {
+	const maxChunk = 500
+	count := 0
+	for lambda > 0 {
+		if err := ctx.Err(); err != nil {
+			return -1, err
+		}
+		chunk := math.Min(lambda, maxChunk)
+		lambda -= chunk
+
+		limit := math.Exp(-chunk)
+		product := rng.Float64()
+		for product > limit {
+			count++
+			product *= rng.Float64()
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,62 @@
+package distributions_test
+
+import (
+	"context"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/distributions"
+)
+
+var _ = Describe("Poisson Distribution with support on the positive integers", func() {
+	var (
+		dist *distributions.PoissonWithPositiveSupport
+		rng  *rand.Rand
+	)
+
+	BeforeEach(func() {
+		dist = &distributions.PoissonWithPositiveSupport{}
+		rng = rand.New(rand.NewSource(rand.Int63()))
+	})
+
+	DescribeTable("sample means",
+		func(desiredMean float64) {
+			const numSamples = 10000
+			var tolerance = 0.05 * desiredMean
+			total, min := 0, 1
+			for i := 0; i < numSamples; i++ {
+				sample, err := dist.Sample(context.Background(), rng, desiredMean)
+				if err != nil {
+					Fail(err.Error())
+				}
+				if sample < min {
+					min = sample
+				}
+				total += sample
+			}
+			Expect(min).To(Equal(1))
+			sampleMean := float64(total) / float64(numSamples)
+			Expect(sampleMean).To(BeNumerically("~", desiredMean, tolerance))
+		},
+		Entry("lambda=0", 1.0),
+		Entry("lambda=0.5", 1.5),
+		Entry("lambda=1", 2.0),
+		Entry("lambda=3", 4.0),
+		Entry("lambda=9", 10.0),
+		Entry("lambda=99", 100.0),
+		Entry("lambda=1999", 2000.0),
+	)
+
+	It("returns an error when the desired mean is less than 1", func() {
+		_, err := dist.Sample(context.Background(), rng, 0.5)
+		Expect(err).To(MatchError("desiredMean must be >= 1"))
+	})
+	It("gives up once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := dist.Sample(ctx, rng, 2000)
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
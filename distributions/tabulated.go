@@ -0,0 +1,143 @@
+package distributions
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultCap = 10000
+
+	calibrationIterations = 60
+
+	// bounds the tables cached by each distribution, which are 80 KB each
+	// at the default cap
+	maxCachedTables = 8
+)
+
+// survivalTable returns P(X > k) for k = 1..cap-1, for a distribution on
+// 1..cap from a one-parameter family.
+type survivalTable func(param float64, cap int) []float64
+
+// tabulated samples by inverting a survival table. The parameter of the
+// family is calibrated by bisection so that the tabulated distribution has
+// the desired mean, and the tables of the means most recently used are
+// cached.
+type tabulated struct {
+	mutex  sync.Mutex
+	tables map[float64]*list.Element // of *cachedTable
+	recent list.List                 // most recently used first
+}
+
+type cachedTable struct {
+	mean  float64
+	table []float64
+}
+
+type family struct {
+	cap                int
+	survival           survivalTable
+	minParam, maxParam float64
+	meanIncreasing     bool // whether the mean increases with the parameter
+}
+
+func (t *tabulated) sample(ctx context.Context, rng *rand.Rand, desiredMean float64, f family) (int, error) {
+	if desiredMean < 1 {
+		return -1, fmt.Errorf("desiredMean must be >= 1")
+	}
+	if desiredMean >= float64(f.cap) {
+		return -1, fmt.Errorf("desiredMean must be < %d", f.cap)
+	}
+	if desiredMean == 1 {
+		return 1, nil
+	}
+
+	table, err := t.table(ctx, desiredMean, f)
+	if err != nil {
+		return -1, err
+	}
+
+	// the table is non-increasing, so this finds the smallest k with P(X > k) <= u
+	u := rng.Float64()
+	k := sort.Search(len(table), func(i int) bool { return table[i] <= u })
+	return k + 1, nil
+}
+
+// table calibrates the table for a mean, unless it is cached. Calibration
+// stops without caching anything once ctx is done.
+func (t *tabulated) table(ctx context.Context, desiredMean float64, f family) ([]float64, error) {
+	t.mutex.Lock()
+	table, ok := t.cached(desiredMean)
+	t.mutex.Unlock()
+	if ok {
+		return table, nil
+	}
+
+	// calibrating takes a while, so it happens without the lock; two
+	// samplers of the same new mean may both calibrate it
+	lo, hi := f.minParam, f.maxParam
+	for i := 0; i < calibrationIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mid := (lo + hi) / 2
+		table = f.survival(mid, f.cap)
+		if (tableMean(table) < desiredMean) == f.meanIncreasing {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	t.mutex.Lock()
+	t.cache(desiredMean, table)
+	t.mutex.Unlock()
+	return table, nil
+}
+
+// cached must be called with mutex held.
+func (t *tabulated) cached(mean float64) ([]float64, bool) {
+	element, ok := t.tables[mean]
+	if !ok {
+		return nil, false
+	}
+	t.recent.MoveToFront(element)
+	return element.Value.(*cachedTable).table, true
+}
+
+// cache evicts the least recently used table once there are
+// maxCachedTables. It must be called with mutex held.
+func (t *tabulated) cache(mean float64, table []float64) {
+	if t.tables == nil {
+		t.tables = make(map[float64]*list.Element)
+	}
+	if element, ok := t.tables[mean]; ok {
+		t.recent.MoveToFront(element)
+		return
+	}
+	t.tables[mean] = t.recent.PushFront(&cachedTable{mean: mean, table: table})
+	if t.recent.Len() > maxCachedTables {
+		oldest := t.recent.Back()
+		t.recent.Remove(oldest)
+		delete(t.tables, oldest.Value.(*cachedTable).mean)
+	}
+}
+
+// tableMean uses E[X] = sum_{k>=0} P(X > k), where P(X > 0) = 1.
+func tableMean(table []float64) float64 {
+	mean := 1.0
+	for _, p := range table {
+		mean += p
+	}
+	return mean
+}
+
+func capOrDefault(cap int) int {
+	if cap <= 1 {
+		return DefaultCap
+	}
+	return cap
+}
@@ -0,0 +1,134 @@
+package distributions_test
+
+import (
+	"context"
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/distributions"
+)
+
+type tabulatedDistribution interface {
+	Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error)
+}
+
+var (
+	newLogNormal = func(cap int) tabulatedDistribution { return &distributions.LogNormal{Cap: cap} }
+	newPareto    = func(cap int) tabulatedDistribution { return &distributions.ParetoWithCap{Cap: cap} }
+	newZipf      = func(cap int) tabulatedDistribution { return &distributions.Zipf{Cap: cap} }
+)
+
+var _ = Describe("Tabulated distributions: log-normal, Pareto with a cap and Zipf", func() {
+	var rng *rand.Rand
+
+	BeforeEach(func() {
+		rng = rand.New(rand.NewSource(rand.Int63()))
+	})
+
+	DescribeTable("sample means",
+		func(newDist func(int) tabulatedDistribution, numSamples int, desiredMean float64) {
+			rng = rand.New(rand.NewSource(1)) // so that the means are checked against the same sample every run
+			dist := newDist(0)
+			total, min := 0, 1
+			for i := 0; i < numSamples; i++ {
+				sample, err := dist.Sample(context.Background(), rng, desiredMean)
+				Expect(err).NotTo(HaveOccurred())
+				if sample < min {
+					min = sample
+				}
+				total += sample
+			}
+			Expect(min).To(Equal(1))
+			sampleMean := float64(total) / float64(numSamples)
+			Expect(sampleMean).To(BeNumerically("~", desiredMean, 0.05*desiredMean))
+		},
+		// the heavier tails need more samples
+		Entry("log-normal mean=1", newLogNormal, 100000, 1.0),
+		Entry("log-normal mean=1.5", newLogNormal, 100000, 1.5),
+		Entry("log-normal mean=2", newLogNormal, 100000, 2.0),
+		Entry("log-normal mean=4", newLogNormal, 100000, 4.0),
+		Entry("log-normal mean=10", newLogNormal, 100000, 10.0),
+		Entry("log-normal mean=100", newLogNormal, 100000, 100.0),
+		Entry("Pareto mean=1", newPareto, 1000000, 1.0),
+		Entry("Pareto mean=1.5", newPareto, 1000000, 1.5),
+		Entry("Pareto mean=2", newPareto, 1000000, 2.0),
+		Entry("Pareto mean=4", newPareto, 1000000, 4.0),
+		Entry("Pareto mean=10", newPareto, 1000000, 10.0),
+		Entry("Pareto mean=100", newPareto, 1000000, 100.0),
+		Entry("Zipf mean=1", newZipf, 1000000, 1.0),
+		Entry("Zipf mean=1.5", newZipf, 1000000, 1.5),
+		Entry("Zipf mean=2", newZipf, 1000000, 2.0),
+		Entry("Zipf mean=4", newZipf, 1000000, 4.0),
+		Entry("Zipf mean=10", newZipf, 1000000, 10.0),
+		Entry("Zipf mean=100", newZipf, 1000000, 100.0),
+	)
+
+	DescribeTable("never samples more than the cap",
+		func(newDist func(int) tabulatedDistribution) {
+			dist := newDist(20)
+			for i := 0; i < 10000; i++ {
+				sample, err := dist.Sample(context.Background(), rng, 10)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sample).To(BeNumerically("<=", 20))
+			}
+		},
+		Entry("log-normal", newLogNormal),
+		Entry("Pareto", newPareto),
+		Entry("Zipf", newZipf),
+	)
+
+	DescribeTable("returns an error when the desired mean is out of range",
+		func(newDist func(int) tabulatedDistribution) {
+			dist := newDist(0)
+			_, err := dist.Sample(context.Background(), rng, 0.5)
+			Expect(err).To(MatchError("desiredMean must be >= 1"))
+
+			_, err = dist.Sample(context.Background(), rng, distributions.DefaultCap)
+			Expect(err).To(MatchError("desiredMean must be < 10000"))
+		},
+		Entry("log-normal", newLogNormal),
+		Entry("Pareto", newPareto),
+		Entry("Zipf", newZipf),
+	)
+
+	It("keeps sampling means it calibrated before many others", func() {
+		dist := newZipf(100)
+		for mean := 2.0; mean < 50; mean++ {
+			_, err := dist.Sample(context.Background(), rng, mean)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		total := 0
+		for i := 0; i < 10000; i++ {
+			sample, err := dist.Sample(context.Background(), rng, 2)
+			Expect(err).NotTo(HaveOccurred())
+			total += sample
+		}
+		Expect(float64(total) / 10000).To(BeNumerically("~", 2, 0.2))
+	})
+
+	Context("when the context is done", func() {
+		var ctx context.Context
+
+		BeforeEach(func() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+		})
+
+		It("stops calibrating a new mean", func() {
+			_, err := newLogNormal(0).Sample(ctx, rng, 10)
+			Expect(err).To(Equal(context.Canceled))
+		})
+
+		It("still samples a mean that is already calibrated", func() {
+			dist := newLogNormal(0)
+			_, err := dist.Sample(context.Background(), rng, 10)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = dist.Sample(ctx, rng, 10)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
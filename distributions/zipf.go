@@ -0,0 +1,39 @@
+package distributions
+
+import (
+	"context"
+	"math"
+	"math/rand"
+)
+
+// Zipf is a power law on 1..Cap, with P(k) proportional to k^-s. The
+// exponent s is chosen to give the desired mean.
+type Zipf struct {
+	Cap int // defaults to DefaultCap
+
+	tabulated tabulated
+}
+
+func (z *Zipf) Sample(ctx context.Context, rng *rand.Rand, desiredMean float64) (int, error) {
+	return z.tabulated.sample(ctx, rng, desiredMean, family{
+		cap:            capOrDefault(z.Cap),
+		survival:       zipfSurvival,
+		minParam:       0,
+		maxParam:       50,
+		meanIncreasing: false,
+	})
+}
+
+func zipfSurvival(s float64, cap int) []float64 {
+	table := make([]float64, cap-1)
+	tail := 0.0
+	for k := cap; k > 1; k-- {
+		tail += math.Pow(float64(k), -s)
+		table[k-2] = tail
+	}
+	total := tail + 1
+	for i := range table {
+		table[i] /= total
+	}
+	return table
+}
@@ -0,0 +1,110 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+	"time"
+)
+
+type Admitter struct {
+	AdmitStub        func(cost int64) (func(), error)
+	admitMutex       sync.RWMutex
+	admitArgsForCall []struct {
+		cost int64
+	}
+	admitReturns struct {
+		result1 func()
+		result2 error
+	}
+	RetryAfterStub        func() time.Duration
+	retryAfterMutex       sync.RWMutex
+	retryAfterArgsForCall []struct {
+	}
+	retryAfterReturns struct {
+		result1 time.Duration
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *Admitter) Admit(cost int64) (func(), error) {
+	fake.admitMutex.Lock()
+	fake.admitArgsForCall = append(fake.admitArgsForCall, struct {
+		cost int64
+	}{cost})
+	fake.recordInvocation("Admit", []interface{}{cost})
+	fake.admitMutex.Unlock()
+	if fake.AdmitStub != nil {
+		return fake.AdmitStub(cost)
+	} else {
+		return fake.admitReturns.result1, fake.admitReturns.result2
+	}
+}
+
+func (fake *Admitter) AdmitCallCount() int {
+	fake.admitMutex.RLock()
+	defer fake.admitMutex.RUnlock()
+	return len(fake.admitArgsForCall)
+}
+
+func (fake *Admitter) AdmitArgsForCall(i int) int64 {
+	fake.admitMutex.RLock()
+	defer fake.admitMutex.RUnlock()
+	return fake.admitArgsForCall[i].cost
+}
+
+func (fake *Admitter) AdmitReturns(result1 func(), result2 error) {
+	fake.AdmitStub = nil
+	fake.admitReturns = struct {
+		result1 func()
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *Admitter) RetryAfter() time.Duration {
+	fake.retryAfterMutex.Lock()
+	fake.retryAfterArgsForCall = append(fake.retryAfterArgsForCall, struct {
+	}{})
+	fake.recordInvocation("RetryAfter", []interface{}{})
+	fake.retryAfterMutex.Unlock()
+	if fake.RetryAfterStub != nil {
+		return fake.RetryAfterStub()
+	} else {
+		return fake.retryAfterReturns.result1
+	}
+}
+
+func (fake *Admitter) RetryAfterCallCount() int {
+	fake.retryAfterMutex.RLock()
+	defer fake.retryAfterMutex.RUnlock()
+	return len(fake.retryAfterArgsForCall)
+}
+
+func (fake *Admitter) RetryAfterReturns(result1 time.Duration) {
+	fake.RetryAfterStub = nil
+	fake.retryAfterReturns = struct {
+		result1 time.Duration
+	}{result1}
+}
+
+func (fake *Admitter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.admitMutex.RLock()
+	defer fake.admitMutex.RUnlock()
+	fake.retryAfterMutex.RLock()
+	defer fake.retryAfterMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *Admitter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
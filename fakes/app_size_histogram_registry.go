@@ -0,0 +1,122 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+type AppSizeHistogramRegistry struct {
+	ExecuteStub        func(logger lager.Logger, req models.AppSizeHistogramRequest) (*models.AppSizeHistogramResponse, error)
+	executeMutex       sync.RWMutex
+	executeArgsForCall []struct {
+		logger lager.Logger
+		req    models.AppSizeHistogramRequest
+	}
+	executeReturns struct {
+		result1 *models.AppSizeHistogramResponse
+		result2 error
+	}
+	ValidateStub        func(req models.AppSizeHistogramRequest) error
+	validateMutex       sync.RWMutex
+	validateArgsForCall []struct {
+		req models.AppSizeHistogramRequest
+	}
+	validateReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *AppSizeHistogramRegistry) Execute(logger lager.Logger, req models.AppSizeHistogramRequest) (*models.AppSizeHistogramResponse, error) {
+	fake.executeMutex.Lock()
+	fake.executeArgsForCall = append(fake.executeArgsForCall, struct {
+		logger lager.Logger
+		req    models.AppSizeHistogramRequest
+	}{logger, req})
+	fake.recordInvocation("Execute", []interface{}{logger, req})
+	fake.executeMutex.Unlock()
+	if fake.ExecuteStub != nil {
+		return fake.ExecuteStub(logger, req)
+	} else {
+		return fake.executeReturns.result1, fake.executeReturns.result2
+	}
+}
+
+func (fake *AppSizeHistogramRegistry) ExecuteCallCount() int {
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	return len(fake.executeArgsForCall)
+}
+
+func (fake *AppSizeHistogramRegistry) ExecuteArgsForCall(i int) (lager.Logger, models.AppSizeHistogramRequest) {
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	return fake.executeArgsForCall[i].logger, fake.executeArgsForCall[i].req
+}
+
+func (fake *AppSizeHistogramRegistry) ExecuteReturns(result1 *models.AppSizeHistogramResponse, result2 error) {
+	fake.ExecuteStub = nil
+	fake.executeReturns = struct {
+		result1 *models.AppSizeHistogramResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *AppSizeHistogramRegistry) Validate(req models.AppSizeHistogramRequest) error {
+	fake.validateMutex.Lock()
+	fake.validateArgsForCall = append(fake.validateArgsForCall, struct {
+		req models.AppSizeHistogramRequest
+	}{req})
+	fake.recordInvocation("Validate", []interface{}{req})
+	fake.validateMutex.Unlock()
+	if fake.ValidateStub != nil {
+		return fake.ValidateStub(req)
+	} else {
+		return fake.validateReturns.result1
+	}
+}
+
+func (fake *AppSizeHistogramRegistry) ValidateCallCount() int {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return len(fake.validateArgsForCall)
+}
+
+func (fake *AppSizeHistogramRegistry) ValidateArgsForCall(i int) models.AppSizeHistogramRequest {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return fake.validateArgsForCall[i].req
+}
+
+func (fake *AppSizeHistogramRegistry) ValidateReturns(result1 error) {
+	fake.ValidateStub = nil
+	fake.validateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *AppSizeHistogramRegistry) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *AppSizeHistogramRegistry) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
@@ -0,0 +1,260 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+type JobRunner struct {
+	SubmitStub        func(logger lager.Logger, req models.SteadyStateRequest) (models.Job, error)
+	submitMutex       sync.RWMutex
+	submitArgsForCall []struct {
+		logger lager.Logger
+		req    models.SteadyStateRequest
+	}
+	submitReturns struct {
+		result1 models.Job
+		result2 error
+	}
+	StatusStub        func(id string) (models.Job, bool)
+	statusMutex       sync.RWMutex
+	statusArgsForCall []struct {
+		id string
+	}
+	statusReturns struct {
+		result1 models.Job
+		result2 bool
+	}
+	CancelStub        func(id string) (models.Job, bool)
+	cancelMutex       sync.RWMutex
+	cancelArgsForCall []struct {
+		id string
+	}
+	cancelReturns struct {
+		result1 models.Job
+		result2 bool
+	}
+	WriteResultStub        func(ctx context.Context, id string, out models.SteadyStateWriter) error
+	writeResultMutex       sync.RWMutex
+	writeResultArgsForCall []struct {
+		ctx context.Context
+		id  string
+		out models.SteadyStateWriter
+	}
+	writeResultReturns struct {
+		result1 error
+	}
+	ValidateStub        func(req models.SteadyStateRequest) error
+	validateMutex       sync.RWMutex
+	validateArgsForCall []struct {
+		req models.SteadyStateRequest
+	}
+	validateReturns struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *JobRunner) Submit(logger lager.Logger, req models.SteadyStateRequest) (models.Job, error) {
+	fake.submitMutex.Lock()
+	fake.submitArgsForCall = append(fake.submitArgsForCall, struct {
+		logger lager.Logger
+		req    models.SteadyStateRequest
+	}{logger, req})
+	fake.recordInvocation("Submit", []interface{}{logger, req})
+	fake.submitMutex.Unlock()
+	if fake.SubmitStub != nil {
+		return fake.SubmitStub(logger, req)
+	} else {
+		return fake.submitReturns.result1, fake.submitReturns.result2
+	}
+}
+
+func (fake *JobRunner) SubmitCallCount() int {
+	fake.submitMutex.RLock()
+	defer fake.submitMutex.RUnlock()
+	return len(fake.submitArgsForCall)
+}
+
+func (fake *JobRunner) SubmitArgsForCall(i int) (lager.Logger, models.SteadyStateRequest) {
+	fake.submitMutex.RLock()
+	defer fake.submitMutex.RUnlock()
+	return fake.submitArgsForCall[i].logger, fake.submitArgsForCall[i].req
+}
+
+func (fake *JobRunner) SubmitReturns(result1 models.Job, result2 error) {
+	fake.SubmitStub = nil
+	fake.submitReturns = struct {
+		result1 models.Job
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *JobRunner) Status(id string) (models.Job, bool) {
+	fake.statusMutex.Lock()
+	fake.statusArgsForCall = append(fake.statusArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("Status", []interface{}{id})
+	fake.statusMutex.Unlock()
+	if fake.StatusStub != nil {
+		return fake.StatusStub(id)
+	} else {
+		return fake.statusReturns.result1, fake.statusReturns.result2
+	}
+}
+
+func (fake *JobRunner) StatusCallCount() int {
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	return len(fake.statusArgsForCall)
+}
+
+func (fake *JobRunner) StatusArgsForCall(i int) string {
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	return fake.statusArgsForCall[i].id
+}
+
+func (fake *JobRunner) StatusReturns(result1 models.Job, result2 bool) {
+	fake.StatusStub = nil
+	fake.statusReturns = struct {
+		result1 models.Job
+		result2 bool
+	}{result1, result2}
+}
+
+func (fake *JobRunner) Cancel(id string) (models.Job, bool) {
+	fake.cancelMutex.Lock()
+	fake.cancelArgsForCall = append(fake.cancelArgsForCall, struct {
+		id string
+	}{id})
+	fake.recordInvocation("Cancel", []interface{}{id})
+	fake.cancelMutex.Unlock()
+	if fake.CancelStub != nil {
+		return fake.CancelStub(id)
+	} else {
+		return fake.cancelReturns.result1, fake.cancelReturns.result2
+	}
+}
+
+func (fake *JobRunner) CancelCallCount() int {
+	fake.cancelMutex.RLock()
+	defer fake.cancelMutex.RUnlock()
+	return len(fake.cancelArgsForCall)
+}
+
+func (fake *JobRunner) CancelArgsForCall(i int) string {
+	fake.cancelMutex.RLock()
+	defer fake.cancelMutex.RUnlock()
+	return fake.cancelArgsForCall[i].id
+}
+
+func (fake *JobRunner) CancelReturns(result1 models.Job, result2 bool) {
+	fake.CancelStub = nil
+	fake.cancelReturns = struct {
+		result1 models.Job
+		result2 bool
+	}{result1, result2}
+}
+
+func (fake *JobRunner) WriteResult(ctx context.Context, id string, out models.SteadyStateWriter) error {
+	fake.writeResultMutex.Lock()
+	fake.writeResultArgsForCall = append(fake.writeResultArgsForCall, struct {
+		ctx context.Context
+		id  string
+		out models.SteadyStateWriter
+	}{ctx, id, out})
+	fake.recordInvocation("WriteResult", []interface{}{ctx, id, out})
+	fake.writeResultMutex.Unlock()
+	if fake.WriteResultStub != nil {
+		return fake.WriteResultStub(ctx, id, out)
+	} else {
+		return fake.writeResultReturns.result1
+	}
+}
+
+func (fake *JobRunner) WriteResultCallCount() int {
+	fake.writeResultMutex.RLock()
+	defer fake.writeResultMutex.RUnlock()
+	return len(fake.writeResultArgsForCall)
+}
+
+func (fake *JobRunner) WriteResultArgsForCall(i int) (context.Context, string, models.SteadyStateWriter) {
+	fake.writeResultMutex.RLock()
+	defer fake.writeResultMutex.RUnlock()
+	return fake.writeResultArgsForCall[i].ctx, fake.writeResultArgsForCall[i].id, fake.writeResultArgsForCall[i].out
+}
+
+func (fake *JobRunner) WriteResultReturns(result1 error) {
+	fake.WriteResultStub = nil
+	fake.writeResultReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *JobRunner) Validate(req models.SteadyStateRequest) error {
+	fake.validateMutex.Lock()
+	fake.validateArgsForCall = append(fake.validateArgsForCall, struct {
+		req models.SteadyStateRequest
+	}{req})
+	fake.recordInvocation("Validate", []interface{}{req})
+	fake.validateMutex.Unlock()
+	if fake.ValidateStub != nil {
+		return fake.ValidateStub(req)
+	} else {
+		return fake.validateReturns.result1
+	}
+}
+
+func (fake *JobRunner) ValidateCallCount() int {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return len(fake.validateArgsForCall)
+}
+
+func (fake *JobRunner) ValidateArgsForCall(i int) models.SteadyStateRequest {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return fake.validateArgsForCall[i].req
+}
+
+func (fake *JobRunner) ValidateReturns(result1 error) {
+	fake.ValidateStub = nil
+	fake.validateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *JobRunner) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.submitMutex.RLock()
+	defer fake.submitMutex.RUnlock()
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	fake.cancelMutex.RLock()
+	defer fake.cancelMutex.RUnlock()
+	fake.writeResultMutex.RLock()
+	defer fake.writeResultMutex.RUnlock()
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *JobRunner) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
@@ -1,12 +1,18 @@
 // This file was generated by counterfeiter
 package fakes
 
-import "sync"
+import (
+	"context"
+	"math/rand"
+	"sync"
+)
 
 type MeanParameterizedDiscreteDistribution struct {
-	SampleStub        func(mean float64) (int, error)
+	SampleStub        func(ctx context.Context, rng *rand.Rand, mean float64) (int, error)
 	sampleMutex       sync.RWMutex
 	sampleArgsForCall []struct {
+		ctx  context.Context
+		rng  *rand.Rand
 		mean float64
 	}
 	sampleReturns struct {
@@ -17,15 +23,17 @@ type MeanParameterizedDiscreteDistribution struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *MeanParameterizedDiscreteDistribution) Sample(mean float64) (int, error) {
+func (fake *MeanParameterizedDiscreteDistribution) Sample(ctx context.Context, rng *rand.Rand, mean float64) (int, error) {
 	fake.sampleMutex.Lock()
 	fake.sampleArgsForCall = append(fake.sampleArgsForCall, struct {
+		ctx  context.Context
+		rng  *rand.Rand
 		mean float64
-	}{mean})
-	fake.recordInvocation("Sample", []interface{}{mean})
+	}{ctx, rng, mean})
+	fake.recordInvocation("Sample", []interface{}{ctx, rng, mean})
 	fake.sampleMutex.Unlock()
 	if fake.SampleStub != nil {
-		return fake.SampleStub(mean)
+		return fake.SampleStub(ctx, rng, mean)
 	} else {
 		return fake.sampleReturns.result1, fake.sampleReturns.result2
 	}
@@ -37,10 +45,10 @@ func (fake *MeanParameterizedDiscreteDistribution) SampleCallCount() int {
 	return len(fake.sampleArgsForCall)
 }
 
-func (fake *MeanParameterizedDiscreteDistribution) SampleArgsForCall(i int) float64 {
+func (fake *MeanParameterizedDiscreteDistribution) SampleArgsForCall(i int) (context.Context, *rand.Rand, float64) {
 	fake.sampleMutex.RLock()
 	defer fake.sampleMutex.RUnlock()
-	return fake.sampleArgsForCall[i].mean
+	return fake.sampleArgsForCall[i].ctx, fake.sampleArgsForCall[i].rng, fake.sampleArgsForCall[i].mean
 }
 
 func (fake *MeanParameterizedDiscreteDistribution) SampleReturns(result1 int, result2 error) {
@@ -0,0 +1,121 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+	"time"
+)
+
+type SimulationObserver struct {
+	StartedStub        func()
+	startedMutex       sync.RWMutex
+	startedArgsForCall []struct {
+	}
+	FinishedStub        func(outcome string, duration time.Duration, instances int)
+	finishedMutex       sync.RWMutex
+	finishedArgsForCall []struct {
+		outcome   string
+		duration  time.Duration
+		instances int
+	}
+	StageFinishedStub        func(stage string, duration time.Duration)
+	stageFinishedMutex       sync.RWMutex
+	stageFinishedArgsForCall []struct {
+		stage    string
+		duration time.Duration
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *SimulationObserver) Started() {
+	fake.startedMutex.Lock()
+	fake.startedArgsForCall = append(fake.startedArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Started", []interface{}{})
+	fake.startedMutex.Unlock()
+	if fake.StartedStub != nil {
+		fake.StartedStub()
+	}
+}
+
+func (fake *SimulationObserver) StartedCallCount() int {
+	fake.startedMutex.RLock()
+	defer fake.startedMutex.RUnlock()
+	return len(fake.startedArgsForCall)
+}
+
+func (fake *SimulationObserver) Finished(outcome string, duration time.Duration, instances int) {
+	fake.finishedMutex.Lock()
+	fake.finishedArgsForCall = append(fake.finishedArgsForCall, struct {
+		outcome   string
+		duration  time.Duration
+		instances int
+	}{outcome, duration, instances})
+	fake.recordInvocation("Finished", []interface{}{outcome, duration, instances})
+	fake.finishedMutex.Unlock()
+	if fake.FinishedStub != nil {
+		fake.FinishedStub(outcome, duration, instances)
+	}
+}
+
+func (fake *SimulationObserver) FinishedCallCount() int {
+	fake.finishedMutex.RLock()
+	defer fake.finishedMutex.RUnlock()
+	return len(fake.finishedArgsForCall)
+}
+
+func (fake *SimulationObserver) FinishedArgsForCall(i int) (string, time.Duration, int) {
+	fake.finishedMutex.RLock()
+	defer fake.finishedMutex.RUnlock()
+	return fake.finishedArgsForCall[i].outcome, fake.finishedArgsForCall[i].duration, fake.finishedArgsForCall[i].instances
+}
+
+func (fake *SimulationObserver) StageFinished(stage string, duration time.Duration) {
+	fake.stageFinishedMutex.Lock()
+	fake.stageFinishedArgsForCall = append(fake.stageFinishedArgsForCall, struct {
+		stage    string
+		duration time.Duration
+	}{stage, duration})
+	fake.recordInvocation("StageFinished", []interface{}{stage, duration})
+	fake.stageFinishedMutex.Unlock()
+	if fake.StageFinishedStub != nil {
+		fake.StageFinishedStub(stage, duration)
+	}
+}
+
+func (fake *SimulationObserver) StageFinishedCallCount() int {
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return len(fake.stageFinishedArgsForCall)
+}
+
+func (fake *SimulationObserver) StageFinishedArgsForCall(i int) (string, time.Duration) {
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return fake.stageFinishedArgsForCall[i].stage, fake.stageFinishedArgsForCall[i].duration
+}
+
+func (fake *SimulationObserver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.startedMutex.RLock()
+	defer fake.startedMutex.RUnlock()
+	fake.finishedMutex.RLock()
+	defer fake.finishedMutex.RUnlock()
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *SimulationObserver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
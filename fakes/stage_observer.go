@@ -0,0 +1,63 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+	"time"
+)
+
+type StageObserver struct {
+	StageFinishedStub        func(stage string, duration time.Duration)
+	stageFinishedMutex       sync.RWMutex
+	stageFinishedArgsForCall []struct {
+		stage    string
+		duration time.Duration
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *StageObserver) StageFinished(stage string, duration time.Duration) {
+	fake.stageFinishedMutex.Lock()
+	fake.stageFinishedArgsForCall = append(fake.stageFinishedArgsForCall, struct {
+		stage    string
+		duration time.Duration
+	}{stage, duration})
+	fake.recordInvocation("StageFinished", []interface{}{stage, duration})
+	fake.stageFinishedMutex.Unlock()
+	if fake.StageFinishedStub != nil {
+		fake.StageFinishedStub(stage, duration)
+	}
+}
+
+func (fake *StageObserver) StageFinishedCallCount() int {
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return len(fake.stageFinishedArgsForCall)
+}
+
+func (fake *StageObserver) StageFinishedArgsForCall(i int) (string, time.Duration) {
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return fake.stageFinishedArgsForCall[i].stage, fake.stageFinishedArgsForCall[i].duration
+}
+
+func (fake *StageObserver) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.stageFinishedMutex.RLock()
+	defer fake.stageFinishedMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *StageObserver) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
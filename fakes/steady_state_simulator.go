@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 
 	"code.cloudfoundry.org/lager"
@@ -9,15 +10,16 @@ import (
 )
 
 type SteadyStateSimulator struct {
-	ExecuteStub        func(logger lager.Logger, req models.SteadyStateRequest) (*models.SteadyStateResponse, error)
-	executeMutex       sync.RWMutex
-	executeArgsForCall []struct {
+	StreamStub        func(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest, out models.SteadyStateWriter) error
+	streamMutex       sync.RWMutex
+	streamArgsForCall []struct {
+		ctx    context.Context
 		logger lager.Logger
 		req    models.SteadyStateRequest
+		out    models.SteadyStateWriter
 	}
-	executeReturns struct {
-		result1 *models.SteadyStateResponse
-		result2 error
+	streamReturns struct {
+		result1 error
 	}
 	ValidateStub        func(req models.SteadyStateRequest) error
 	validateMutex       sync.RWMutex
@@ -27,43 +29,52 @@ type SteadyStateSimulator struct {
 	validateReturns struct {
 		result1 error
 	}
+	CostStub        func(req models.SteadyStateRequest) int64
+	costMutex       sync.RWMutex
+	costArgsForCall []struct {
+		req models.SteadyStateRequest
+	}
+	costReturns struct {
+		result1 int64
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *SteadyStateSimulator) Execute(logger lager.Logger, req models.SteadyStateRequest) (*models.SteadyStateResponse, error) {
-	fake.executeMutex.Lock()
-	fake.executeArgsForCall = append(fake.executeArgsForCall, struct {
+func (fake *SteadyStateSimulator) Stream(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest, out models.SteadyStateWriter) error {
+	fake.streamMutex.Lock()
+	fake.streamArgsForCall = append(fake.streamArgsForCall, struct {
+		ctx    context.Context
 		logger lager.Logger
 		req    models.SteadyStateRequest
-	}{logger, req})
-	fake.recordInvocation("Execute", []interface{}{logger, req})
-	fake.executeMutex.Unlock()
-	if fake.ExecuteStub != nil {
-		return fake.ExecuteStub(logger, req)
+		out    models.SteadyStateWriter
+	}{ctx, logger, req, out})
+	fake.recordInvocation("Stream", []interface{}{ctx, logger, req, out})
+	fake.streamMutex.Unlock()
+	if fake.StreamStub != nil {
+		return fake.StreamStub(ctx, logger, req, out)
 	} else {
-		return fake.executeReturns.result1, fake.executeReturns.result2
+		return fake.streamReturns.result1
 	}
 }
 
-func (fake *SteadyStateSimulator) ExecuteCallCount() int {
-	fake.executeMutex.RLock()
-	defer fake.executeMutex.RUnlock()
-	return len(fake.executeArgsForCall)
+func (fake *SteadyStateSimulator) StreamCallCount() int {
+	fake.streamMutex.RLock()
+	defer fake.streamMutex.RUnlock()
+	return len(fake.streamArgsForCall)
 }
 
-func (fake *SteadyStateSimulator) ExecuteArgsForCall(i int) (lager.Logger, models.SteadyStateRequest) {
-	fake.executeMutex.RLock()
-	defer fake.executeMutex.RUnlock()
-	return fake.executeArgsForCall[i].logger, fake.executeArgsForCall[i].req
+func (fake *SteadyStateSimulator) StreamArgsForCall(i int) (context.Context, lager.Logger, models.SteadyStateRequest, models.SteadyStateWriter) {
+	fake.streamMutex.RLock()
+	defer fake.streamMutex.RUnlock()
+	return fake.streamArgsForCall[i].ctx, fake.streamArgsForCall[i].logger, fake.streamArgsForCall[i].req, fake.streamArgsForCall[i].out
 }
 
-func (fake *SteadyStateSimulator) ExecuteReturns(result1 *models.SteadyStateResponse, result2 error) {
-	fake.ExecuteStub = nil
-	fake.executeReturns = struct {
-		result1 *models.SteadyStateResponse
-		result2 error
-	}{result1, result2}
+func (fake *SteadyStateSimulator) StreamReturns(result1 error) {
+	fake.StreamStub = nil
+	fake.streamReturns = struct {
+		result1 error
+	}{result1}
 }
 
 func (fake *SteadyStateSimulator) Validate(req models.SteadyStateRequest) error {
@@ -99,13 +110,48 @@ func (fake *SteadyStateSimulator) ValidateReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *SteadyStateSimulator) Cost(req models.SteadyStateRequest) int64 {
+	fake.costMutex.Lock()
+	fake.costArgsForCall = append(fake.costArgsForCall, struct {
+		req models.SteadyStateRequest
+	}{req})
+	fake.recordInvocation("Cost", []interface{}{req})
+	fake.costMutex.Unlock()
+	if fake.CostStub != nil {
+		return fake.CostStub(req)
+	} else {
+		return fake.costReturns.result1
+	}
+}
+
+func (fake *SteadyStateSimulator) CostCallCount() int {
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
+	return len(fake.costArgsForCall)
+}
+
+func (fake *SteadyStateSimulator) CostArgsForCall(i int) models.SteadyStateRequest {
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
+	return fake.costArgsForCall[i].req
+}
+
+func (fake *SteadyStateSimulator) CostReturns(result1 int64) {
+	fake.CostStub = nil
+	fake.costReturns = struct {
+		result1 int64
+	}{result1}
+}
+
 func (fake *SteadyStateSimulator) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.executeMutex.RLock()
-	defer fake.executeMutex.RUnlock()
+	fake.streamMutex.RLock()
+	defer fake.streamMutex.RUnlock()
 	fake.validateMutex.RLock()
 	defer fake.validateMutex.RUnlock()
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
 	return fake.invocations
 }
 
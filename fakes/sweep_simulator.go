@@ -0,0 +1,168 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+type SweepSimulator struct {
+	ExecuteStub        func(ctx context.Context, logger lager.Logger, req models.SweepRequest) (*models.SweepResponse, error)
+	executeMutex       sync.RWMutex
+	executeArgsForCall []struct {
+		ctx    context.Context
+		logger lager.Logger
+		req    models.SweepRequest
+	}
+	executeReturns struct {
+		result1 *models.SweepResponse
+		result2 error
+	}
+	ValidateStub        func(req models.SweepRequest) error
+	validateMutex       sync.RWMutex
+	validateArgsForCall []struct {
+		req models.SweepRequest
+	}
+	validateReturns struct {
+		result1 error
+	}
+	CostStub        func(req models.SweepRequest) int64
+	costMutex       sync.RWMutex
+	costArgsForCall []struct {
+		req models.SweepRequest
+	}
+	costReturns struct {
+		result1 int64
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *SweepSimulator) Execute(ctx context.Context, logger lager.Logger, req models.SweepRequest) (*models.SweepResponse, error) {
+	fake.executeMutex.Lock()
+	fake.executeArgsForCall = append(fake.executeArgsForCall, struct {
+		ctx    context.Context
+		logger lager.Logger
+		req    models.SweepRequest
+	}{ctx, logger, req})
+	fake.recordInvocation("Execute", []interface{}{ctx, logger, req})
+	fake.executeMutex.Unlock()
+	if fake.ExecuteStub != nil {
+		return fake.ExecuteStub(ctx, logger, req)
+	} else {
+		return fake.executeReturns.result1, fake.executeReturns.result2
+	}
+}
+
+func (fake *SweepSimulator) ExecuteCallCount() int {
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	return len(fake.executeArgsForCall)
+}
+
+func (fake *SweepSimulator) ExecuteArgsForCall(i int) (context.Context, lager.Logger, models.SweepRequest) {
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	return fake.executeArgsForCall[i].ctx, fake.executeArgsForCall[i].logger, fake.executeArgsForCall[i].req
+}
+
+func (fake *SweepSimulator) ExecuteReturns(result1 *models.SweepResponse, result2 error) {
+	fake.ExecuteStub = nil
+	fake.executeReturns = struct {
+		result1 *models.SweepResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *SweepSimulator) Validate(req models.SweepRequest) error {
+	fake.validateMutex.Lock()
+	fake.validateArgsForCall = append(fake.validateArgsForCall, struct {
+		req models.SweepRequest
+	}{req})
+	fake.recordInvocation("Validate", []interface{}{req})
+	fake.validateMutex.Unlock()
+	if fake.ValidateStub != nil {
+		return fake.ValidateStub(req)
+	} else {
+		return fake.validateReturns.result1
+	}
+}
+
+func (fake *SweepSimulator) ValidateCallCount() int {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return len(fake.validateArgsForCall)
+}
+
+func (fake *SweepSimulator) ValidateArgsForCall(i int) models.SweepRequest {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return fake.validateArgsForCall[i].req
+}
+
+func (fake *SweepSimulator) ValidateReturns(result1 error) {
+	fake.ValidateStub = nil
+	fake.validateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *SweepSimulator) Cost(req models.SweepRequest) int64 {
+	fake.costMutex.Lock()
+	fake.costArgsForCall = append(fake.costArgsForCall, struct {
+		req models.SweepRequest
+	}{req})
+	fake.recordInvocation("Cost", []interface{}{req})
+	fake.costMutex.Unlock()
+	if fake.CostStub != nil {
+		return fake.CostStub(req)
+	} else {
+		return fake.costReturns.result1
+	}
+}
+
+func (fake *SweepSimulator) CostCallCount() int {
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
+	return len(fake.costArgsForCall)
+}
+
+func (fake *SweepSimulator) CostArgsForCall(i int) models.SweepRequest {
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
+	return fake.costArgsForCall[i].req
+}
+
+func (fake *SweepSimulator) CostReturns(result1 int64) {
+	fake.CostStub = nil
+	fake.costReturns = struct {
+		result1 int64
+	}{result1}
+}
+
+func (fake *SweepSimulator) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.executeMutex.RLock()
+	defer fake.executeMutex.RUnlock()
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	fake.costMutex.RLock()
+	defer fake.costMutex.RUnlock()
+	return fake.invocations
+}
+
+func (fake *SweepSimulator) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rosenhouse/cnsim/admission"
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/admitter.go --fake-name Admitter . admitter
+type admitter interface {
+	Admit(cost int64) (func(), error)
+	RetryAfter() time.Duration
+}
+
+// admit reserves the cost of a request, responding with a 429 and returning
+// false when the budget is spent, or with a 413 when the request costs more
+// than the whole budget. A nil admitter admits everything. The caller must
+// call release once the simulation is done.
+func admit(logger lager.Logger, w http.ResponseWriter, a admitter, cost int64) (release func(), ok bool) {
+	if a == nil {
+		return func() {}, true
+	}
+	release, err := a.Admit(cost)
+	if err != nil {
+		logger.Info("admission", lager.Data{"cost": cost, "error": err.Error()})
+		if _, tooLarge := err.(admission.TooLargeError); tooLarge {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			tryEncode(logger, w, models.APIError{Code: "admission", Error: fmt.Sprintf("admission: %s", err)})
+			return nil, false
+		}
+		retryAfter := int(math.Ceil(a.RetryAfter().Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		tryEncode(logger, w, models.APIError{Code: "admission", Error: fmt.Sprintf("admission: %s", err)})
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/tedsuo/rata"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/app_size_histogram_registry.go --fake-name AppSizeHistogramRegistry . appSizeHistogramRegistry
+type appSizeHistogramRegistry interface {
+	Execute(logger lager.Logger, req models.AppSizeHistogramRequest) (*models.AppSizeHistogramResponse, error)
+	Validate(req models.AppSizeHistogramRequest) error
+}
+
+// AppSizeHistogram registers the histogram in the JSON request body under the
+// name in the path.
+type AppSizeHistogram struct {
+	Logger   lager.Logger
+	Registry appSizeHistogramRegistry
+}
+
+func (h *AppSizeHistogram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.Session("app-size-histogram")
+	logger.Info("start")
+	defer logger.Info("done")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	reqData := models.AppSizeHistogramRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)).Decode(&reqData)
+	if err != nil {
+		logger.Error("decode", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		tryEncode(logger, w, models.APIError{Code: "decode", Error: fmt.Sprintf("decode: %s", err)})
+		return
+	}
+	reqData.Name = rata.Param(r, "name")
+
+	err = h.Registry.Validate(reqData)
+	if err != nil {
+		logger.Error("validation", err)
+		w.WriteHeader(http.StatusBadRequest)
+		tryEncode(logger, w, validationError(err))
+		return
+	}
+
+	resp, err := h.Registry.Execute(logger.Session("execute"), reqData)
+	if err != nil {
+		logger.Error("registry", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		tryEncode(logger, w, models.APIError{Code: "registry", Error: fmt.Sprintf("registry: %s", err)})
+		return
+	}
+
+	tryEncode(logger, w, resp)
+}
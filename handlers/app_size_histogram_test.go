@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("AppSizeHistogram Handler", func() {
+	var (
+		logger   *lagertest.TestLogger
+		registry *fakes.AppSizeHistogramRegistry
+		handler  handlers.AppSizeHistogram
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		registry = &fakes.AppSizeHistogramRegistry{}
+		handler = handlers.AppSizeHistogram{
+			Logger:   logger,
+			Registry: registry,
+		}
+
+		response = httptest.NewRecorder()
+
+		// the router passes path parameters to handlers in the query
+		var err error
+		request, err = http.NewRequest("PUT", "http://localhost/app_size_histograms/my-fleet?:name=my-fleet",
+			strings.NewReader(`{"Histogram": {"1": 50, "2": 30, "10": 20}}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry.ExecuteReturns(&models.AppSizeHistogramResponse{
+			Name:    "my-fleet",
+			NumApps: 100,
+			Mean:    3.1,
+		}, nil)
+	})
+
+	It("decodes the body, takes the name from the path and validates the request", func() {
+		handler.ServeHTTP(response, request)
+
+		expected := models.AppSizeHistogramRequest{
+			Name:      "my-fleet",
+			Histogram: map[int]int{1: 50, 2: 30, 10: 20},
+		}
+		Expect(registry.ValidateCallCount()).To(Equal(1))
+		Expect(registry.ValidateArgsForCall(0)).To(Equal(expected))
+
+		Expect(registry.ExecuteCallCount()).To(Equal(1))
+		l, r := registry.ExecuteArgsForCall(0)
+		Expect(l.SessionName()).To(Equal("test.app-size-histogram.execute"))
+		Expect(r).To(Equal(expected))
+	})
+
+	It("marshals the registry response to JSON", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(response.Code).To(Equal(200))
+		Expect(response.HeaderMap.Get("Content-Type")).To(Equal("application/json"))
+
+		var respData models.AppSizeHistogramResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+		Expect(respData).To(Equal(models.AppSizeHistogramResponse{
+			Name:    "my-fleet",
+			NumApps: 100,
+			Mean:    3.1,
+		}))
+	})
+
+	Context("when the body is not a histogram", func() {
+		BeforeEach(func() {
+			var err error
+			request, err = http.NewRequest("PUT", "http://localhost/app_size_histograms/my-fleet?:name=my-fleet",
+				strings.NewReader(`{"Histogram": {"banana": 1}}`))
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 400 and does not register anything", func() {
+			Expect(response.Code).To(Equal(400))
+			Expect(registry.ValidateCallCount()).To(Equal(0))
+			Expect(registry.ExecuteCallCount()).To(Equal(0))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("decode: "))
+		})
+	})
+
+	Context("when the body is too large", func() {
+		BeforeEach(func() {
+			var err error
+			request, err = http.NewRequest("PUT", "http://localhost/app_size_histograms/my-fleet?:name=my-fleet",
+				strings.NewReader(`{"Histogram": {"1": 50`+strings.Repeat(" ", 1<<20)+`}}`))
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 400 without reading all of it", func() {
+			Expect(response.Code).To(Equal(400))
+			Expect(registry.ValidateCallCount()).To(Equal(0))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("request body too large"))
+		})
+	})
+
+	Context("when validating the data fails", func() {
+		BeforeEach(func() {
+			registry.ValidateReturns(errors.New("banana"))
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 400 and does not register the histogram", func() {
+			Expect(response.Code).To(Equal(400))
+			Expect(registry.ExecuteCallCount()).To(Equal(0))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("validation: banana"))
+		})
+	})
+
+	Context("when the registry errors", func() {
+		BeforeEach(func() {
+			registry.ExecuteReturns(nil, errors.New("banana"))
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 500 and the message in JSON", func() {
+			Expect(response.Code).To(Equal(500))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("registry: banana"))
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/batch_simulator.go --fake-name BatchSimulator . batchSimulator
+type batchSimulator interface {
+	Execute(ctx context.Context, logger lager.Logger, req models.BatchRequest) (*models.BatchResponse, error)
+	Validate(req models.BatchRequest) error
+	Cost(req models.BatchRequest) int64
+}
+
+type Batch struct {
+	Logger    lager.Logger
+	Simulator batchSimulator
+	Admission admitter // optional
+}
+
+func (h *Batch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqData := models.BatchRequest{}
+	serveSimulation(h.Logger.Session("batch"), w, r, h.Admission, &reqData, simulation{
+		validate: func() error { return h.Simulator.Validate(reqData) },
+		cost:     func() int64 { return h.Simulator.Cost(reqData) },
+		execute: func(ctx context.Context, logger lager.Logger) (interface{}, error) {
+			return h.Simulator.Execute(ctx, logger, reqData)
+		},
+	})
+}
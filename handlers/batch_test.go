@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dghubble/sling"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("Batch Handler", func() {
+	var (
+		logger    *lagertest.TestLogger
+		simulator *fakes.BatchSimulator
+		handler   handlers.Batch
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		reqData  models.BatchRequest
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		simulator = &fakes.BatchSimulator{}
+		handler = handlers.Batch{
+			Logger:    logger,
+			Simulator: simulator,
+		}
+
+		response = httptest.NewRecorder()
+
+		reqData = models.BatchRequest{
+			SteadyStateRequest: models.SteadyStateRequest{
+				NumHosts:            123,
+				NumApps:             456,
+				MeanInstancesPerApp: 7,
+				Seed:                1011,
+			},
+			Trials: 20,
+		}
+
+		var err error
+		apiClient := sling.New().Base("http://localhost/").Client(http.DefaultClient)
+		request, err = apiClient.New().Get("steady_state/batch").QueryStruct(reqData).Request()
+		Expect(err).NotTo(HaveOccurred())
+
+		simulator.ExecuteReturns(&models.BatchResponse{
+			Request: reqData,
+			Metrics: map[string]models.Estimate{
+				"TotalInstances": {Mean: 3192},
+			},
+		}, nil)
+	})
+
+	It("decodes the flattened query into the batch request and validates it", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(simulator.ValidateCallCount()).To(Equal(1))
+		Expect(simulator.ValidateArgsForCall(0)).To(Equal(reqData))
+		Expect(simulator.CostArgsForCall(0)).To(Equal(reqData))
+
+		Expect(simulator.ExecuteCallCount()).To(Equal(1))
+		ctx, l, r := simulator.ExecuteArgsForCall(0)
+		Expect(ctx).To(Equal(request.Context()))
+		Expect(l.SessionName()).To(Equal("test.batch.execute"))
+		Expect(r).To(Equal(reqData))
+	})
+
+	It("marshals the simulator response to JSON", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(response.Code).To(Equal(200))
+		Expect(response.HeaderMap.Get("Content-Type")).To(Equal("application/json"))
+
+		var respData models.BatchResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+		Expect(respData.Metrics["TotalInstances"].Mean).To(Equal(3192.0))
+	})
+})
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/churn_simulator.go --fake-name ChurnSimulator . churnSimulator
+type churnSimulator interface {
+	Execute(ctx context.Context, logger lager.Logger, req models.ChurnRequest) (*models.ChurnResponse, error)
+	Validate(req models.ChurnRequest) error
+	Cost(req models.ChurnRequest) int64
+}
+
+type Churn struct {
+	Logger    lager.Logger
+	Simulator churnSimulator
+	Admission admitter // optional
+}
+
+func (h *Churn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqData := models.ChurnRequest{}
+	serveSimulation(h.Logger.Session("churn"), w, r, h.Admission, &reqData, simulation{
+		validate: func() error { return h.Simulator.Validate(reqData) },
+		cost:     func() int64 { return h.Simulator.Cost(reqData) },
+		execute: func(ctx context.Context, logger lager.Logger) (interface{}, error) {
+			return h.Simulator.Execute(ctx, logger, reqData)
+		},
+	})
+}
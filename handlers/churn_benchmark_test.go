@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/NYTimes/gziphandler"
+	"github.com/rosenhouse/cnsim/distributions"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+func benchmarkChurn(b *testing.B, query string) {
+	handler := gziphandler.GzipHandler(&handlers.Churn{
+		Logger: lager.NewLogger("benchmark"),
+		Simulator: &simulate.Churn{
+			AppSizeDistribution: &distributions.GeometricWithPositiveSupport{},
+		},
+	})
+	request, err := http.NewRequest("GET", "/churn?"+query, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	peakMB := measurePeakHeap(b, func() {
+		handler.ServeHTTP(&discardResponse{header: http.Header{}}, request)
+	})
+	b.Logf("peak heap: %.1f MB", peakMB)
+	if peakMB > peakHeapBudgetMB {
+		b.Errorf("peak heap of %.1f MB is over the budget of %d MB", peakMB, peakHeapBudgetMB)
+	}
+}
+
+const maxSizeChurnQuery = "NumHosts=1000&DurationSeconds=1000&MeanPoliciesPerApp=10&Seed=1"
+
+// The churn benchmarks each come close to the limit that Validate sets on
+// the estimated peak memory, in a different way.
+
+func BenchmarkChurnMaxSizePushes(b *testing.B) {
+	benchmarkChurn(b, maxSizeChurnQuery+"&NumApps=1000&MeanInstancesPerApp=90&PushesPerSecond=38&SampleIntervalSeconds=1000")
+}
+
+func BenchmarkChurnMaxSizeApps(b *testing.B) {
+	benchmarkChurn(b, maxSizeChurnQuery+"&NumApps=15000&MeanInstancesPerApp=1&PushesPerSecond=100&SampleIntervalSeconds=1000")
+}
+
+func BenchmarkChurnMaxSizeSamples(b *testing.B) {
+	benchmarkChurn(b, maxSizeChurnQuery+"&NumApps=20000&MeanInstancesPerApp=10&SampleIntervalSeconds=1")
+}
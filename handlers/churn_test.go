@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dghubble/sling"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("Churn Handler", func() {
+	var (
+		logger    *lagertest.TestLogger
+		simulator *fakes.ChurnSimulator
+		handler   handlers.Churn
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		reqData  models.ChurnRequest
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		simulator = &fakes.ChurnSimulator{}
+		handler = handlers.Churn{
+			Logger:    logger,
+			Simulator: simulator,
+		}
+
+		response = httptest.NewRecorder()
+
+		reqData = models.ChurnRequest{
+			NumHosts:              12,
+			NumApps:               34,
+			MeanInstancesPerApp:   5,
+			DurationSeconds:       600,
+			SampleIntervalSeconds: 60,
+			PushesPerSecond:       0.5,
+			DeletesPerSecond:      0.25,
+		}
+
+		var err error
+		apiClient := sling.New().Base("http://localhost/").Client(http.DefaultClient)
+		request, err = apiClient.New().Get("churn").QueryStruct(reqData).Request()
+		Expect(err).NotTo(HaveOccurred())
+
+		simulator.ExecuteReturns(&models.ChurnResponse{
+			Request: reqData,
+
+			PeakInstanceChangesPerSecond: 42,
+		}, nil)
+	})
+
+	It("unmarshals the request query data, validates it and passes it to the simulator", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(simulator.ValidateCallCount()).To(Equal(1))
+		Expect(simulator.ValidateArgsForCall(0)).To(Equal(reqData))
+		Expect(simulator.CostArgsForCall(0)).To(Equal(reqData))
+
+		Expect(simulator.ExecuteCallCount()).To(Equal(1))
+		ctx, l, r := simulator.ExecuteArgsForCall(0)
+		Expect(ctx).To(Equal(request.Context()))
+		Expect(l.SessionName()).To(Equal("test.churn.execute"))
+		Expect(r).To(Equal(reqData))
+	})
+
+	It("marshals the simulator response to JSON", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(response.Code).To(Equal(200))
+		Expect(response.HeaderMap.Get("Content-Type")).To(Equal("application/json"))
+
+		var respData models.ChurnResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+		Expect(respData.PeakInstanceChangesPerSecond).To(Equal(42))
+	})
+})
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+
+	defaultCSVTable = "instances"
+)
+
+// negotiate picks the supported content type that the Accept header ranks
+// highest, defaulting to JSON.
+func negotiate(accept string) string {
+	best, bestQuality := contentTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case contentTypeJSON, contentTypeCSV, contentTypeNDJSON:
+			if quality > bestQuality {
+				best, bestQuality = mediaType, quality
+			}
+		}
+	}
+	return best
+}
+
+// table describes the rows that one list in a steady-state response is
+// flattened into.
+type table struct {
+	record  string // names a row in NDJSON
+	columns []string
+}
+
+var tables = map[string]table{
+	"apps":      {"app", []string{"Id", "Size", "MemoryMB"}},
+	"instances": {"instance", []string{"Id", "AppId", "HostId", "Zone", "IP"}},
+	"policies":  {"policy", []string{"Id", "SourceAppId", "DestinationAppId", "Protocol", "Port", "Volume"}},
+	"hosts":     {"host", []string{"Id", "Instances", "DistinctApps", "Rules"}},
+}
+
+// tableOrder is the order in which NDJSON streams every table.
+var tableOrder = []string{"apps", "instances", "policies", "hosts"}
+
+// selectTables returns the tables named by the table query parameter, or
+// the defaults for the content type when it is empty.
+func selectTables(contentType, name string) ([]string, error) {
+	if name == "" {
+		if contentType == contentTypeCSV {
+			return []string{defaultCSVTable}, nil
+		}
+		return tableOrder, nil
+	}
+	if _, ok := tables[name]; !ok {
+		names := make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("table must be one of: %s", strings.Join(names, ", "))
+	}
+	return []string{name}, nil
+}
+
+// takeQuery removes a parameter that is not part of the request model from
+// the query, so that decoding the form does not reject it. A malformed query
+// is left for the form decoder to report.
+func takeQuery(r *http.Request, key string) string {
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return ""
+	}
+	value := query.Get(key)
+	query.Del(key)
+	r.URL.RawQuery = query.Encode()
+	return value
+}
+
+// formats maps the names that NewSteadyStateWriter accepts to content
+// types.
+var formats = map[string]string{
+	"json":   contentTypeJSON,
+	"csv":    contentTypeCSV,
+	"ndjson": contentTypeNDJSON,
+}
+
+// NewSteadyStateWriter writes a steady-state response to w in the named
+// format, as the steady-state handler responds with it. The table selects
+// what csv and ndjson write, as the table query parameter does.
+func NewSteadyStateWriter(format, table string, w io.Writer) (models.SteadyStateWriter, error) {
+	contentType, ok := formats[format]
+	if !ok {
+		return nil, errors.New("format must be one of: csv, json, ndjson")
+	}
+	tableNames, err := selectTables(contentType, table)
+	if err != nil {
+		return nil, err
+	}
+	return newSteadyStateWriter(contentType, tableNames, http.Header{}, w), nil
+}
+
+// newSteadyStateWriter returns a writer for the content type, which sets
+// the Content-Type in header once the response starts.
+func newSteadyStateWriter(contentType string, tableNames []string, header http.Header, w io.Writer) models.SteadyStateWriter {
+	buffered := bufio.NewWriter(w)
+	switch contentType {
+	case contentTypeCSV:
+		return newCSVWriter(header, buffered, tableNames[0])
+	case contentTypeNDJSON:
+		return newNDJSONWriter(header, buffered, tableNames)
+	default:
+		return &jsonWriter{header: header, w: buffered, end: "\n"}
+	}
+}
+
+// summary encodes a response without its apps, instances and policies.
+type summary struct {
+	*models.SteadyStateResponse
+	Apps      []models.App      `json:",omitempty"`
+	Instances []models.Instance `json:",omitempty"`
+	Policies  []models.Policy   `json:",omitempty"`
+}
+
+var jsonSections = []string{"Apps", "Instances", "Policies"}
+
+// jsonWriter writes the same document as encoding the whole response at
+// once, one array element at a time. It writes end after the document.
+type jsonWriter struct {
+	header  http.Header
+	w       *bufio.Writer
+	end     string
+	section int // index into jsonSections of the open array, or -1
+	empty   bool
+}
+
+func (j *jsonWriter) WriteSummary(resp *models.SteadyStateResponse) error {
+	j.header.Set("Content-Type", contentTypeJSON)
+	encoded, err := json.Marshal(summary{SteadyStateResponse: resp})
+	if err != nil {
+		return err
+	}
+	j.section = -1
+	_, err = j.w.Write(encoded[:len(encoded)-1]) // leaves the object open
+	return err
+}
+
+// element appends a value to an array, first opening the array and any
+// empty arrays before it.
+func (j *jsonWriter) element(section int, value interface{}) error {
+	for j.section < section {
+		j.nextSection()
+	}
+	if !j.empty {
+		j.w.WriteByte(',')
+	}
+	j.empty = false
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(encoded)
+	return err
+}
+
+func (j *jsonWriter) nextSection() {
+	if j.section >= 0 {
+		j.w.WriteByte(']')
+	}
+	j.section++
+	fmt.Fprintf(j.w, `,"%s":[`, jsonSections[j.section])
+	j.empty = true
+}
+
+func (j *jsonWriter) WriteApp(app models.App) error {
+	return j.element(0, app)
+}
+
+func (j *jsonWriter) WriteInstance(instance models.Instance) error {
+	return j.element(1, instance)
+}
+
+func (j *jsonWriter) WritePolicy(policy models.Policy) error {
+	return j.element(2, policy)
+}
+
+func (j *jsonWriter) Close() error {
+	for j.section < len(jsonSections)-1 {
+		j.nextSection()
+	}
+	j.w.WriteString("]}")
+	j.w.WriteString(j.end)
+	return j.w.Flush()
+}
+
+// rowWriter flattens a response into the rows of the selected tables. The
+// rows of the hosts table come from the summary, so they follow the others.
+type rowWriter struct {
+	selected map[string]bool
+	begin    func(resp *models.SteadyStateResponse) error
+	row      func(name string, values []interface{}) error
+	end      func(resp *models.SteadyStateResponse) error
+
+	resp        *models.SteadyStateResponse
+	numPolicies int
+	values      []interface{}
+}
+
+func newRowWriter(tableNames []string) *rowWriter {
+	r := &rowWriter{selected: make(map[string]bool)}
+	for _, name := range tableNames {
+		r.selected[name] = true
+	}
+	return r
+}
+
+func (r *rowWriter) WriteSummary(resp *models.SteadyStateResponse) error {
+	r.resp = resp
+	return r.begin(resp)
+}
+
+func (r *rowWriter) write(name string, values ...interface{}) error {
+	if !r.selected[name] {
+		return nil
+	}
+	r.values = append(r.values[:0], values...)
+	return r.row(name, r.values)
+}
+
+func (r *rowWriter) WriteApp(app models.App) error {
+	return r.write("apps", app.Id, app.Size, app.MemoryMB)
+}
+
+func (r *rowWriter) WriteInstance(instance models.Instance) error {
+	return r.write("instances", instance.Id, instance.AppId, instance.HostId, instance.Zone, instance.IP)
+}
+
+func (r *rowWriter) WritePolicy(policy models.Policy) error {
+	id := r.numPolicies
+	r.numPolicies++
+	return r.write("policies", id, policy.SourceAppId, policy.DestinationAppId, policy.Protocol, policy.Port, policy.Volume)
+}
+
+func (r *rowWriter) Close() error {
+	hostStats := r.resp.HostStats
+	for id, instances := range hostStats.InstancesPerHost {
+		rules := 0
+		if id < len(r.resp.PolicyStats.RulesPerHost) {
+			rules = r.resp.PolicyStats.RulesPerHost[id]
+		}
+		if err := r.write("hosts", id, instances, hostStats.DistinctAppsPerHost[id], rules); err != nil {
+			return err
+		}
+	}
+	return r.end(r.resp)
+}
+
+// newCSVWriter writes a single table, preceded by comment lines that record
+// the request and seed.
+func newCSVWriter(header http.Header, buffered *bufio.Writer, name string) models.SteadyStateWriter {
+	writer := csv.NewWriter(buffered)
+	record := make([]string, len(tables[name].columns))
+
+	r := newRowWriter([]string{name})
+	r.begin = func(resp *models.SteadyStateResponse) error {
+		header.Set("Content-Type", contentTypeCSV)
+		request, err := json.Marshal(resp.Request)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buffered, "# Request: %s\n", request)
+		fmt.Fprintf(buffered, "# Seed: %d\n", resp.Seed)
+		fmt.Fprintf(buffered, "# PlacementStrategy: %s\n", resp.PlacementStrategy)
+		return writer.Write(tables[name].columns)
+	}
+	r.row = func(_ string, values []interface{}) error {
+		for i, value := range values {
+			switch value := value.(type) {
+			case int:
+				record[i] = strconv.Itoa(value)
+			case string:
+				record[i] = value
+			}
+		}
+		return writer.Write(record)
+	}
+	r.end = func(*models.SteadyStateResponse) error {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+	return r
+}
+
+// newNDJSONWriter writes one JSON record per line: the request and seed
+// first, then a row of each selected table and finally the summary
+// statistics. Every record has a Type.
+func newNDJSONWriter(header http.Header, buffered *bufio.Writer, tableNames []string) models.SteadyStateWriter {
+	encoder := json.NewEncoder(buffered)
+	var line []byte
+
+	r := newRowWriter(tableNames)
+	r.begin = func(resp *models.SteadyStateResponse) error {
+		header.Set("Content-Type", contentTypeNDJSON)
+		return encoder.Encode(struct {
+			Type              string
+			Request           models.SteadyStateRequest
+			Seed              int64
+			PlacementStrategy string
+		}{"request", resp.Request, resp.Seed, resp.PlacementStrategy})
+	}
+	r.row = func(name string, values []interface{}) error {
+		t := tables[name]
+		line = append(line[:0], `{"Type":"`...)
+		line = append(line, t.record...)
+		line = append(line, '"')
+		for i, value := range values {
+			line = append(line, `,"`...)
+			line = append(line, t.columns[i]...)
+			line = append(line, `":`...)
+			line = appendJSON(line, value)
+		}
+		line = append(line, "}\n"...)
+		_, err := buffered.Write(line)
+		return err
+	}
+	r.end = func(resp *models.SteadyStateResponse) error {
+		err := encoder.Encode(struct {
+			Type string
+			summary
+		}{"summary", summary{SteadyStateResponse: resp}})
+		if err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+	return r
+}
+
+// appendJSON encodes the int or string value of a column.
+func appendJSON(line []byte, value interface{}) []byte {
+	switch value := value.(type) {
+	case int:
+		return strconv.AppendInt(line, int64(value), 10)
+	case string:
+		encoded, _ := json.Marshal(value) // strings always encode
+		return append(line, encoded...)
+	}
+	return append(line, "null"...)
+}
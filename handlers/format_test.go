@@ -0,0 +1,253 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dghubble/sling"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("Output formats", func() {
+	var (
+		simulator *fakes.SteadyStateSimulator
+		handler   handlers.SteadyState
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		reqData  models.SteadyStateRequest
+		resp     *models.SteadyStateResponse
+	)
+
+	BeforeEach(func() {
+		simulator = &fakes.SteadyStateSimulator{}
+		handler = handlers.SteadyState{
+			Logger:    lagertest.NewTestLogger("test"),
+			Simulator: simulator,
+		}
+		response = httptest.NewRecorder()
+
+		reqData = models.SteadyStateRequest{
+			NumHosts:            2,
+			NumApps:             2,
+			MeanInstancesPerApp: 1,
+			Seed:                42,
+		}
+		var err error
+		request, err = sling.New().Base("http://localhost/").Get("steady_state").QueryStruct(reqData).Request()
+		Expect(err).NotTo(HaveOccurred())
+
+		resp = &models.SteadyStateResponse{
+			Request:           reqData,
+			Seed:              42,
+			PlacementStrategy: "round-robin",
+			TotalInstances:    3,
+			HostStats: models.HostStats{
+				InstancesPerHost:    []int{2, 1},
+				DistinctAppsPerHost: []int{2, 1},
+			},
+			Apps: []models.App{
+				{Id: 0, Size: 2},
+				{Id: 1, Size: 1},
+			},
+			Instances: []models.Instance{
+				{Id: 0, AppId: 0, HostId: 0, IP: "10.255.0.2"},
+				{Id: 1, AppId: 0, HostId: 1, IP: "10.255.1.2"},
+				{Id: 2, AppId: 1, HostId: 0, IP: "10.255.0.3"},
+			},
+			Policies: []models.Policy{
+				{SourceAppId: 0, DestinationAppId: 1, Protocol: "tcp", Port: 8080},
+			},
+		}
+		simulator.StreamStub = streams(resp)
+	})
+
+	withTable := func(table string) {
+		request.URL.RawQuery += "&table=" + table
+	}
+
+	It("defaults to JSON", func() {
+		request.Header.Set("Accept", "text/html, */*")
+		handler.ServeHTTP(response, request)
+
+		Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(response.Header().Get("Vary")).To(Equal("Accept"))
+		var respData models.SteadyStateResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+		Expect(respData.TotalInstances).To(Equal(3))
+	})
+
+	It("streams the same JSON document as encoding the whole response", func() {
+		handler.ServeHTTP(response, request)
+
+		expected, err := json.Marshal(resp)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.String()).To(Equal(string(expected) + "\n"))
+	})
+
+	It("streams empty arrays as JSON would", func() {
+		resp.Instances = []models.Instance{}
+		resp.Policies = []models.Policy{}
+		handler.ServeHTTP(response, request)
+
+		expected, err := json.Marshal(resp)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body.String()).To(Equal(string(expected) + "\n"))
+	})
+
+	It("does not pass the table selector to the simulator", func() {
+		withTable("apps")
+		handler.ServeHTTP(response, request)
+
+		Expect(simulator.ValidateArgsForCall(0)).To(Equal(reqData))
+	})
+
+	Context("when CSV is accepted", func() {
+		BeforeEach(func() {
+			request.Header.Set("Accept", "text/csv")
+		})
+
+		It("writes the instances table after the request and seed", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Header().Get("Content-Type")).To(Equal("text/csv"))
+			lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+			Expect(lines[0]).To(HavePrefix(`# Request: {"NumHosts":2,"NumApps":2,"MeanInstancesPerApp":1,`))
+			Expect(lines[1:]).To(Equal([]string{
+				"# Seed: 42",
+				"# PlacementStrategy: round-robin",
+				"Id,AppId,HostId,Zone,IP",
+				"0,0,0,0,10.255.0.2",
+				"1,0,1,0,10.255.1.2",
+				"2,1,0,0,10.255.0.3",
+			}))
+		})
+
+		It("writes the table selected in the query", func() {
+			withTable("policies")
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Body.String()).To(HaveSuffix(
+				"Id,SourceAppId,DestinationAppId,Protocol,Port,Volume\n" +
+					"0,0,1,tcp,8080,0\n"))
+		})
+
+		It("writes a row per host", func() {
+			withTable("hosts")
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Body.String()).To(HaveSuffix(
+				"Id,Instances,DistinctApps,Rules\n" +
+					"0,2,2,0\n" +
+					"1,1,1,0\n"))
+		})
+	})
+
+	Context("when NDJSON is accepted", func() {
+		BeforeEach(func() {
+			request.Header.Set("Accept", "text/csv;q=0.5, application/x-ndjson")
+		})
+
+		decodeLines := func() []map[string]interface{} {
+			var records []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(response.Body.String()), "\n") {
+				var record map[string]interface{}
+				Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+				records = append(records, record)
+			}
+			return records
+		}
+
+		It("streams a record per line, starting with the request", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Header().Get("Content-Type")).To(Equal("application/x-ndjson"))
+			records := decodeLines()
+			Expect(records).To(HaveLen(1 + 2 + 3 + 1 + 2 + 1))
+
+			Expect(records[0]["Type"]).To(Equal("request"))
+			Expect(records[0]["Seed"]).To(Equal(42.0))
+			Expect(records[0]["Request"]).To(HaveKeyWithValue("NumHosts", 2.0))
+
+			Expect(records[1]).To(Equal(map[string]interface{}{"Type": "app", "Id": 0.0, "Size": 2.0, "MemoryMB": 0.0}))
+			Expect(records[3]).To(HaveKeyWithValue("IP", "10.255.0.2"))
+			Expect(records[6]).To(HaveKeyWithValue("Protocol", "tcp"))
+			Expect(records[7]).To(HaveKeyWithValue("Type", "host"))
+
+			summary := records[len(records)-1]
+			Expect(summary["Type"]).To(Equal("summary"))
+			Expect(summary["TotalInstances"]).To(Equal(3.0))
+			Expect(summary["Instances"]).To(BeNil())
+		})
+
+		It("streams only the table selected in the query", func() {
+			withTable("instances")
+			handler.ServeHTTP(response, request)
+
+			records := decodeLines()
+			Expect(records).To(HaveLen(1 + 3 + 1))
+			Expect(records[2]["Type"]).To(Equal("instance"))
+		})
+	})
+
+	Context("when the table is unknown", func() {
+		BeforeEach(func() {
+			withTable("banana")
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with a 400 before simulating", func() {
+			Expect(response.Code).To(Equal(400))
+			Expect(simulator.StreamCallCount()).To(Equal(0))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Code).To(Equal("table"))
+			Expect(err.Error).To(Equal("table: table must be one of: apps, hosts, instances, policies"))
+		})
+	})
+
+	Describe("NewSteadyStateWriter", func() {
+		write := func(format, table string) string {
+			var out bytes.Buffer
+			writer, err := handlers.NewSteadyStateWriter(format, table, &out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(streams(resp)(context.Background(), nil, reqData, writer)).To(Succeed())
+			return out.String()
+		}
+
+		It("writes what the handler responds with in each format", func() {
+			for format, contentType := range map[string]string{
+				"json":   "application/json",
+				"csv":    "text/csv",
+				"ndjson": "application/x-ndjson",
+			} {
+				response = httptest.NewRecorder()
+				request.Header.Set("Accept", contentType)
+				handler.ServeHTTP(response, request)
+				Expect(write(format, "")).To(Equal(response.Body.String()), format)
+			}
+		})
+
+		It("writes the table selected", func() {
+			Expect(write("csv", "apps")).To(ContainSubstring("Id,Size,MemoryMB\n0,2,0\n1,1,0\n"))
+		})
+
+		It("rejects unknown formats and tables", func() {
+			_, err := handlers.NewSteadyStateWriter("xml", "", &bytes.Buffer{})
+			Expect(err).To(MatchError("format must be one of: csv, json, ndjson"))
+			_, err = handlers.NewSteadyStateWriter("csv", "banana", &bytes.Buffer{})
+			Expect(err).To(MatchError("table must be one of: apps, hosts, instances, policies"))
+		})
+	})
+})
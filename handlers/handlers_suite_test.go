@@ -1,8 +1,12 @@
 package handlers_test
 
 import (
+	"context"
+
+	"code.cloudfoundry.org/lager"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/models"
 
 	"testing"
 )
@@ -11,3 +15,31 @@ func TestHandlers(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Handlers Suite")
 }
+
+// streams returns a stub that hands the response to the writer in pieces,
+// as the steady state simulator does.
+func streams(resp *models.SteadyStateResponse) func(context.Context, lager.Logger, models.SteadyStateRequest, models.SteadyStateWriter) error {
+	return func(_ context.Context, _ lager.Logger, _ models.SteadyStateRequest, out models.SteadyStateWriter) error {
+		summary := *resp
+		summary.Apps, summary.Instances, summary.Policies = nil, nil, nil
+		if err := out.WriteSummary(&summary); err != nil {
+			return err
+		}
+		for _, app := range resp.Apps {
+			if err := out.WriteApp(app); err != nil {
+				return err
+			}
+		}
+		for _, instance := range resp.Instances {
+			if err := out.WriteInstance(instance); err != nil {
+				return err
+			}
+		}
+		for _, policy := range resp.Policies {
+			if err := out.WritePolicy(policy); err != nil {
+				return err
+			}
+		}
+		return out.Close()
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/tedsuo/rata"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/job_runner.go --fake-name JobRunner . jobRunner
+type jobRunner interface {
+	Submit(logger lager.Logger, req models.SteadyStateRequest) (models.Job, error)
+	Status(id string) (models.Job, bool)
+	Cancel(id string) (models.Job, bool)
+	WriteResult(ctx context.Context, id string, out models.SteadyStateWriter) error
+	Validate(req models.SteadyStateRequest) error
+}
+
+// Jobs submits a steady-state simulation in the JSON request body on POST,
+// reports the job with the id in the path on GET, and cancels it on DELETE.
+type Jobs struct {
+	Logger lager.Logger
+	Runner jobRunner
+}
+
+func (h *Jobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.Session("jobs")
+	logger.Info("start")
+	defer logger.Info("done")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	switch r.Method {
+	case "POST":
+		h.submit(logger, w, r)
+	case "DELETE":
+		h.cancel(logger, w, rata.Param(r, "id"))
+	default:
+		h.status(logger, w, r, rata.Param(r, "id"))
+	}
+}
+
+func (h *Jobs) submit(logger lager.Logger, w http.ResponseWriter, r *http.Request) {
+	reqData := models.SteadyStateRequest{}
+	if !decodeJSON(logger, w, r, &reqData) {
+		return
+	}
+
+	err := h.Runner.Validate(reqData)
+	if err != nil {
+		logger.Error("validation", err)
+		w.WriteHeader(http.StatusBadRequest)
+		tryEncode(logger, w, validationError(err))
+		return
+	}
+
+	job, err := h.Runner.Submit(logger.Session("submit"), reqData)
+	if err != nil {
+		logger.Error("jobs", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		tryEncode(logger, w, models.APIError{Code: "jobs", Error: fmt.Sprintf("jobs: %s", err)})
+		return
+	}
+
+	// jobs live in the memory of the instance that ran them. cnsim runs as
+	// a single instance, for the sake of uploaded histograms, but the router
+	// would also send requests that carry a JSESSIONID cookie back to the
+	// instance that set it.
+	http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: job.Id, Path: "/jobs"})
+	w.Header().Set("Location", "/jobs/"+job.Id)
+	w.WriteHeader(http.StatusAccepted)
+	tryEncode(logger, w, job)
+}
+
+func (h *Jobs) cancel(logger lager.Logger, w http.ResponseWriter, id string) {
+	job, ok := h.Runner.Cancel(id)
+	if !ok {
+		notFound(logger, w, id)
+		return
+	}
+	tryEncode(logger, w, job)
+}
+
+// status writes the job, with its result streamed into the document once it
+// has succeeded.
+func (h *Jobs) status(logger lager.Logger, w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := h.Runner.Status(id)
+	if !ok {
+		notFound(logger, w, id)
+		return
+	}
+	if job.Status != models.JobSucceeded {
+		tryEncode(logger, w, job)
+		return
+	}
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		logger.Error("encode-json", err)
+		return
+	}
+	out := &startedWriter{SteadyStateWriter: &jobResultWriter{
+		jsonWriter: &jsonWriter{header: w.Header(), w: bufio.NewWriter(w), end: "}\n"},
+		prefix:     append(encoded[:len(encoded)-1], `,"Result":`...), // leaves the job open
+	}}
+	err = h.Runner.WriteResult(r.Context(), id, out)
+	if err != nil && out.started {
+		logger.Error("encode", err)
+		return
+	}
+	if err != nil {
+		notFound(logger, w, id) // expired since its status was read
+	}
+}
+
+// jobResultWriter writes the start of a job document just before the result
+// that goes inside it.
+type jobResultWriter struct {
+	*jsonWriter
+	prefix []byte
+}
+
+func (w *jobResultWriter) WriteSummary(resp *models.SteadyStateResponse) error {
+	if _, err := w.w.Write(w.prefix); err != nil {
+		return err
+	}
+	return w.jsonWriter.WriteSummary(resp)
+}
+
+func notFound(logger lager.Logger, w http.ResponseWriter, id string) {
+	logger.Info("not-found", lager.Data{"id": id})
+	w.WriteHeader(http.StatusNotFound)
+
+	tryEncode(logger, w, models.APIError{Code: "not-found", Error: fmt.Sprintf("not-found: no job %s", id)})
+}
@@ -0,0 +1,268 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("Jobs Handler", func() {
+	var (
+		logger  *lagertest.TestLogger
+		runner  *fakes.JobRunner
+		handler handlers.Jobs
+
+		response *httptest.ResponseRecorder
+		job      models.Job
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		runner = &fakes.JobRunner{}
+		handler = handlers.Jobs{
+			Logger: logger,
+			Runner: runner,
+		}
+		response = httptest.NewRecorder()
+
+		job = models.Job{
+			Id:        "some-id",
+			Status:    models.JobQueued,
+			Request:   models.SteadyStateRequest{NumHosts: 2, NumApps: 2, MeanInstancesPerApp: 1},
+			CreatedAt: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+	})
+
+	// the router passes path parameters to handlers in the query
+	newRequest := func(method, url, body string) *http.Request {
+		request, err := http.NewRequest(method, url, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		return request
+	}
+
+	decodeError := func() models.APIError {
+		var apiError models.APIError
+		Expect(json.Unmarshal(response.Body.Bytes(), &apiError)).To(Succeed())
+		return apiError
+	}
+
+	Describe("POST", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			request = newRequest("POST", "http://localhost/jobs",
+				`{"NumHosts": 2, "NumApps": 2, "MeanInstancesPerApp": 1}`)
+			request.Header.Set("Content-Type", "application/json")
+			runner.SubmitReturns(job, nil)
+		})
+
+		It("validates and submits the request", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(runner.ValidateCallCount()).To(Equal(1))
+			Expect(runner.ValidateArgsForCall(0)).To(Equal(job.Request))
+
+			Expect(runner.SubmitCallCount()).To(Equal(1))
+			l, r := runner.SubmitArgsForCall(0)
+			Expect(l.SessionName()).To(Equal("test.jobs.submit"))
+			Expect(r).To(Equal(job.Request))
+		})
+
+		It("responds with the queued job and where to find it", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+			Expect(response.Header().Get("Location")).To(Equal("/jobs/some-id"))
+			Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var respData models.Job
+			Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+			Expect(respData).To(Equal(job))
+		})
+
+		It("sets a cookie so that the router sticks to this instance", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(response.Header().Get("Set-Cookie")).To(Equal("JSESSIONID=some-id; Path=/jobs"))
+		})
+
+		Context("when the request is invalid", func() {
+			BeforeEach(func() {
+				runner.ValidateReturns(errors.New("banana"))
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 400 without submitting", func() {
+				Expect(response.Code).To(Equal(400))
+				Expect(decodeError().Code).To(Equal("validation"))
+				Expect(runner.SubmitCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the body does not decode", func() {
+			BeforeEach(func() {
+				request = newRequest("POST", "http://localhost/jobs", `{"Banana": 1}`)
+				request.Header.Set("Content-Type", "application/json")
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 400", func() {
+				Expect(response.Code).To(Equal(400))
+				Expect(decodeError().Code).To(Equal("decode"))
+				Expect(runner.ValidateCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job cannot be submitted", func() {
+			BeforeEach(func() {
+				runner.SubmitReturns(models.Job{}, errors.New("too many"))
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 503", func() {
+				Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(decodeError()).To(Equal(models.APIError{Code: "jobs", Error: "jobs: too many"}))
+			})
+		})
+	})
+
+	Describe("GET", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			request = newRequest("GET", "http://localhost/jobs/some-id?:id=some-id", "")
+			runner.StatusReturns(job, true)
+		})
+
+		It("responds with the job", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(runner.StatusArgsForCall(0)).To(Equal("some-id"))
+			Expect(response.Code).To(Equal(200))
+			var respData models.Job
+			Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+			Expect(respData).To(Equal(job))
+			Expect(runner.WriteResultCallCount()).To(Equal(0))
+		})
+
+		Context("when the job has succeeded", func() {
+			var resp *models.SteadyStateResponse
+
+			BeforeEach(func() {
+				job.Status = models.JobSucceeded
+				job.Progress = 1
+				runner.StatusReturns(job, true)
+
+				resp = &models.SteadyStateResponse{
+					Request:        job.Request,
+					Seed:           42,
+					TotalInstances: 2,
+					Apps:           []models.App{{Id: 0, Size: 1}, {Id: 1, Size: 1}},
+					Instances:      []models.Instance{{Id: 0, AppId: 0}, {Id: 1, AppId: 1, HostId: 1}},
+					Policies:       []models.Policy{},
+				}
+				stream := streams(resp)
+				runner.WriteResultStub = func(ctx context.Context, _ string, out models.SteadyStateWriter) error {
+					return stream(ctx, nil, resp.Request, out)
+				}
+			})
+
+			It("streams the result into the job", func() {
+				handler.ServeHTTP(response, request)
+
+				ctx, id, _ := runner.WriteResultArgsForCall(0)
+				Expect(ctx).To(Equal(request.Context()))
+				Expect(id).To(Equal("some-id"))
+				expected := job
+				expected.Result = resp
+				encoded, err := json.Marshal(expected)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response.Body.String()).To(MatchJSON(encoded))
+			})
+
+			Context("when the job expires before its result is written", func() {
+				BeforeEach(func() {
+					runner.WriteResultStub = nil
+					runner.WriteResultReturns(errors.New("job some-id not found"))
+					handler.ServeHTTP(response, request)
+				})
+
+				It("responds with a 404", func() {
+					Expect(response.Code).To(Equal(404))
+					Expect(decodeError().Code).To(Equal("not-found"))
+				})
+			})
+
+			Context("when writing the result fails part way", func() {
+				BeforeEach(func() {
+					runner.WriteResultStub = func(_ context.Context, _ string, out models.SteadyStateWriter) error {
+						Expect(out.WriteSummary(resp)).To(Succeed())
+						return errors.New("broken pipe")
+					}
+					handler.ServeHTTP(response, request)
+				})
+
+				It("can only log the error", func() {
+					Expect(logger.Buffer()).To(gbytes.Say(`encode.*broken pipe`))
+					Expect(response.Body.String()).NotTo(ContainSubstring("broken pipe"))
+				})
+			})
+		})
+
+		Context("when there is no such job", func() {
+			BeforeEach(func() {
+				runner.StatusReturns(models.Job{}, false)
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 404", func() {
+				Expect(response.Code).To(Equal(404))
+				Expect(decodeError()).To(Equal(models.APIError{Code: "not-found", Error: "not-found: no job some-id"}))
+			})
+		})
+	})
+
+	Describe("DELETE", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			request = newRequest("DELETE", "http://localhost/jobs/some-id?:id=some-id", "")
+			job.Status = models.JobCancelled
+			runner.CancelReturns(job, true)
+		})
+
+		It("cancels the job and responds with it", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(runner.CancelArgsForCall(0)).To(Equal("some-id"))
+			Expect(response.Code).To(Equal(200))
+			var respData models.Job
+			Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+			Expect(respData.Status).To(Equal(models.JobCancelled))
+		})
+
+		Context("when there is no such job", func() {
+			BeforeEach(func() {
+				runner.CancelReturns(models.Job{}, false)
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 404", func() {
+				Expect(response.Code).To(Equal(404))
+				Expect(decodeError().Code).To(Equal("not-found"))
+			})
+		})
+	})
+})
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const maxRequestBodyBytes = 1 << 20
+
+// decodeJSON strictly decodes a JSON request body into reqData, rejecting
+// fields that reqData does not have. On failure it responds with an error
+// that points at the offending value and returns false.
+func decodeJSON(logger lager.Logger, w http.ResponseWriter, r *http.Request, reqData interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		logger.Info("unsupported-media-type", lager.Data{"content-type": r.Header.Get("Content-Type")})
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+
+		tryEncode(logger, w, models.APIError{Code: "unsupported-media-type", Error: "Content-Type must be application/json"})
+		return false
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		logger.Error("read-body", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		tryEncode(logger, w, models.APIError{Code: "read-body", Error: fmt.Sprintf("read-body: %s", err)})
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(reqData)
+	if err == nil && decoder.Decode(&json.RawMessage{}) != io.EOF {
+		err = fmt.Errorf("unexpected data after the request")
+	}
+	if err != nil {
+		logger.Error("decode", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		tryEncode(logger, w, models.APIError{
+			Code:  "decode",
+			Error: fmt.Sprintf("decode: %s", err),
+			Path:  jsonErrorPath(body, reflect.TypeOf(reqData)),
+		})
+		return false
+	}
+	return true
+}
+
+// jsonErrorPath returns the path, like "HostClasses[1].Count", of the first
+// value in a JSON document that the Go type has no field for or cannot hold.
+// It returns "" if there is no such value.
+func jsonErrorPath(data []byte, t reflect.Type) string {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return ""
+	}
+	path, _ := findMismatch(doc, t, "")
+	return path
+}
+
+func findMismatch(value interface{}, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if value == nil || t.Kind() == reflect.Interface {
+		return "", false
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		switch t.Kind() {
+		case reflect.Struct:
+			for _, key := range keys {
+				field, ok := jsonField(t, key)
+				if !ok {
+					return joinPath(path, key), true
+				}
+				if p, bad := findMismatch(value[key], field.Type, joinPath(path, key)); bad {
+					return p, true
+				}
+			}
+			return "", false
+		case reflect.Map:
+			for _, key := range keys {
+				if !mapKeyFits(key, t.Key()) {
+					return joinPath(path, key), true
+				}
+				if p, bad := findMismatch(value[key], t.Elem(), joinPath(path, key)); bad {
+					return p, true
+				}
+			}
+			return "", false
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, element := range value {
+				if p, bad := findMismatch(element, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); bad {
+					return p, true
+				}
+			}
+			return "", false
+		}
+	case json.Number:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if _, err := strconv.ParseInt(value.String(), 10, t.Bits()); err == nil {
+				return "", false
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if _, err := strconv.ParseUint(value.String(), 10, t.Bits()); err == nil {
+				return "", false
+			}
+		case reflect.Float32, reflect.Float64:
+			return "", false
+		}
+	case string:
+		if t.Kind() == reflect.String {
+			return "", false
+		}
+	case bool:
+		if t.Kind() == reflect.Bool {
+			return "", false
+		}
+	}
+	return path, true
+}
+
+// jsonField finds the field that encoding/json would decode the key into,
+// including fields promoted from embedded structs.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if embedded, ok := jsonField(field.Type, key); ok {
+				return embedded, true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func mapKeyFits(key string, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err := strconv.ParseInt(key, 10, t.Bits())
+		return err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err := strconv.ParseUint(key, 10, t.Bits())
+		return err == nil
+	}
+	return true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -26,12 +26,42 @@ const body = `
 			<meta charset="UTF-8">
 			<link rel="stylesheet" type="text/css" href="//cdnjs.cloudflare.com/ajax/libs/twitter-bootstrap/3.3.6/css/bootstrap.min.css">
 			<link rel="stylesheet" type="text/css" href="//cdnjs.cloudflare.com/ajax/libs/dc/1.7.5/dc.css">
+			<style> .invalid { border-color: #a94442; background-color: #f2dede; } </style>
 	</head>
   <body>
 		<form action="/steady_state" method="GET" id="steady-state-request">
 		  <p> Num Hosts (1 - 1000): <input type="number" name="NumHosts" min="1" max="1000"> </p>
 		  <p> Num Apps (1 - 65k): <input type="number" name="NumApps" min="1" max="65534"> </p>
 		  <p> Avg Instances / App (1 - 100): <input type="number" name="MeanInstancesPerApp" min="1" max="100"> </p>
+		  <p> App Size Distribution (or uploaded histogram name):
+		    <input type="text" name="AppSizeDistribution" list="app-size-distributions" placeholder="geometric">
+		    <datalist id="app-size-distributions">
+		      <option value="geometric">
+		      <option value="poisson">
+		      <option value="zipf">
+		      <option value="lognormal">
+		      <option value="pareto">
+		    </datalist>
+		  </p>
+		  <p> Seed (optional): <input type="number" name="Seed"> </p>
+		  <p> Placement Strategy:
+		    <select name="PlacementStrategy">
+		      <option value="round-robin">round-robin</option>
+		      <option value="random">random</option>
+		      <option value="least-loaded">least-loaded</option>
+		      <option value="spread">spread</option>
+		      <option value="zone-balanced">zone-balanced</option>
+		    </select>
+		  </p>
+		  <p> Availability Zones (optional): <input type="number" name="NumZones" min="1" max="100"> </p>
+		  <p> Avg Policies / App (0 - 10): <input type="number" name="MeanPoliciesPerApp" min="0" max="10" step="any"> </p>
+		  <p> Policy Fan-In Skew (0 - 3): <input type="number" name="PolicyFanInSkew" min="0" max="3" step="any"> </p>
+		  <p> Policy Volume Distribution (optional): <input type="text" name="PolicyVolumeDistribution" list="app-size-distributions"> </p>
+		  <p> Avg Policy Volume (1 - 1000): <input type="number" name="MeanPolicyVolume" min="1" max="1000" step="any"> </p>
+		  <p> Overlay CIDR (optional): <input type="text" name="OverlayCIDR" placeholder="10.255.0.0/16"> </p>
+		  <p> Host Subnet Prefix Length: <input type="number" name="HostSubnetPrefixLength" min="1" max="30" placeholder="24"> </p>
+		  <p> Failed Hosts: <input type="number" name="FailedHosts" min="0" max="999"> </p>
+		  <p> Host Capacity (instances): <input type="number" name="HostCapacity" min="0"> </p>
 		</form>
 		<button id="submit-button">Simulate</button>
 		<div class="container">
@@ -46,8 +76,18 @@ const body = `
 				var chartApps = dc.barChart("#apps");
 				var jsonURL = "/steady_state?" + $('#steady-state-request').serialize()
 				console.log(jsonURL)
+				$('#steady-state-request :input').removeClass('invalid').removeAttr('title')
 				d3.json(jsonURL,
 				 function(error, steady_state) {
+					if (error) {
+						var apiError = JSON.parse(error.responseText)
+						var fields = apiError.Fields || []
+						console.log(apiError.Error)
+						fields.forEach(function(field) {
+							$('#steady-state-request [name="' + field.Field + '"]').addClass('invalid').attr('title', field.Message)
+						})
+						return
+					}
 					var apps = steady_state.Apps
 					var ndx            = crossfilter(apps),
 							countDimension = ndx.dimension(function(d) {return d.s;}),
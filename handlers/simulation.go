@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// simulation binds a simulator to the request that serveSimulation decodes,
+// so that handlers of different request types can share it.
+type simulation struct {
+	validate func() error
+	cost     func() int64
+	execute  func(ctx context.Context, logger lager.Logger) (interface{}, error)
+}
+
+// serveSimulation decodes the query into reqData, then validates, admits and
+// runs the simulation, and responds with its result as JSON. It responds
+// with nothing once the client has gone.
+func serveSimulation(logger lager.Logger, w http.ResponseWriter, r *http.Request, a admitter, reqData interface{}, sim simulation) {
+	logger.Info("start")
+	defer logger.Info("done")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if !decodeForm(logger, w, r, reqData) {
+		return
+	}
+
+	err := sim.validate()
+	if err != nil {
+		logger.Error("validation", err)
+		w.WriteHeader(http.StatusBadRequest)
+		tryEncode(logger, w, validationError(err))
+		return
+	}
+
+	release, ok := admit(logger, w, a, sim.cost())
+	if !ok {
+		return
+	}
+	defer release()
+
+	resp, err := sim.execute(r.Context(), logger.Session("execute"))
+	if err != nil && r.Context().Err() != nil {
+		logger.Info("client-cancelled", lager.Data{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error("simulator", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		tryEncode(logger, w, models.APIError{Code: "simulator", Error: fmt.Sprintf("simulator: %s", err)})
+		return
+	}
+
+	tryEncode(logger, w, resp)
+}
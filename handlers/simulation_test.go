@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dghubble/sling"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/rosenhouse/cnsim/admission"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// The batch, sweep and churn handlers share one flow, which these specs
+// follow through the churn handler.
+var _ = Describe("Simulation handlers", func() {
+	var (
+		logger    *lagertest.TestLogger
+		simulator *fakes.ChurnSimulator
+		handler   handlers.Churn
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		reqData  models.ChurnRequest
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		simulator = &fakes.ChurnSimulator{}
+		handler = handlers.Churn{
+			Logger:    logger,
+			Simulator: simulator,
+		}
+
+		response = httptest.NewRecorder()
+
+		reqData = models.ChurnRequest{
+			NumHosts:            12,
+			NumApps:             34,
+			MeanInstancesPerApp: 5,
+			DurationSeconds:     600,
+		}
+
+		var err error
+		apiClient := sling.New().Base("http://localhost/").Client(http.DefaultClient)
+		request, err = apiClient.New().Get("churn").QueryStruct(reqData).Request()
+		Expect(err).NotTo(HaveOccurred())
+
+		simulator.ExecuteReturns(&models.ChurnResponse{Request: reqData}, nil)
+	})
+
+	It("allows requests from any origin", func() {
+		handler.ServeHTTP(response, request)
+		Expect(response.Header().Get("Access-Control-Allow-Origin")).To(Equal("*"))
+	})
+
+	Context("when decoding the form data fails", func() {
+		BeforeEach(func() {
+			request.URL.RawQuery = "???"
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 400 and does not run the simulation", func() {
+			Expect(response.Code).To(Equal(400))
+			Expect(simulator.ValidateCallCount()).To(Equal(0))
+			Expect(simulator.ExecuteCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when validating the data fails", func() {
+		BeforeEach(func() {
+			simulator.ValidateReturns(errors.New("banana"))
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 400 and a useful error, and does not run the simulation", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`banana`))
+			Expect(response.Code).To(Equal(400))
+			Expect(simulator.ExecuteCallCount()).To(Equal(0))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("validation: banana"))
+		})
+	})
+
+	Context("when there is an admission controller", func() {
+		var (
+			admitter *fakes.Admitter
+			released bool
+		)
+
+		BeforeEach(func() {
+			admitter = &fakes.Admitter{}
+			released = false
+			admitter.AdmitReturns(func() { released = true }, nil)
+			simulator.CostReturns(4242)
+			handler.Admission = admitter
+		})
+
+		It("holds the cost of the request until the simulation is done", func() {
+			simulator.ExecuteStub = func(context.Context, lager.Logger, models.ChurnRequest) (*models.ChurnResponse, error) {
+				Expect(released).To(BeFalse())
+				return &models.ChurnResponse{}, nil
+			}
+			handler.ServeHTTP(response, request)
+
+			Expect(simulator.CostArgsForCall(0)).To(Equal(reqData))
+			Expect(admitter.AdmitArgsForCall(0)).To(Equal(int64(4242)))
+			Expect(simulator.ExecuteCallCount()).To(Equal(1))
+			Expect(released).To(BeTrue())
+		})
+
+		Context("when the budget is spent", func() {
+			BeforeEach(func() {
+				admitter.AdmitReturns(nil, errors.New("banana"))
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 429 without simulating", func() {
+				Expect(simulator.ExecuteCallCount()).To(Equal(0))
+				Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(response.Header().Get("Retry-After")).To(Equal("0"))
+			})
+		})
+
+		Context("when the request costs more than the whole budget", func() {
+			BeforeEach(func() {
+				admitter.AdmitReturns(nil, admission.TooLargeError{Cost: 4242, Budget: 10})
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 413 without simulating, since retrying cannot help", func() {
+				Expect(simulator.ExecuteCallCount()).To(Equal(0))
+				Expect(response.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				Expect(response.Header().Get("Retry-After")).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when the simulator errors", func() {
+		BeforeEach(func() {
+			simulator.ExecuteReturns(nil, errors.New("banana"))
+			handler.ServeHTTP(response, request)
+		})
+
+		It("responds with code 500 and the message in JSON", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`banana`))
+			Expect(response.Code).To(Equal(500))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Error).To(ContainSubstring("simulator: banana"))
+		})
+	})
+
+	Context("when the client goes away", func() {
+		BeforeEach(func() {
+			ctx, cancel := context.WithCancel(request.Context())
+			request = request.WithContext(ctx)
+			simulator.ExecuteStub = func(ctx context.Context, _ lager.Logger, _ models.ChurnRequest) (*models.ChurnResponse, error) {
+				cancel()
+				return nil, ctx.Err()
+			}
+			handler.ServeHTTP(response, request)
+		})
+
+		It("logs the cancellation and responds with nothing", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`client-cancelled`))
+			Expect(response.Body.Len()).To(BeZero())
+			Expect(response.Code).NotTo(Equal(500))
+		})
+	})
+})
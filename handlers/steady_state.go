@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/schema"
 	"github.com/rosenhouse/cnsim/models"
@@ -13,13 +15,24 @@ import (
 
 //go:generate counterfeiter -o ../fakes/steady_state_simulator.go --fake-name SteadyStateSimulator . steadyStateSimulator
 type steadyStateSimulator interface {
-	Execute(logger lager.Logger, req models.SteadyStateRequest) (*models.SteadyStateResponse, error)
+	Stream(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest, out models.SteadyStateWriter) error
 	Validate(req models.SteadyStateRequest) error
+	Cost(req models.SteadyStateRequest) int64
+}
+
+//go:generate counterfeiter -o ../fakes/stage_observer.go --fake-name StageObserver . stageObserver
+type stageObserver interface {
+	StageFinished(stage string, duration time.Duration)
 }
 
 type SteadyState struct {
 	Logger    lager.Logger
 	Simulator steadyStateSimulator
+	Admission admitter // optional
+
+	// Stages, if set, is told how long decoding, validating and streaming
+	// each request took.
+	Stages stageObserver
 }
 
 func tryEncode(logger lager.Logger, w http.ResponseWriter, resp interface{}) {
@@ -28,6 +41,43 @@ func tryEncode(logger lager.Logger, w http.ResponseWriter, resp interface{}) {
 	}
 }
 
+// validationError lists the invalid fields when err is a
+// models.ValidationError.
+func validationError(err error) models.APIError {
+	apiError := models.APIError{Code: "validation", Error: fmt.Sprintf("validation: %s", err)}
+	switch err := err.(type) {
+	case models.ValidationError:
+		apiError.Fields = err
+	case models.FieldError:
+		apiError.Fields = []models.FieldError{err}
+	}
+	return apiError
+}
+
+// decodeForm parses the query into reqData, responding with a 400 and
+// returning false on failure.
+func decodeForm(logger lager.Logger, w http.ResponseWriter, r *http.Request, reqData interface{}) bool {
+	err := r.ParseForm()
+	if err != nil {
+		logger.Error("parse-form", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		tryEncode(logger, w, models.APIError{Code: "parse-form", Error: fmt.Sprintf("parse-form: %s", err)})
+		return false
+	}
+
+	decoder := schema.NewDecoder()
+	err = decoder.Decode(reqData, r.Form)
+	if err != nil {
+		logger.Error("decode", err)
+		w.WriteHeader(http.StatusBadRequest)
+
+		tryEncode(logger, w, models.APIError{Code: "decode", Error: fmt.Sprintf("decode: %s", err)})
+		return false
+	}
+	return true
+}
+
 func (h *SteadyState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	logger := h.Logger.Session("steady-state")
 	logger.Info("start")
@@ -35,43 +85,80 @@ func (h *SteadyState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Vary", "Accept")
+
+	stage := time.Now()
+	stageDone := func(name string) {
+		now := time.Now()
+		if h.Stages != nil {
+			h.Stages.StageFinished(name, now.Sub(stage))
+		}
+		stage = now
+	}
 
-	err := r.ParseForm()
+	contentType := negotiate(r.Header.Get("Accept"))
+	tableNames, err := selectTables(contentType, takeQuery(r, "table"))
 	if err != nil {
-		logger.Error("parse-form", err)
+		logger.Error("table", err)
 		w.WriteHeader(http.StatusBadRequest)
 
-		tryEncode(logger, w, models.APIError{Error: fmt.Sprintf("parse-form: %s", err)})
+		tryEncode(logger, w, models.APIError{Code: "table", Error: fmt.Sprintf("table: %s", err)})
 		return
 	}
 
+	decode := decodeForm
+	if r.Method == "POST" {
+		decode = decodeJSON
+	}
 	reqData := models.SteadyStateRequest{}
-	decoder := schema.NewDecoder()
-	err = decoder.Decode(&reqData, r.Form)
-	if err != nil {
-		logger.Error("decode", err)
-		w.WriteHeader(http.StatusBadRequest)
-
-		tryEncode(logger, w, models.APIError{Error: fmt.Sprintf("decode: %s", err)})
+	if !decode(logger, w, r, &reqData) {
 		return
 	}
+	stageDone("decode")
 
 	err = h.Simulator.Validate(reqData)
 	if err != nil {
 		logger.Error("validation", err)
 		w.WriteHeader(http.StatusBadRequest)
-		tryEncode(logger, w, models.APIError{Error: fmt.Sprintf("validation: %s", err)})
+		tryEncode(logger, w, validationError(err))
 		return
 	}
+	stageDone("validate")
 
-	resp, err := h.Simulator.Execute(logger.Session("execute"), reqData)
+	release, ok := admit(logger, w, h.Admission, h.Simulator.Cost(reqData))
+	if !ok {
+		return
+	}
+	defer release()
+
+	out := &startedWriter{SteadyStateWriter: newSteadyStateWriter(contentType, tableNames, w.Header(), w)}
+	err = h.Simulator.Stream(r.Context(), logger.Session("execute"), reqData, out)
+	stageDone("stream")
+	if err != nil && r.Context().Err() != nil {
+		logger.Info("client-cancelled", lager.Data{"error": err.Error()})
+		return
+	}
+	if err != nil && out.started {
+		logger.Error("encode", err)
+		return
+	}
 	if err != nil {
 		logger.Error("simulator", err)
 		w.WriteHeader(http.StatusInternalServerError)
 
-		tryEncode(logger, w, models.APIError{Error: fmt.Sprintf("simulator: %s", err)})
+		tryEncode(logger, w, models.APIError{Code: "simulator", Error: fmt.Sprintf("simulator: %s", err)})
 		return
 	}
+}
+
+// startedWriter notes whether the simulation succeeded and the response
+// started, after which an error can only be logged.
+type startedWriter struct {
+	models.SteadyStateWriter
+	started bool
+}
 
-	tryEncode(logger, w, resp)
+func (w *startedWriter) WriteSummary(resp *models.SteadyStateResponse) error {
+	w.started = true
+	return w.SteadyStateWriter.WriteSummary(resp)
 }
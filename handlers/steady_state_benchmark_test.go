@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/NYTimes/gziphandler"
+	"github.com/rosenhouse/cnsim/distributions"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+// discardResponse is a ResponseWriter that throws the body away, so that
+// only the memory used to produce it is measured.
+type discardResponse struct {
+	header http.Header
+}
+
+func (r *discardResponse) Header() http.Header         { return r.header }
+func (r *discardResponse) Write(p []byte) (int, error) { return ioutil.Discard.Write(p) }
+func (r *discardResponse) WriteHeader(int)             {}
+
+// peakHeap calls f while sampling the heap every millisecond, and returns
+// the most heap in use that it saw.
+func peakHeap(f func()) uint64 {
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var stats runtime.MemStats
+		var max uint64
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > max {
+				max = stats.HeapInuse
+			}
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	f()
+	close(done)
+	return <-peak
+}
+
+// gcPercent is the GOGC that manifest.yml sets, which the budget assumes.
+const gcPercent = 25
+
+// peakHeapBudgetMB leaves room within the 32M memory limit of the manifest
+// for the rest of the process.
+const peakHeapBudgetMB = 24
+
+// measurePeakHeap calls f b.N times, and returns the most heap in use that
+// any call saw, in MB.
+func measurePeakHeap(b *testing.B, f func()) float64 {
+	defer debug.SetGCPercent(debug.SetGCPercent(gcPercent))
+
+	var maxPeak uint64
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		peak := peakHeap(f)
+		if peak > maxPeak {
+			maxPeak = peak
+		}
+	}
+	return float64(maxPeak) / (1 << 20)
+}
+
+func benchmarkSteadyState(b *testing.B, accept, query string) {
+	handler := gziphandler.GzipHandler(&handlers.SteadyState{
+		Logger: lager.NewLogger("benchmark"),
+		Simulator: &simulate.SteadyState{
+			AppSizeDistribution: &distributions.GeometricWithPositiveSupport{},
+		},
+	})
+	request, err := http.NewRequest("GET", "/steady_state?"+query, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	request.Header.Set("Accept", accept)
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	peakMB := measurePeakHeap(b, func() {
+		handler.ServeHTTP(&discardResponse{header: http.Header{}}, request)
+	})
+	b.Logf("peak heap: %.1f MB", peakMB)
+	if peakMB > peakHeapBudgetMB {
+		b.Errorf("peak heap of %.1f MB is over the budget of %d MB", peakMB, peakHeapBudgetMB)
+	}
+}
+
+const maxSizeQuery = "NumHosts=1000&NumApps=65534&MeanInstancesPerApp=100&Seed=1"
+
+// BenchmarkSteadyStateMaxSizeMaterialized encodes a response that is
+// materialized all at once, as the handler did before it streamed, to
+// compare the streaming benchmarks with.
+func BenchmarkSteadyStateMaxSizeMaterialized(b *testing.B) {
+	simulator := &simulate.SteadyState{
+		AppSizeDistribution: &distributions.GeometricWithPositiveSupport{},
+	}
+	req := models.SteadyStateRequest{NumHosts: 1000, NumApps: 65534, MeanInstancesPerApp: 100, MeanPoliciesPerApp: 10, Seed: 1}
+
+	peakMB := measurePeakHeap(b, func() {
+		resp, err := simulator.Execute(context.Background(), lager.NewLogger("benchmark"), req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := json.NewEncoder(ioutil.Discard).Encode(resp); err != nil {
+			b.Fatal(err)
+		}
+	})
+	b.Logf("peak heap: %.1f MB", peakMB)
+}
+
+func BenchmarkSteadyStateMaxSizeJSON(b *testing.B) {
+	benchmarkSteadyState(b, "application/json", maxSizeQuery)
+}
+
+func BenchmarkSteadyStateMaxSizeJSONWithIPs(b *testing.B) {
+	benchmarkSteadyState(b, "application/json", maxSizeQuery+"&OverlayCIDR=10.0.0.0/8&HostSubnetPrefixLength=18")
+}
+
+func BenchmarkSteadyStateMaxSizeJSONWithPolicies(b *testing.B) {
+	benchmarkSteadyState(b, "application/json", maxSizeQuery+"&MeanPoliciesPerApp=10")
+}
+
+func BenchmarkSteadyStateMaxSizeCSV(b *testing.B) {
+	benchmarkSteadyState(b, "text/csv", maxSizeQuery)
+}
+
+func BenchmarkSteadyStateMaxSizeNDJSON(b *testing.B) {
+	benchmarkSteadyState(b, "application/x-ndjson", maxSizeQuery)
+}
@@ -1,16 +1,21 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/dghubble/sling"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"github.com/rosenhouse/cnsim/admission"
 	"github.com/rosenhouse/cnsim/fakes"
 	"github.com/rosenhouse/cnsim/handlers"
 	"github.com/rosenhouse/cnsim/models"
@@ -44,17 +49,21 @@ var _ = Describe("Steady State Handler", func() {
 			NumHosts:            123,
 			NumApps:             456,
 			MeanInstancesPerApp: 789,
+			Seed:                1011,
+			PlacementStrategy:   "spread",
+			MeanPoliciesPerApp:  1.5,
+			PolicyFanInSkew:     0.25,
 		}
 
 		var err error
 		request, err = apiClient.New().Get("steady_state").QueryStruct(reqData).Request()
 		Expect(err).NotTo(HaveOccurred())
 
-		simulator.ExecuteReturns(&models.SteadyStateResponse{
+		simulator.StreamStub = streams(&models.SteadyStateResponse{
 			Request: reqData,
 
 			MeanInstancesPerHost: 3.14159,
-		}, nil)
+		})
 	})
 
 	It("unmarshals the request query data and validates it", func() {
@@ -67,8 +76,9 @@ var _ = Describe("Steady State Handler", func() {
 	It("passes the data to the steady state simulator", func() {
 		handler.ServeHTTP(response, request)
 
-		Expect(simulator.ExecuteCallCount()).To(Equal(1))
-		l, r := simulator.ExecuteArgsForCall(0)
+		Expect(simulator.StreamCallCount()).To(Equal(1))
+		ctx, l, r, _ := simulator.StreamArgsForCall(0)
+		Expect(ctx).To(Equal(request.Context()))
 		Expect(l.SessionName()).To(Equal("test.steady-state.execute"))
 		Expect(r).To(Equal(reqData))
 	})
@@ -84,6 +94,32 @@ var _ = Describe("Steady State Handler", func() {
 		Expect(respData.MeanInstancesPerHost).To(Equal(3.14159))
 	})
 
+	Context("when there is a stage observer", func() {
+		var stages *fakes.StageObserver
+
+		BeforeEach(func() {
+			stages = &fakes.StageObserver{}
+			handler.Stages = stages
+		})
+
+		It("times decoding, validating and streaming", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(stages.StageFinishedCallCount()).To(Equal(3))
+			for i, expected := range []string{"decode", "validate", "stream"} {
+				stage, _ := stages.StageFinishedArgsForCall(i)
+				Expect(stage).To(Equal(expected))
+			}
+		})
+
+		It("stops timing at the stage that fails", func() {
+			simulator.ValidateReturns(errors.New("banana"))
+			handler.ServeHTTP(response, request)
+
+			Expect(stages.StageFinishedCallCount()).To(Equal(1))
+		})
+	})
+
 	Context("when parsing the form data fails", func() {
 		BeforeEach(func() {
 			request.URL.RawQuery = "%%%"
@@ -141,12 +177,131 @@ var _ = Describe("Steady State Handler", func() {
 			var err models.APIError
 			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
 			Expect(err.Error).To(ContainSubstring("validation: banana"))
+			Expect(err.Code).To(Equal("validation"))
+		})
+	})
+
+	Context("when validation reports invalid fields", func() {
+		BeforeEach(func() {
+			min, max := 1.0, 1000.0
+			simulator.ValidateReturns(models.ValidationError{
+				{Field: "NumHosts", Constraint: "range", Min: &min, Max: &max, Got: 0, Message: "NumHosts must be 1 - 1000"},
+				{Field: "PlacementStrategy", Constraint: "one-of", Got: "banana", Message: "PlacementStrategy must be one of: random"},
+			})
+			handler.ServeHTTP(response, request)
+		})
+
+		It("lists every field in the error", func() {
+			Expect(response.Code).To(Equal(400))
+
+			var err models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &err)).To(Succeed())
+			Expect(err.Code).To(Equal("validation"))
+			Expect(err.Error).To(Equal("validation: NumHosts must be 1 - 1000; PlacementStrategy must be one of: random"))
+			Expect(err.Fields).To(HaveLen(2))
+			Expect(err.Fields[0].Field).To(Equal("NumHosts"))
+			Expect(err.Fields[0].Constraint).To(Equal("range"))
+			Expect(*err.Fields[0].Min).To(Equal(1.0))
+			Expect(*err.Fields[0].Max).To(Equal(1000.0))
+			Expect(err.Fields[0].Got).To(Equal(0.0))
+			Expect(err.Fields[1].Got).To(Equal("banana"))
+			Expect(err.Fields[1].Min).To(BeNil())
+		})
+	})
+
+	Context("when there is an admission controller", func() {
+		var (
+			admitter *fakes.Admitter
+			released int
+		)
+
+		BeforeEach(func() {
+			released = 0
+			admitter = &fakes.Admitter{}
+			admitter.AdmitReturns(func() { released++ }, nil)
+			admitter.RetryAfterReturns(1500 * time.Millisecond)
+			simulator.CostReturns(4242)
+			handler.Admission = admitter
+		})
+
+		It("admits the estimated cost of the validated request", func() {
+			handler.ServeHTTP(response, request)
+
+			Expect(simulator.CostArgsForCall(0)).To(Equal(reqData))
+			Expect(admitter.AdmitArgsForCall(0)).To(Equal(int64(4242)))
+			Expect(simulator.StreamCallCount()).To(Equal(1))
+			Expect(response.Code).To(Equal(200))
+		})
+
+		It("releases the cost once the response is written", func() {
+			simulator.StreamStub = func(context.Context, lager.Logger, models.SteadyStateRequest, models.SteadyStateWriter) error {
+				Expect(released).To(Equal(0))
+				return nil
+			}
+			handler.ServeHTTP(response, request)
+
+			Expect(released).To(Equal(1))
+		})
+
+		It("does not admit requests that fail validation", func() {
+			simulator.ValidateReturns(errors.New("banana"))
+			handler.ServeHTTP(response, request)
+
+			Expect(admitter.AdmitCallCount()).To(Equal(0))
+		})
+
+		Context("when the budget is spent", func() {
+			BeforeEach(func() {
+				admitter.AdmitReturns(nil, errors.New("estimated cost 4242 exceeds the 1 left of the budget of 10"))
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 429 without simulating", func() {
+				Expect(simulator.StreamCallCount()).To(Equal(0))
+				Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+
+				var apiError models.APIError
+				Expect(json.Unmarshal(response.Body.Bytes(), &apiError)).To(Succeed())
+				Expect(apiError).To(Equal(models.APIError{
+					Code:  "admission",
+					Error: "admission: estimated cost 4242 exceeds the 1 left of the budget of 10",
+				}))
+			})
+
+			It("says when to retry, in whole seconds", func() {
+				Expect(response.Header().Get("Retry-After")).To(Equal("2"))
+			})
+
+			It("logs the rejection", func() {
+				Expect(logger.Buffer()).To(gbytes.Say(`admission.*4242`))
+			})
+		})
+
+		Context("when the request costs more than the whole budget", func() {
+			BeforeEach(func() {
+				admitter.AdmitReturns(nil, admission.TooLargeError{Cost: 4242, Budget: 10})
+				handler.ServeHTTP(response, request)
+			})
+
+			It("responds with a 413 without simulating", func() {
+				Expect(simulator.StreamCallCount()).To(Equal(0))
+				Expect(response.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				Expect(response.Header().Get("Retry-After")).To(BeEmpty())
+
+				var apiError models.APIError
+				Expect(json.Unmarshal(response.Body.Bytes(), &apiError)).To(Succeed())
+				Expect(apiError).To(Equal(models.APIError{
+					Code:  "admission",
+					Error: "admission: estimated cost 4242 exceeds the whole budget of 10",
+				}))
+			})
 		})
 	})
 
 	Context("when the simulator errors", func() {
 		BeforeEach(func() {
-			simulator.ExecuteReturns(nil, errors.New("banana"))
+			simulator.StreamReturns(errors.New("banana"))
 			handler.ServeHTTP(response, request)
 		})
 
@@ -164,6 +319,136 @@ var _ = Describe("Steady State Handler", func() {
 		})
 	})
 
+	Context("when writing the response fails after it has started", func() {
+		BeforeEach(func() {
+			simulator.StreamStub = func(_ context.Context, _ lager.Logger, _ models.SteadyStateRequest, out models.SteadyStateWriter) error {
+				Expect(out.WriteSummary(&models.SteadyStateResponse{})).To(Succeed())
+				return errors.New("broken pipe")
+			}
+			handler.ServeHTTP(response, request)
+		})
+
+		It("logs the error without trying to respond with it", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`encode.*broken pipe`))
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).NotTo(ContainSubstring("broken pipe"))
+		})
+	})
+
+	Context("when the client goes away during the simulation", func() {
+		BeforeEach(func() {
+			ctx, cancel := context.WithCancel(request.Context())
+			request = request.WithContext(ctx)
+			simulator.StreamStub = func(ctx context.Context, _ lager.Logger, _ models.SteadyStateRequest, _ models.SteadyStateWriter) error {
+				cancel()
+				return ctx.Err()
+			}
+			handler.ServeHTTP(response, request)
+		})
+
+		It("logs that the client cancelled rather than responding with an error", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`client-cancelled.*context canceled`))
+			Expect(logger.Buffer()).NotTo(gbytes.Say(`simulator`))
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).To(BeEmpty())
+		})
+	})
+
+	Context("when the request is POSTed as JSON", func() {
+		var post = func(body string) {
+			var err error
+			request, err = http.NewRequest("POST", "http://localhost/steady_state", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("Content-Type", "application/json; charset=utf-8")
+			handler.ServeHTTP(response, request)
+		}
+
+		var expectAPIError = func(code int) models.APIError {
+			Expect(response.Code).To(Equal(code))
+			Expect(simulator.StreamCallCount()).To(Equal(0))
+
+			var apiErr models.APIError
+			Expect(json.Unmarshal(response.Body.Bytes(), &apiErr)).To(Succeed())
+			return apiErr
+		}
+
+		It("decodes nested structures from the body and validates them like a query", func() {
+			post(`{
+				"NumHosts": 123,
+				"NumApps": 456,
+				"MeanInstancesPerApp": 789,
+				"HostClasses": [{"Name": "small", "Count": 100, "Slots": 50}, {"Count": 23, "Slots": 200, "MemoryMB": 65536}]
+			}`)
+
+			expected := models.SteadyStateRequest{
+				NumHosts:            123,
+				NumApps:             456,
+				MeanInstancesPerApp: 789,
+				HostClasses: []models.HostClass{
+					{Name: "small", Count: 100, Slots: 50},
+					{Count: 23, Slots: 200, MemoryMB: 65536},
+				},
+			}
+			Expect(simulator.ValidateCallCount()).To(Equal(1))
+			Expect(simulator.ValidateArgsForCall(0)).To(Equal(expected))
+
+			Expect(simulator.StreamCallCount()).To(Equal(1))
+			_, _, r, _ := simulator.StreamArgsForCall(0)
+			Expect(r).To(Equal(expected))
+			Expect(response.Code).To(Equal(200))
+		})
+
+		It("rejects unknown fields, pointing at them", func() {
+			post(`{"NumHosts": 10, "HostClasses": [{"Count": 1, "Slots": 1}, {"Count": 1, "Slotz": 1}]}`)
+
+			apiErr := expectAPIError(400)
+			Expect(apiErr.Error).To(Equal(`decode: json: unknown field "Slotz"`))
+			Expect(apiErr.Path).To(Equal("HostClasses[1].Slotz"))
+			Expect(simulator.ValidateCallCount()).To(Equal(0))
+		})
+
+		It("rejects values of the wrong type, pointing at them", func() {
+			post(`{"NumHosts": 10, "HostClasses": [{"Count": 1.5, "Slots": 1}]}`)
+
+			apiErr := expectAPIError(400)
+			Expect(apiErr.Error).To(HavePrefix("decode: json: cannot unmarshal number 1.5"))
+			Expect(apiErr.Path).To(Equal("HostClasses[0].Count"))
+		})
+
+		It("rejects malformed JSON", func() {
+			post(`{"NumHosts": 10`)
+
+			apiErr := expectAPIError(400)
+			Expect(apiErr.Error).To(Equal("decode: unexpected EOF"))
+			Expect(apiErr.Path).To(BeEmpty())
+		})
+
+		It("rejects anything after the request", func() {
+			post(`{"NumHosts": 10} {"NumHosts": 20}`)
+
+			apiErr := expectAPIError(400)
+			Expect(apiErr.Error).To(Equal("decode: unexpected data after the request"))
+		})
+
+		It("requires a JSON content type", func() {
+			var err error
+			request, err = http.NewRequest("POST", "http://localhost/steady_state", strings.NewReader(`{}`))
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			handler.ServeHTTP(response, request)
+
+			apiErr := expectAPIError(415)
+			Expect(apiErr.Error).To(Equal("Content-Type must be application/json"))
+		})
+
+		It("limits the size of the body", func() {
+			post(`{"PlacementStrategy": "` + strings.Repeat("x", 1<<20) + `"}`)
+
+			apiErr := expectAPIError(400)
+			Expect(apiErr.Error).To(HavePrefix("read-body: "))
+		})
+	})
+
 	Context("when writing the json response fails", func() {
 		BeforeEach(func() {
 			resp := &fakes.ResponseWriter{}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rosenhouse/cnsim/models"
+
+	"code.cloudfoundry.org/lager"
+)
+
+//go:generate counterfeiter -o ../fakes/sweep_simulator.go --fake-name SweepSimulator . sweepSimulator
+type sweepSimulator interface {
+	Execute(ctx context.Context, logger lager.Logger, req models.SweepRequest) (*models.SweepResponse, error)
+	Validate(req models.SweepRequest) error
+	Cost(req models.SweepRequest) int64
+}
+
+type Sweep struct {
+	Logger    lager.Logger
+	Simulator sweepSimulator
+	Admission admitter // optional
+}
+
+func (h *Sweep) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqData := models.SweepRequest{}
+	serveSimulation(h.Logger.Session("sweep"), w, r, h.Admission, &reqData, simulation{
+		validate: func() error { return h.Simulator.Validate(reqData) },
+		cost:     func() int64 { return h.Simulator.Cost(reqData) },
+		execute: func(ctx context.Context, logger lager.Logger) (interface{}, error) {
+			return h.Simulator.Execute(ctx, logger, reqData)
+		},
+	})
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dghubble/sling"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("Sweep Handler", func() {
+	var (
+		logger    *lagertest.TestLogger
+		simulator *fakes.SweepSimulator
+		handler   handlers.Sweep
+
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		reqData  models.SweepRequest
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		simulator = &fakes.SweepSimulator{}
+		handler = handlers.Sweep{
+			Logger:    logger,
+			Simulator: simulator,
+		}
+
+		response = httptest.NewRecorder()
+
+		reqData = models.SweepRequest{
+			SteadyStateRequest: models.SteadyStateRequest{
+				NumHosts:            123,
+				NumApps:             456,
+				MeanInstancesPerApp: 7,
+				Seed:                1011,
+			},
+			Parameter: "NumHosts",
+			From:      10,
+			To:        100,
+			Step:      10,
+		}
+
+		var err error
+		apiClient := sling.New().Base("http://localhost/").Client(http.DefaultClient)
+		request, err = apiClient.New().Get("steady_state/sweep").QueryStruct(reqData).Request()
+		Expect(err).NotTo(HaveOccurred())
+
+		simulator.ExecuteReturns(&models.SweepResponse{
+			Request: reqData,
+			Points: []models.SweepPoint{
+				{Value: 10, Metrics: map[string]float64{"TotalInstances": 3192}},
+			},
+		}, nil)
+	})
+
+	It("decodes the flattened query into the sweep request and validates it", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(simulator.ValidateCallCount()).To(Equal(1))
+		Expect(simulator.ValidateArgsForCall(0)).To(Equal(reqData))
+		Expect(simulator.CostArgsForCall(0)).To(Equal(reqData))
+
+		Expect(simulator.ExecuteCallCount()).To(Equal(1))
+		ctx, l, r := simulator.ExecuteArgsForCall(0)
+		Expect(ctx).To(Equal(request.Context()))
+		Expect(l.SessionName()).To(Equal("test.sweep.execute"))
+		Expect(r).To(Equal(reqData))
+	})
+
+	It("marshals the simulator response to JSON", func() {
+		handler.ServeHTTP(response, request)
+
+		Expect(response.Code).To(Equal(200))
+		Expect(response.HeaderMap.Get("Content-Type")).To(Equal("application/json"))
+
+		var respData models.SweepResponse
+		Expect(json.Unmarshal(response.Body.Bytes(), &respData)).To(Succeed())
+		Expect(respData.Points[0].Metrics["TotalInstances"]).To(Equal(3192.0))
+	})
+})
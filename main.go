@@ -2,70 +2,51 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
 
-	"code.cloudfoundry.org/lager"
-
-	"github.com/NYTimes/gziphandler"
 	"github.com/rosenhouse/cnsim/distributions"
-	"github.com/rosenhouse/cnsim/handlers"
 	"github.com/rosenhouse/cnsim/simulate"
-	"github.com/tedsuo/ifrit"
-	"github.com/tedsuo/ifrit/grouper"
-	"github.com/tedsuo/ifrit/http_server"
-	"github.com/tedsuo/ifrit/sigmon"
-	"github.com/tedsuo/rata"
 )
 
-func getEnv(logger lager.Logger, name, defaultValue string) string {
-	value := os.Getenv(name)
-	if value == "" {
-		value = defaultValue
-		logger.Info("missing-env-var", lager.Data{"name": name, "default-to": value})
-	} else {
-		logger.Info("read-env-var", lager.Data{"name": name, "value": value})
-	}
-	return value
-}
+const usage = `usage: cnsim [command]
 
-func main() {
-	logger := lager.NewLogger("cnsim-server")
-	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
+commands:
+  serve     run the HTTP server, configured by the environment (the default)
+  simulate  run a steady-state simulation and write its result; see
+            cnsim simulate -help
+`
 
-	port := getEnv(logger, "PORT", "9000")
-	listenAddress := getEnv(logger, "LISTEN_ADDRESS", "127.0.0.1")
-
-	address := fmt.Sprintf("%s:%s", listenAddress, port)
-	logger.Info("listen", lager.Data{"address": address})
-
-	routes := rata.Routes{
-		{Name: "root", Method: "GET", Path: "/"},
-		{Name: "steady_state", Method: "GET", Path: "/steady_state"},
-	}
-
-	rataHandlers := rata.Handlers{
-		"root": &handlers.Root{
-			Logger: logger,
-		},
-		"steady_state": gziphandler.GzipHandler(&handlers.SteadyState{
-			Logger: logger,
-			Simulator: &simulate.SteadyState{
-				AppSizeDistribution: &distributions.GeometricWithPositiveSupport{},
-			},
-		}),
+func main() {
+	if len(os.Args) < 2 {
+		serve()
+		return
 	}
-
-	router, err := rata.NewRouter(routes, rataHandlers)
-	if err != nil {
-		log.Fatalf("unable to create rata Router: %s", err) // not tested
+	switch os.Args[1] {
+	case "serve":
+		serve()
+	case "simulate":
+		os.Exit(simulateCommand(os.Args[2:], os.Stdout, os.Stderr))
+	case "help", "-help", "--help", "-h":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
 	}
+}
 
-	monitor := ifrit.Invoke(sigmon.New(grouper.NewOrdered(os.Interrupt, grouper.Members{
-		{"http_server", http_server.New(address, router)},
-	})))
-	err = <-monitor.Wait()
-	if err != nil {
-		log.Fatalf("ifrit: %s", err)
+// newSteadyState returns the simulator that both the server and the command
+// line use, with every app size distribution that requests may name.
+func newSteadyState() *simulate.SteadyState {
+	geometric := &distributions.GeometricWithPositiveSupport{}
+	return &simulate.SteadyState{
+		AppSizeDistribution: geometric,
+		AppSizeDistributions: simulate.NamedDistributions{
+			"geometric": geometric,
+			"poisson":   &distributions.PoissonWithPositiveSupport{},
+			"zipf":      &distributions.Zipf{},
+			"lognormal": &distributions.LogNormal{},
+			"pareto":    &distributions.ParetoWithCap{},
+		},
+		AppMemoryDistribution: &distributions.RoundedLogNormal{Cap: 65536},
 	}
 }
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusClientClosedRequest is recorded, as nginx logs it, for requests
+// whose client went away before the handler returned.
+const statusClientClosedRequest = 499
+
+// Requests counts and times HTTP requests by route and status.
+type Requests struct {
+	counts    *Counter
+	durations *Histogram
+}
+
+func NewRequests(r *Registry) *Requests {
+	return &Requests{
+		counts: r.NewCounter("cnsim_http_requests_total",
+			"Number of HTTP requests, by route and status code.",
+			"route", "code"),
+		durations: r.NewHistogram("cnsim_http_request_duration_seconds",
+			"Time taken to respond to HTTP requests, by route.",
+			ExponentialBuckets(0.001, 4, 10), "route"),
+	}
+}
+
+// Instrument records each request that handler serves under the route name.
+func (q *Requests) Instrument(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r)
+
+		code := recorder.code
+		switch {
+		case r.Context().Err() != nil:
+			code = statusClientClosedRequest
+		case code == 0:
+			code = http.StatusOK
+		}
+		q.counts.Inc(route, strconv.Itoa(code))
+		q.durations.Observe(time.Since(started).Seconds(), route)
+	})
+}
+
+// statusRecorder notes the status code written, if any.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
@@ -0,0 +1,83 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/metrics"
+)
+
+var _ = Describe("Requests", func() {
+	var (
+		registry *metrics.Registry
+		requests *metrics.Requests
+		request  *http.Request
+		response *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		registry = &metrics.Registry{}
+		requests = metrics.NewRequests(registry)
+		response = httptest.NewRecorder()
+
+		var err error
+		request, err = http.NewRequest("GET", "http://localhost/steady_state", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	exposition := func() string {
+		var out bytes.Buffer
+		_, err := registry.WriteTo(&out)
+		Expect(err).NotTo(HaveOccurred())
+		return out.String()
+	}
+
+	serve := func(handler http.HandlerFunc) {
+		requests.Instrument("steady_state", handler).ServeHTTP(response, request)
+	}
+
+	It("passes the request through to the handler", func() {
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r).To(Equal(request))
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("banana"))
+		})
+
+		Expect(response.Code).To(Equal(http.StatusTeapot))
+		Expect(response.Body.String()).To(Equal("banana"))
+	})
+
+	It("counts requests by route and the status written", func() {
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		})
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		})
+
+		Expect(exposition()).To(ContainSubstring(`cnsim_http_requests_total{route="steady_state",code="400"} 2`))
+		Expect(exposition()).To(ContainSubstring(`cnsim_http_request_duration_seconds_count{route="steady_state"} 2`))
+	})
+
+	It("counts a 200 when the handler only writes the body", func() {
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("banana"))
+		})
+
+		Expect(exposition()).To(ContainSubstring(`cnsim_http_requests_total{route="steady_state",code="200"} 1`))
+	})
+
+	It("counts a 499 when the client went away", func() {
+		ctx, cancel := context.WithCancel(request.Context())
+		request = request.WithContext(ctx)
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+		})
+
+		Expect(exposition()).To(ContainSubstring(`cnsim_http_requests_total{route="steady_state",code="499"} 1`))
+	})
+})
@@ -0,0 +1,292 @@
+// Package metrics keeps counters, gauges and histograms and serves them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector writes one or more metric families.
+type collector interface {
+	collect(w *bufio.Writer)
+}
+
+// Registry holds the metrics that it serves, in the order they were added.
+type Registry struct {
+	lock       sync.Mutex
+	collectors []collector
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.WriteTo(w)
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.lock.Unlock()
+
+	counting := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counting)
+	for _, c := range collectors {
+		c.collect(buffered)
+	}
+	err := buffered.Flush()
+	return counting.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// family is a metric with a value, or a histogram, for each combination of
+// label values seen so far.
+type family struct {
+	name, help, kind string
+	labelNames       []string
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 // histograms only, not cumulative
+	count       uint64
+}
+
+func newFamily(name, help, kind string, labelNames []string) *family {
+	return &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+// with returns the series for the label values, which must be called with
+// lock held.
+func (f *family) with(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s has labels %v, not %d values", f.name, f.labelNames, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) collect(w *bufio.Writer, sample func(w *bufio.Writer, s *series)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample(w, f.series[key])
+	}
+}
+
+// writeSample writes a line with the labels of the series, followed by any
+// extra label.
+func (f *family) writeSample(w *bufio.Writer, suffix string, s *series, extraName, extraValue string, value float64) {
+	w.WriteString(f.name)
+	w.WriteString(suffix)
+	names, values := f.labelNames, s.labelValues
+	if extraName != "" {
+		names = append(append([]string(nil), names...), extraName)
+		values = append(append([]string(nil), values...), extraValue)
+	}
+	if len(names) > 0 {
+		w.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, name, escapeLabelValue(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// Counter is a value, for each combination of label values, that only goes
+// up.
+type Counter struct {
+	family *family
+}
+
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, "counter", labelNames)}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add panics if delta is negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.family.name))
+	}
+	c.family.lock.Lock()
+	defer c.family.lock.Unlock()
+	c.family.with(labelValues).value += delta
+}
+
+func (c *Counter) collect(w *bufio.Writer) {
+	c.family.collect(w, func(w *bufio.Writer, s *series) {
+		c.family.writeSample(w, "", s, "", "", s.value)
+	})
+}
+
+// Gauge is a value, for each combination of label values, that can go up
+// and down.
+type Gauge struct {
+	family *family
+}
+
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{family: newFamily(name, help, "gauge", labelNames)}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.lock.Lock()
+	defer g.family.lock.Unlock()
+	g.family.with(labelValues).value = value
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.family.lock.Lock()
+	defer g.family.lock.Unlock()
+	g.family.with(labelValues).value += delta
+}
+
+func (g *Gauge) collect(w *bufio.Writer) {
+	g.family.collect(w, func(w *bufio.Writer, s *series) {
+		g.family.writeSample(w, "", s, "", "", s.value)
+	})
+}
+
+// Histogram counts observations, for each combination of label values, in
+// buckets with the given upper bounds.
+type Histogram struct {
+	family  *family
+	buckets []float64
+}
+
+// NewHistogram panics unless the buckets are increasing.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			panic(fmt.Sprintf("histogram %s buckets must be increasing", name))
+		}
+	}
+	h := &Histogram{family: newFamily(name, help, "histogram", labelNames), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.family.lock.Lock()
+	defer h.family.lock.Unlock()
+	s := h.family.with(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.buckets[i]++
+	}
+	s.value += value
+	s.count++
+}
+
+func (h *Histogram) collect(w *bufio.Writer) {
+	h.family.collect(w, func(w *bufio.Writer, s *series) {
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += s.buckets[i]
+			h.family.writeSample(w, "_bucket", s, "le", formatFloat(bound), float64(cumulative))
+		}
+		h.family.writeSample(w, "_bucket", s, "le", "+Inf", float64(s.count))
+		h.family.writeSample(w, "_sum", s, "", "", s.value)
+		h.family.writeSample(w, "_count", s, "", "", float64(s.count))
+	})
+}
+
+// ExponentialBuckets returns count bounds, starting at start and each factor
+// times the last.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,123 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/metrics"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *metrics.Registry
+
+	BeforeEach(func() {
+		registry = &metrics.Registry{}
+	})
+
+	exposition := func() string {
+		var out bytes.Buffer
+		_, err := registry.WriteTo(&out)
+		Expect(err).NotTo(HaveOccurred())
+		return out.String()
+	}
+
+	It("writes counters, sorted by label values", func() {
+		counter := registry.NewCounter("requests_total", "Number of requests.", "route", "code")
+		counter.Inc("b", "200")
+		counter.Add(2, "a", "500")
+		counter.Inc("b", "200")
+
+		Expect(exposition()).To(Equal(`# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="a",code="500"} 2
+requests_total{route="b",code="200"} 2
+`))
+	})
+
+	It("writes gauges, which go up and down", func() {
+		gauge := registry.NewGauge("in_flight", "Number in flight.")
+		gauge.Set(3)
+		gauge.Add(-1.5)
+
+		Expect(exposition()).To(Equal(`# HELP in_flight Number in flight.
+# TYPE in_flight gauge
+in_flight 1.5
+`))
+	})
+
+	It("writes histograms with cumulative buckets", func() {
+		histogram := registry.NewHistogram("duration_seconds", "Time taken.", []float64{0.1, 1}, "stage")
+		histogram.Observe(0.05, "apps")
+		histogram.Observe(0.1, "apps")
+		histogram.Observe(0.5, "apps")
+		histogram.Observe(5, "apps")
+
+		Expect(exposition()).To(Equal(`# HELP duration_seconds Time taken.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{stage="apps",le="0.1"} 2
+duration_seconds_bucket{stage="apps",le="1"} 3
+duration_seconds_bucket{stage="apps",le="+Inf"} 4
+duration_seconds_sum{stage="apps"} 5.65
+duration_seconds_count{stage="apps"} 4
+`))
+	})
+
+	It("writes metrics in the order they were added", func() {
+		registry.NewGauge("b", "B.").Set(1)
+		registry.NewGauge("a", "A.").Set(1)
+
+		Expect(exposition()).To(MatchRegexp(`(?s)# HELP b .*# HELP a `))
+	})
+
+	It("escapes help and label values", func() {
+		counter := registry.NewCounter("c", "back\\slash\nnewline", "l")
+		counter.Inc("\"quoted\"\n")
+
+		Expect(exposition()).To(ContainSubstring(`# HELP c back\\slash\nnewline`))
+		Expect(exposition()).To(ContainSubstring(`c{l="\"quoted\"\n"} 1`))
+	})
+
+	It("panics when given the wrong number of label values", func() {
+		counter := registry.NewCounter("c", "C.", "l")
+		Expect(func() { counter.Inc() }).To(Panic())
+	})
+
+	It("panics when a counter would go down", func() {
+		counter := registry.NewCounter("c", "C.")
+		Expect(func() { counter.Add(-1) }).To(Panic())
+	})
+
+	It("panics unless histogram buckets increase", func() {
+		Expect(func() { registry.NewHistogram("h", "H.", []float64{1, 1}) }).To(Panic())
+	})
+
+	It("adds Go runtime statistics on request", func() {
+		registry.RegisterRuntime()
+
+		Expect(exposition()).To(ContainSubstring("# TYPE go_goroutines gauge\ngo_goroutines "))
+		Expect(exposition()).To(MatchRegexp(`go_info{version="go[^"]*"} 1`))
+		Expect(exposition()).To(MatchRegexp(`\ngo_memstats_heap_inuse_bytes [0-9.e+]+\n`))
+	})
+
+	It("serves the metrics over HTTP", func() {
+		registry.NewGauge("in_flight", "Number in flight.").Set(1)
+
+		response := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "http://localhost/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+		registry.ServeHTTP(response, request)
+
+		Expect(response.Code).To(Equal(200))
+		Expect(response.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(response.Body.String()).To(Equal(exposition()))
+	})
+
+	Describe("ExponentialBuckets", func() {
+		It("multiplies each bound by the factor", func() {
+			Expect(metrics.ExponentialBuckets(0.5, 4, 3)).To(Equal([]float64{0.5, 2, 8}))
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+)
+
+// runtimeCollector reads the Go runtime statistics on every scrape.
+type runtimeCollector struct{}
+
+// RegisterRuntime adds goroutine, memory and garbage collection statistics
+// to the registry.
+func (r *Registry) RegisterRuntime() {
+	r.register(runtimeCollector{})
+}
+
+func (runtimeCollector) collect(w *bufio.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	write := func(name, kind, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatFloat(value))
+	}
+	fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info{version=\"%s\"} 1\n", escapeLabelValue(runtime.Version()))
+	write("go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	write("go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", float64(stats.Alloc))
+	write("go_memstats_alloc_bytes_total", "counter", "Total number of bytes allocated, even if freed.", float64(stats.TotalAlloc))
+	write("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", float64(stats.Sys))
+	write("go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", float64(stats.HeapInuse))
+	write("go_memstats_heap_objects", "gauge", "Number of allocated objects.", float64(stats.HeapObjects))
+	write("go_memstats_mallocs_total", "counter", "Total number of mallocs.", float64(stats.Mallocs))
+	write("go_memstats_frees_total", "counter", "Total number of frees.", float64(stats.Frees))
+	write("go_memstats_next_gc_bytes", "gauge", "Number of heap bytes when next garbage collection will take place.", float64(stats.NextGC))
+	write("go_memstats_last_gc_time_seconds", "gauge", "Number of seconds since 1970 of last garbage collection.", float64(stats.LastGC)/1e9)
+	write("go_gc_cycles_total", "counter", "Number of completed garbage collection cycles.", float64(stats.NumGC))
+	write("go_gc_pause_seconds_total", "counter", "Total time that garbage collection has stopped the world.", float64(stats.PauseTotalNs)/1e9)
+}
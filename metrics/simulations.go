@@ -0,0 +1,55 @@
+package metrics
+
+import "time"
+
+// Stages times the stages of some piece of work, by stage.
+type Stages struct {
+	durations *Histogram
+}
+
+func NewStages(r *Registry, name, help string) *Stages {
+	return &Stages{durations: r.NewHistogram(name, help, ExponentialBuckets(0.0001, 4, 10), "stage")}
+}
+
+func (s *Stages) StageFinished(stage string, duration time.Duration) {
+	s.durations.Observe(duration.Seconds(), stage)
+}
+
+// Simulations records the steady-state simulations in flight, how long each
+// took and how many instances it placed, by outcome, and how long each of
+// their stages took.
+type Simulations struct {
+	*Stages
+	inFlight  *Gauge
+	durations *Histogram
+	instances *Histogram
+}
+
+func NewSimulations(r *Registry) *Simulations {
+	inFlight := r.NewGauge("cnsim_simulations_in_flight",
+		"Number of steady-state simulations running.")
+	inFlight.Set(0)
+	return &Simulations{
+		Stages: NewStages(r, "cnsim_simulation_stage_duration_seconds",
+			"Time taken by each stage of steady-state simulations."),
+		inFlight: inFlight,
+		durations: r.NewHistogram("cnsim_simulation_duration_seconds",
+			"Time taken by steady-state simulations, by outcome.",
+			ExponentialBuckets(0.001, 4, 10), "outcome"),
+		instances: r.NewHistogram("cnsim_simulated_instances",
+			"Number of instances placed by each successful steady-state simulation.",
+			ExponentialBuckets(10, 10, 7)),
+	}
+}
+
+func (s *Simulations) Started() {
+	s.inFlight.Add(1)
+}
+
+func (s *Simulations) Finished(outcome string, duration time.Duration, instances int) {
+	s.inFlight.Add(-1)
+	s.durations.Observe(duration.Seconds(), outcome)
+	if outcome == "success" {
+		s.instances.Observe(float64(instances))
+	}
+}
@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/metrics"
+)
+
+var _ = Describe("Simulations", func() {
+	var (
+		registry    *metrics.Registry
+		simulations *metrics.Simulations
+	)
+
+	BeforeEach(func() {
+		registry = &metrics.Registry{}
+		simulations = metrics.NewSimulations(registry)
+	})
+
+	exposition := func() string {
+		var out bytes.Buffer
+		_, err := registry.WriteTo(&out)
+		Expect(err).NotTo(HaveOccurred())
+		return out.String()
+	}
+
+	It("reports no simulations in flight before any start", func() {
+		Expect(exposition()).To(ContainSubstring("\ncnsim_simulations_in_flight 0\n"))
+	})
+
+	It("counts the simulations in flight", func() {
+		simulations.Started()
+		simulations.Started()
+		simulations.Finished("success", time.Second, 10)
+
+		Expect(exposition()).To(ContainSubstring("\ncnsim_simulations_in_flight 1\n"))
+	})
+
+	It("times simulations by outcome", func() {
+		simulations.Started()
+		simulations.Finished("success", 2*time.Second, 10)
+		simulations.Started()
+		simulations.Finished("cancelled", time.Second, 0)
+
+		Expect(exposition()).To(ContainSubstring(`cnsim_simulation_duration_seconds_sum{outcome="success"} 2`))
+		Expect(exposition()).To(ContainSubstring(`cnsim_simulation_duration_seconds_count{outcome="cancelled"} 1`))
+	})
+
+	It("counts the instances placed by successful simulations only", func() {
+		simulations.Started()
+		simulations.Finished("success", time.Second, 500)
+		simulations.Started()
+		simulations.Finished("error", time.Second, 0)
+
+		Expect(exposition()).To(ContainSubstring("\ncnsim_simulated_instances_sum 500\n"))
+		Expect(exposition()).To(ContainSubstring("\ncnsim_simulated_instances_count 1\n"))
+	})
+
+	It("times each stage", func() {
+		simulations.StageFinished("placement", 250*time.Millisecond)
+
+		Expect(exposition()).To(ContainSubstring(`cnsim_simulation_stage_duration_seconds_sum{stage="placement"} 0.25`))
+	})
+})
@@ -1,31 +1,381 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 type SteadyStateRequest struct {
-	NumHosts            int
-	NumApps             int
+	NumHosts int
+	NumApps  int
+
+	// MeanInstancesPerApp may be left at 0 when AppSizeDistribution names an
+	// uploaded histogram, which is then sampled as it is.
 	MeanInstancesPerApp int
+	AppSizeDistribution string
+	Seed                int64
+	PlacementStrategy   string
+	MeanPoliciesPerApp  float64
+	PolicyFanInSkew     float64
+
+	// Traffic is weighted by policy volume when a distribution is named.
+	PolicyVolumeDistribution string
+	MeanPolicyVolume         float64
+
+	OverlayCIDR            string
+	HostSubnetPrefixLength int
+
+	FailedHosts        int
+	FailedHostFraction float64
+	HostCapacity       int
+
+	// When HostClasses are given, hosts are numbered in class order and
+	// NumHosts may be left as zero.
+	HostClasses     []HostClass
+	MeanAppMemoryMB int
+
+	// Hosts are assigned to zones in turn.
+	NumZones int
+}
+
+// HostClass is a group of identical hosts. A MemoryMB of zero means that
+// memory is not limited.
+type HostClass struct {
+	Name     string
+	Count    int
+	Slots    int
+	MemoryMB int
 }
 
 type SteadyStateResponse struct {
-	Request SteadyStateRequest
+	Request           SteadyStateRequest
+	Seed              int64
+	PlacementStrategy string
 
 	MeanInstancesPerHost float64
 	TotalInstances       int
+	HostStats            HostStats
+	Network              NetworkStats
+	PolicyStats          PolicyStats
+	Traffic              TrafficStats
+	Capacity             *CapacityStats   `json:",omitempty"`
+	Zones                *ZoneStats       `json:",omitempty"`
+	IPAM                 *IPAMStats       `json:",omitempty"`
+	Evacuation           *EvacuationStats `json:",omitempty"`
 	Apps                 []App
 	Instances            []Instance
+	Policies             []Policy
+}
+
+// SteadyStateWriter receives a steady-state response in pieces, so that its
+// instances need not all be held in memory at once. WriteSummary comes first,
+// with Apps, Instances and Policies left empty, then each app, instance and
+// policy in order, and finally Close.
+type SteadyStateWriter interface {
+	WriteSummary(resp *SteadyStateResponse) error
+	WriteApp(app App) error
+	WriteInstance(instance Instance) error
+	WritePolicy(policy Policy) error
+	Close() error
+}
+
+type HostStats struct {
+	InstancesPerHost    []int
+	DistinctAppsPerHost []int
+
+	Instances    Summary
+	DistinctApps Summary
+}
+
+// NetworkStats compares the kernel table sizes each host needs when every host
+// peers with every other host, against peering only with hosts that run
+// instances of the same apps.
+type NetworkStats struct {
+	FullMesh  OverlayStats
+	PeersOnly OverlayStats
+}
+
+type OverlayStats struct {
+	Routes     Summary
+	FDBEntries Summary
+	ARPEntries Summary
+}
+
+type Summary struct {
+	Min    int
+	Max    int
+	Mean   float64
+	StdDev float64
+	P50    int
+	P90    int
+	P99    int
 }
 
 type App struct {
-	Id   int `json:"-"`
-	Size int `json:"s"`
+	Id       int `json:"-"`
+	Size     int `json:"s"`
+	MemoryMB int `json:"m,omitempty"` // per instance
 }
 
 type Instance struct {
-	Id     int `json:"-"`
-	AppId  int `json:"a"`
-	HostId int `json:"h"`
+	Id     int    `json:"-"`
+	AppId  int    `json:"a"`
+	HostId int    `json:"h"`
+	Zone   int    `json:"z,omitempty"`
+	IP     string `json:"i,omitempty"`
+}
+
+// CapacityStats describes how well the instances fit on hosts of limited
+// capacity. Instances that could not be placed are left out of the response's
+// Instances. A host is full when it has no room for an instance of any app.
+type CapacityStats struct {
+	UnplacedInstances int
+	FullHosts         []int
+	HostClasses       []HostClassStats
+}
+
+type HostClassStats struct {
+	HostClass
+	FirstHostId int
+
+	Instances         Summary
+	FullHosts         int
+	SlotUtilization   float64
+	MemoryUtilization float64 `json:",omitempty"`
+}
+
+// ZoneStats describes how the instances of each app are spread across zones.
+// The imbalance of an app is the difference between the most and fewest of
+// its instances in any zone; an app is unbalanced when that is more than one.
+// An app is lost when a zone fails if all of its placed instances are there.
+type ZoneStats struct {
+	NumZones         int
+	HostsPerZone     []int
+	InstancesPerZone []int
+
+	ImbalancePerApp []int
+	Imbalance       Summary
+	UnbalancedApps  int
+
+	AppsLostPerZone       []int
+	MaxFractionOfAppsLost float64
+}
+
+type IPAMStats struct {
+	OverlayCIDR            string
+	HostSubnetPrefixLength int
+	HostSubnets            []string
+	AddressesPerHost       int
+	OverflowingHosts       []int
+	UnaddressedInstances   int
+
+	AddressesAllocated int
+	AddressesUsed      int
+	AddressesWasted    int
+}
+
+// EvacuationStats describes the cluster after the instances on failed hosts
+// have been re-placed onto the surviving hosts. Instances keeps the placement
+// from before the failure.
+type EvacuationStats struct {
+	FailedHostIds     []int
+	InstancesMoved    int
+	InstancesPerHost  []int
+	Instances         Summary
+	HostCapacity      int
+	HostsOverCapacity int
+	UnplacedInstances int
+}
+
+type Policy struct {
+	SourceAppId      int    `json:"s"`
+	DestinationAppId int    `json:"d"`
+	Protocol         string `json:"p"`
+	Port             int    `json:"n"`
+	Volume           int    `json:"v,omitempty"`
+}
+
+type PolicyStats struct {
+	TotalPolicies int
+	TotalRules    int
+	RulesPerHost  []int
+	Rules         Summary
+}
+
+// TrafficStats estimates where the traffic permitted by policies flows,
+// assuming that every source instance sends the same amount to every
+// destination instance. Each policy carries its Volume, or 1 when volumes are
+// not sampled. Traffic between hosts is split into traffic within a zone and
+// traffic between zones.
+type TrafficStats struct {
+	TotalVolume     float64
+	HostLocalVolume float64
+	CrossHostVolume float64
+	CrossZoneVolume float64
+
+	HostLocalFraction float64
+	CrossHostFraction float64
+	CrossZoneFraction float64
+}
+
+type BatchRequest struct {
+	SteadyStateRequest
+	Trials int
+}
+
+type BatchResponse struct {
+	Request           BatchRequest
+	Seed              int64
+	PlacementStrategy string
+	TrialSeeds        []int64
+
+	Metrics map[string]Estimate
+}
+
+// Estimate is the sample mean of a metric across trials, with a 95%
+// confidence interval for the true mean.
+type Estimate struct {
+	Mean     float64
+	StdDev   float64
+	CI95Low  float64
+	CI95High float64
+}
+
+type SweepRequest struct {
+	SteadyStateRequest
+	Parameter string
+	From      float64
+	To        float64
+	Step      float64
+}
+
+type SweepResponse struct {
+	Request           SweepRequest
+	Seed              int64
+	PlacementStrategy string
+
+	Points []SweepPoint
+}
+
+type SweepPoint struct {
+	Value   float64
+	Metrics map[string]float64
+}
+
+// AppSizeHistogramRequest uploads an observed histogram of app sizes, mapping
+// each size to the number of apps of that size.
+type AppSizeHistogramRequest struct {
+	Name      string
+	Histogram map[int]int
+}
+
+type AppSizeHistogramResponse struct {
+	Name    string
+	NumApps int
+	Mean    float64
+}
+
+type ChurnRequest struct {
+	NumHosts            int
+	NumApps             int
+	MeanInstancesPerApp int
+	MeanPoliciesPerApp  float64
+	Seed                int64
+	PlacementStrategy   string
+
+	DurationSeconds       int
+	SampleIntervalSeconds int
+
+	PushesPerSecond   float64
+	ScalesPerSecond   float64
+	RestartsPerSecond float64
+	DeletesPerSecond  float64
+}
+
+type ChurnResponse struct {
+	Request           ChurnRequest
+	Seed              int64
+	PlacementStrategy string
+
+	Events  ChurnEvents
+	Samples []ChurnSample
+
+	PeakInstanceChangesPerSecond   int
+	PeakPolicyRuleChangesPerSecond int
+}
+
+type ChurnEvents struct {
+	Pushes   int
+	Scales   int
+	Restarts int
+	Deletes  int
+}
+
+// ChurnSample describes the interval of simulated time ending at Time.
+type ChurnSample struct {
+	Time                       int
+	InstancesPerHost           []int
+	InstanceChangesPerSecond   float64
+	PolicyRuleChangesPerSecond float64
+}
+
+// The states of a job. Jobs that have succeeded, failed or been cancelled
+// are finished.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a steady-state simulation run in the background. Progress is the
+// fraction of the work done, from 0 to 1. The Result is only present once the
+// job has succeeded, and the job is forgotten after ExpiresAt.
+type Job struct {
+	Id       string
+	Status   string
+	Progress float64
+	Request  SteadyStateRequest
+	Error    string `json:",omitempty"`
+
+	CreatedAt  time.Time
+	StartedAt  *time.Time `json:",omitempty"`
+	FinishedAt *time.Time `json:",omitempty"`
+	ExpiresAt  *time.Time `json:",omitempty"`
+
+	Result *SteadyStateResponse `json:",omitempty"`
 }
 
 type APIError struct {
-	Error string
+	Code   string // e.g. decode, validation or simulator
+	Error  string
+	Path   string       `json:",omitempty"` // of the offending value in a JSON request
+	Fields []FieldError `json:",omitempty"` // every invalid field, on validation errors
+}
+
+// FieldError describes a request field that violates a constraint, such as
+// range, one-of, format, requires or limit.
+type FieldError struct {
+	Field      string `json:",omitempty"` // empty when the constraint spans several fields
+	Constraint string
+	Min        *float64    `json:",omitempty"`
+	Max        *float64    `json:",omitempty"`
+	Got        interface{} `json:",omitempty"`
+	Message    string
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationError lists every violation found in a request.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, "; ")
 }
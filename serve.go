@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/rosenhouse/cnsim/admission"
+	"github.com/rosenhouse/cnsim/distributions"
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/metrics"
+	"github.com/rosenhouse/cnsim/simulate"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
+	"github.com/tedsuo/ifrit/sigmon"
+	"github.com/tedsuo/rata"
+)
+
+// admissionReservedBytes is the part of the memory limit that simulations,
+// whose costs are in bytes of heap, may not use: the heap of the idle server
+// and the memory that the runtime takes outside the heap. It leaves 22 MB of
+// the 32M in the manifest, enough for one simulation of the largest size
+// but not two.
+const admissionReservedBytes = 10 << 20
+
+// parseMemoryLimit reads a size such as "32m" or "1G", as Cloud Foundry
+// sets MEMORY_LIMIT, into bytes.
+func parseMemoryLimit(value string) (int64, error) {
+	multipliers := map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+	lower := strings.ToLower(strings.TrimSpace(value))
+	digits := strings.TrimRight(lower, "kmg")
+	multiplier, ok := multipliers[lower[len(digits):]]
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if !ok || err != nil || size <= 0 {
+		return 0, fmt.Errorf("must be a positive size such as 32m, not %q", value)
+	}
+	return size * multiplier, nil
+}
+
+// checkSingleInstance refuses any instance but the first, given the
+// CF_INSTANCE_INDEX that Cloud Foundry sets. Uploaded histograms live in the
+// memory of one instance, and nothing routes the requests that name them
+// back to it.
+func checkSingleInstance(index string) error {
+	if index == "" || index == "0" {
+		return nil
+	}
+	return fmt.Errorf("cnsim keeps uploaded histograms in memory, so it must run as a single instance, not as instance %s", index)
+}
+
+func getEnv(logger lager.Logger, name, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		value = defaultValue
+		logger.Info("missing-env-var", lager.Data{"name": name, "default-to": value})
+	} else {
+		logger.Info("read-env-var", lager.Data{"name": name, "value": value})
+	}
+	return value
+}
+
+// serve runs the HTTP server, configured by the environment, until it is
+// interrupted.
+func serve() {
+	logger := lager.NewLogger("cnsim-server")
+	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
+
+	if err := checkSingleInstance(os.Getenv("CF_INSTANCE_INDEX")); err != nil {
+		log.Fatalf("CF_INSTANCE_INDEX: %s", err)
+	}
+
+	port := getEnv(logger, "PORT", "9000")
+	listenAddress := getEnv(logger, "LISTEN_ADDRESS", "127.0.0.1")
+
+	address := fmt.Sprintf("%s:%s", listenAddress, port)
+	logger.Info("listen", lager.Data{"address": address})
+
+	routes := rata.Routes{
+		{Name: "root", Method: "GET", Path: "/"},
+		{Name: "steady_state", Method: "GET", Path: "/steady_state"},
+		{Name: "steady_state_json", Method: "POST", Path: "/steady_state"},
+		{Name: "batch", Method: "GET", Path: "/steady_state/batch"},
+		{Name: "sweep", Method: "GET", Path: "/steady_state/sweep"},
+		{Name: "churn", Method: "GET", Path: "/churn"},
+		{Name: "app_size_histogram", Method: "PUT", Path: "/app_size_histograms/:name"},
+		{Name: "submit_job", Method: "POST", Path: "/jobs"},
+		{Name: "job", Method: "GET", Path: "/jobs/:id"},
+		{Name: "cancel_job", Method: "DELETE", Path: "/jobs/:id"},
+		{Name: "metrics", Method: "GET", Path: "/metrics"},
+	}
+
+	registry := &metrics.Registry{}
+	registry.RegisterRuntime()
+
+	steadyState := newSteadyState()
+	steadyState.Observer = metrics.NewSimulations(registry)
+
+	jobWorkers, err := strconv.Atoi(getEnv(logger, "JOB_WORKERS", "2"))
+	if err != nil {
+		log.Fatalf("JOB_WORKERS: %s", err)
+	}
+	jobRetention, err := time.ParseDuration(getEnv(logger, "JOB_RETENTION", "10m"))
+	if err != nil {
+		log.Fatalf("JOB_RETENTION: %s", err)
+	}
+	// the budget bounds the total cost, the estimated peak heap in bytes, of
+	// the simulations that handlers and jobs run at once, and of the results
+	// that jobs retain
+	memoryLimit, err := parseMemoryLimit(getEnv(logger, "MEMORY_LIMIT", "32m"))
+	if err != nil {
+		log.Fatalf("MEMORY_LIMIT: %s", err)
+	}
+	if memoryLimit <= admissionReservedBytes {
+		log.Fatalf("MEMORY_LIMIT: must be more than the %d bytes that the server reserves", admissionReservedBytes)
+	}
+	defaultBudget := strconv.FormatInt(memoryLimit-admissionReservedBytes, 10)
+	admissionBudget, err := strconv.ParseInt(getEnv(logger, "ADMISSION_BUDGET", defaultBudget), 10, 64)
+	if err != nil || admissionBudget <= 0 {
+		log.Fatalf("ADMISSION_BUDGET: must be a positive integer")
+	}
+	admissionRetryAfter, err := time.ParseDuration(getEnv(logger, "ADMISSION_RETRY_AFTER", "5s"))
+	if err != nil {
+		log.Fatalf("ADMISSION_RETRY_AFTER: %s", err)
+	}
+	admissionController := &admission.Controller{
+		Budget: admissionBudget,
+		Wait:   admissionRetryAfter,
+	}
+
+	jobsHandler := gziphandler.GzipHandler(&handlers.Jobs{
+		Logger: logger,
+		Runner: &simulate.Jobs{
+			SteadyState: steadyState,
+			Admission:   admissionController,
+			Workers:     jobWorkers,
+			Retention:   jobRetention,
+		},
+	})
+
+	steadyStateHandler := gziphandler.GzipHandler(&handlers.SteadyState{
+		Logger:    logger,
+		Simulator: steadyState,
+		Admission: admissionController,
+		Stages: metrics.NewStages(registry, "cnsim_steady_state_handler_stage_duration_seconds",
+			"Time taken by each stage of serving steady-state requests."),
+	})
+
+	rataHandlers := rata.Handlers{
+		"root": &handlers.Root{
+			Logger: logger,
+		},
+		"steady_state":      steadyStateHandler,
+		"steady_state_json": steadyStateHandler,
+		"batch": gziphandler.GzipHandler(&handlers.Batch{
+			Logger: logger,
+			Simulator: &simulate.Batch{
+				SteadyState: steadyState,
+			},
+			Admission: admissionController,
+		}),
+		"sweep": gziphandler.GzipHandler(&handlers.Sweep{
+			Logger: logger,
+			Simulator: &simulate.Sweep{
+				SteadyState: steadyState,
+			},
+			Admission: admissionController,
+		}),
+		"app_size_histogram": &handlers.AppSizeHistogram{
+			Logger: logger,
+			Registry: &simulate.AppSizeHistograms{
+				SteadyState: steadyState,
+			},
+		},
+		"submit_job": jobsHandler,
+		"job":        jobsHandler,
+		"cancel_job": jobsHandler,
+		"churn": gziphandler.GzipHandler(&handlers.Churn{
+			Logger: logger,
+			Simulator: &simulate.Churn{
+				AppSizeDistribution: &distributions.GeometricWithPositiveSupport{},
+			},
+			Admission: admissionController,
+		}),
+		"metrics": registry,
+	}
+
+	requests := metrics.NewRequests(registry)
+	for name, handler := range rataHandlers {
+		rataHandlers[name] = requests.Instrument(name, handler)
+	}
+
+	router, err := rata.NewRouter(routes, rataHandlers)
+	if err != nil {
+		log.Fatalf("unable to create rata Router: %s", err) // not tested
+	}
+
+	monitor := ifrit.Invoke(sigmon.New(grouper.NewOrdered(os.Interrupt, grouper.Members{
+		{"http_server", http_server.New(address, router)},
+	})))
+	err = <-monitor.Wait()
+	if err != nil {
+		log.Fatalf("ifrit: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("parseMemoryLimit", func() {
+	It("reads sizes as Cloud Foundry sets them", func() {
+		for value, bytes := range map[string]int64{
+			"32m":   32 << 20,
+			"1G":    1 << 30,
+			"512k":  512 << 10,
+			"4096":  4096,
+			" 64M ": 64 << 20,
+		} {
+			Expect(parseMemoryLimit(value)).To(Equal(bytes), value)
+		}
+	})
+
+	It("rejects anything else", func() {
+		for _, value := range []string{"", "m", "0m", "-1m", "32mb", "32mm", "banana"} {
+			_, err := parseMemoryLimit(value)
+			Expect(err).To(MatchError(`must be a positive size such as 32m, not "` + value + `"`))
+		}
+	})
+
+	It("gives a default budget that admits one simulation of the largest size but not two", func() {
+		memoryLimit, err := parseMemoryLimit("32m")
+		Expect(err).NotTo(HaveOccurred())
+		largest := newSteadyState().Cost(models.SteadyStateRequest{
+			NumHosts:            1000,
+			NumApps:             65534,
+			MeanInstancesPerApp: 100,
+			MeanPoliciesPerApp:  10,
+		})
+		Expect(memoryLimit - admissionReservedBytes).To(BeNumerically(">=", largest))
+		Expect(memoryLimit - admissionReservedBytes).To(BeNumerically("<", 2*largest))
+	})
+})
+
+var _ = Describe("checkSingleInstance", func() {
+	It("accepts the first instance, or none outside Cloud Foundry", func() {
+		Expect(checkSingleInstance("0")).To(Succeed())
+		Expect(checkSingleInstance("")).To(Succeed())
+	})
+
+	It("refuses any other instance", func() {
+		Expect(checkSingleInstance("1")).To(MatchError("cnsim keeps uploaded histograms in memory, so it must run as a single instance, not as instance 1"))
+	})
+})
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/handlers"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// simulateCommand runs one steady-state simulation, validated as the server
+// validates it, and writes the result in the format the server would
+// respond with. It returns the exit status: 2 for a bad command line or
+// request, and 1 when the simulation or writing fails.
+func simulateCommand(args []string, stdout, stderr io.Writer) int {
+	var (
+		req         models.SteadyStateRequest
+		requestPath string
+		format      string
+		table       string
+		outputPath  string
+	)
+	flags := flag.NewFlagSet("cnsim simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&requestPath, "request", "", "read the request from a JSON `file`, or - for stdin; other flags override its fields")
+	flags.StringVar(&format, "format", "json", "write json, csv or ndjson")
+	flags.StringVar(&table, "table", "", "the table that csv or ndjson writes: apps, hosts, instances or policies")
+	flags.StringVar(&outputPath, "o", "-", "write to `file`, or - for stdout")
+
+	flags.IntVar(&req.NumHosts, "hosts", 0, "NumHosts")
+	flags.IntVar(&req.NumApps, "apps", 0, "NumApps")
+	flags.IntVar(&req.MeanInstancesPerApp, "mean-instances", 0, "MeanInstancesPerApp")
+	flags.Int64Var(&req.Seed, "seed", 0, "Seed, or 0 for a random seed")
+	flags.StringVar(&req.AppSizeDistribution, "app-size-distribution", "", "AppSizeDistribution")
+	flags.StringVar(&req.PlacementStrategy, "placement-strategy", "", "PlacementStrategy")
+	flags.Float64Var(&req.MeanPoliciesPerApp, "mean-policies", 0, "MeanPoliciesPerApp")
+	flags.Float64Var(&req.PolicyFanInSkew, "policy-fan-in-skew", 0, "PolicyFanInSkew")
+	flags.StringVar(&req.PolicyVolumeDistribution, "policy-volume-distribution", "", "PolicyVolumeDistribution")
+	flags.Float64Var(&req.MeanPolicyVolume, "mean-policy-volume", 0, "MeanPolicyVolume")
+	flags.StringVar(&req.OverlayCIDR, "overlay-cidr", "", "OverlayCIDR")
+	flags.IntVar(&req.HostSubnetPrefixLength, "host-subnet-prefix-length", 0, "HostSubnetPrefixLength")
+	flags.IntVar(&req.FailedHosts, "failed-hosts", 0, "FailedHosts")
+	flags.Float64Var(&req.FailedHostFraction, "failed-host-fraction", 0, "FailedHostFraction")
+	flags.IntVar(&req.HostCapacity, "host-capacity", 0, "HostCapacity")
+	flags.IntVar(&req.MeanAppMemoryMB, "mean-app-memory", 0, "MeanAppMemoryMB")
+	flags.IntVar(&req.NumZones, "zones", 0, "NumZones")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments: %v\n", flags.Args())
+		return 2
+	}
+
+	if requestPath != "" {
+		// the request replaces every field, so the flags given are set again
+		set := map[string]string{}
+		flags.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+		if err := readRequest(requestPath, &req); err != nil {
+			fmt.Fprintf(stderr, "request: %s\n", err)
+			return 2
+		}
+		for name, value := range set {
+			flags.Set(name, value)
+		}
+	}
+
+	steadyState := newSteadyState()
+	if err := steadyState.Validate(req); err != nil {
+		fmt.Fprintf(stderr, "validation: %s\n", err)
+		return 2
+	}
+
+	// checks the format and table before creating any output
+	if _, err := handlers.NewSteadyStateWriter(format, table, ioutil.Discard); err != nil {
+		fmt.Fprintf(stderr, "format: %s\n", err)
+		return 2
+	}
+
+	var temp *os.File
+	output := stdout
+	if outputPath != "-" {
+		// writes beside the output and renames it into place once done, so
+		// that a failure leaves any file already there alone
+		var err error
+		temp, err = ioutil.TempFile(filepath.Dir(outputPath), "."+filepath.Base(outputPath))
+		if err != nil {
+			fmt.Fprintf(stderr, "output: %s\n", err)
+			return 2
+		}
+		output = temp
+	}
+	discard := func() {
+		if temp != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}
+
+	out, err := handlers.NewSteadyStateWriter(format, table, output)
+	if err != nil {
+		fmt.Fprintf(stderr, "format: %s\n", err) // not reached, as checked above
+		discard()
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logger := lager.NewLogger("cnsim")
+	logger.RegisterSink(lager.NewWriterSink(stderr, lager.ERROR))
+	err = steadyState.Stream(ctx, logger, req, out)
+	if err != nil {
+		fmt.Fprintf(stderr, "simulator: %s\n", err)
+		discard()
+		return 1
+	}
+	if temp != nil {
+		if err := finishOutput(temp, outputPath); err != nil {
+			fmt.Fprintf(stderr, "output: %s\n", err)
+			discard()
+			return 1
+		}
+	}
+	return 0
+}
+
+// finishOutput closes the temporary file and renames it to path. The file
+// gets the permissions that os.Create gives under the usual umask, rather
+// than those of a temporary file.
+func finishOutput(temp *os.File, path string) error {
+	if err := temp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// readRequest strictly decodes a JSON request from the file, or from stdin
+// when the path is -.
+func readRequest(path string, req *models.SteadyStateRequest) error {
+	in := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	decoder := json.NewDecoder(in)
+	decoder.DisallowUnknownFields()
+	*req = models.SteadyStateRequest{}
+	return decoder.Decode(req)
+}
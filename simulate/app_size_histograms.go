@@ -0,0 +1,136 @@
+package simulate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/distributions"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const maxUploadedDistributions = 100
+
+var distributionNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// AppSizeHistograms registers empirical app size distributions with a
+// SteadyState, so that later requests can select them by name. Registering
+// an existing name replaces its histogram. The histograms live only in the
+// memory of this process.
+type AppSizeHistograms struct {
+	SteadyState *SteadyState
+}
+
+func (h *AppSizeHistograms) Execute(logger lager.Logger, req models.AppSizeHistogramRequest) (*models.AppSizeHistogramResponse, error) {
+	logger.Info("start", lager.Data{"name": req.Name, "sizes": len(req.Histogram)})
+	defer logger.Info("done")
+
+	distribution, err := distributions.NewEmpirical(req.Histogram)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.SteadyState.upload(req.Name, distribution); err != nil {
+		return nil, err
+	}
+
+	numApps := 0
+	for _, count := range req.Histogram {
+		numApps += count
+	}
+
+	logger.Info("success")
+	return &models.AppSizeHistogramResponse{
+		Name:    req.Name,
+		NumApps: numApps,
+		Mean:    distribution.Mean(),
+	}, nil
+}
+
+func (h *AppSizeHistograms) Validate(req models.AppSizeHistogramRequest) error {
+	var errs fieldErrors
+	if !distributionNamePattern.MatchString(req.Name) {
+		errs.add(fieldError("Name", "format", req.Name, "Name must be 1 - 64 characters from a-z, 0-9, '-' and '_'"))
+	} else if _, ok := h.SteadyState.AppSizeDistributions[req.Name]; ok {
+		errs.add(fieldError("Name", "reserved", req.Name, "Name %s is reserved for a built-in distribution", req.Name))
+	}
+	if err := distributions.CheckHistogram(req.Histogram); err != nil {
+		errs.add(fieldError("Histogram", "invalid", nil, "%s", err))
+	}
+
+	h.SteadyState.uploadedLock.RLock()
+	errs.add(h.SteadyState.checkUploadLimit(req.Name))
+	h.SteadyState.uploadedLock.RUnlock()
+	return errs.err()
+}
+
+func (s *SteadyState) upload(name string, distribution meanParameterizedDiscreteDistribution) error {
+	s.uploadedLock.Lock()
+	defer s.uploadedLock.Unlock()
+
+	if s.uploaded == nil {
+		s.uploaded = make(map[string]meanParameterizedDiscreteDistribution)
+	}
+	if err := s.checkUploadLimit(name); err != nil {
+		return err
+	}
+	s.uploaded[name] = distribution
+	return nil
+}
+
+// checkUploadLimit must be called with uploadedLock held.
+func (s *SteadyState) checkUploadLimit(name string) error {
+	if _, ok := s.uploaded[name]; !ok && len(s.uploaded) >= maxUploadedDistributions {
+		return fieldError("", "limit", nil, "at most %d app size distributions may be uploaded", maxUploadedDistributions)
+	}
+	return nil
+}
+
+// histogram is implemented by distributions with a mean of their own, like
+// uploaded histograms, which requests may sample as they are.
+type histogram interface {
+	Mean() float64
+}
+
+// meanInstancesPerApp is the MeanInstancesPerApp of the request, or the mean
+// of the histogram it names when it leaves MeanInstancesPerApp at 0.
+func (s *SteadyState) meanInstancesPerApp(req models.SteadyStateRequest) float64 {
+	if req.MeanInstancesPerApp == 0 {
+		distribution, _ := s.lookupAppSizeDistribution(req.AppSizeDistribution)
+		if histogram, ok := distribution.(histogram); ok {
+			return histogram.Mean()
+		}
+	}
+	return float64(req.MeanInstancesPerApp)
+}
+
+func (s *SteadyState) lookupAppSizeDistribution(name string) (meanParameterizedDiscreteDistribution, error) {
+	if name == "" {
+		return s.AppSizeDistribution, nil
+	}
+	return s.lookupDistribution("AppSizeDistribution", name)
+}
+
+// lookupDistribution finds a built-in or uploaded distribution by name.
+func (s *SteadyState) lookupDistribution(noun, name string) (meanParameterizedDiscreteDistribution, error) {
+	if distribution, ok := s.AppSizeDistributions[name]; ok {
+		return distribution, nil
+	}
+
+	s.uploadedLock.RLock()
+	defer s.uploadedLock.RUnlock()
+	if distribution, ok := s.uploaded[name]; ok {
+		return distribution, nil
+	}
+
+	names := make([]string, 0, len(s.AppSizeDistributions)+len(s.uploaded))
+	for name := range s.AppSizeDistributions {
+		names = append(names, name)
+	}
+	for name := range s.uploaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fieldError(noun, "one-of", name, "%s must be one of: %s", noun, strings.Join(names, ", "))
+}
@@ -0,0 +1,177 @@
+package simulate_test
+
+import (
+	"context"
+	"fmt"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Uploaded app size histograms", func() {
+	var (
+		steadyState *simulate.SteadyState
+		histograms  *simulate.AppSizeHistograms
+		logger      *lagertest.TestLogger
+		req         models.AppSizeHistogramRequest
+	)
+
+	BeforeEach(func() {
+		steadyState = &simulate.SteadyState{
+			AppSizeDistribution: &fakes.MeanParameterizedDiscreteDistribution{},
+			AppSizeDistributions: simulate.NamedDistributions{
+				"geometric": &fakes.MeanParameterizedDiscreteDistribution{},
+			},
+		}
+		histograms = &simulate.AppSizeHistograms{SteadyState: steadyState}
+		logger = lagertest.NewTestLogger("test")
+		req = models.AppSizeHistogramRequest{
+			Name:      "my-fleet",
+			Histogram: map[int]int{3: 10},
+		}
+	})
+
+	It("summarizes the uploaded histogram", func() {
+		req.Histogram = map[int]int{1: 50, 2: 30, 10: 20}
+		resp, err := histograms.Execute(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Name).To(Equal("my-fleet"))
+		Expect(resp.NumApps).To(Equal(100))
+		Expect(resp.Mean).To(BeNumerically("~", 3.1, 1e-9))
+	})
+
+	It("makes the histogram available to steady state requests by name", func() {
+		_, err := histograms.Execute(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		ssReq := models.SteadyStateRequest{
+			NumHosts:            10,
+			NumApps:             20,
+			MeanInstancesPerApp: 3,
+			AppSizeDistribution: "my-fleet",
+		}
+		Expect(steadyState.Validate(ssReq)).To(Succeed())
+
+		resp, err := steadyState.Execute(context.Background(), logger, ssReq)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TotalInstances).To(Equal(60))
+		for _, app := range resp.Apps {
+			Expect(app.Size).To(Equal(3))
+		}
+	})
+
+	Context("when a steady state request leaves MeanInstancesPerApp at 0", func() {
+		var ssReq models.SteadyStateRequest
+
+		BeforeEach(func() {
+			req.Histogram = map[int]int{1: 50, 2: 30, 10: 20}
+			_, err := histograms.Execute(logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			ssReq = models.SteadyStateRequest{
+				NumHosts:            100,
+				NumApps:             1000,
+				AppSizeDistribution: "my-fleet",
+			}
+		})
+
+		It("samples the histogram as it is, at its own mean", func() {
+			Expect(steadyState.Validate(ssReq)).To(Succeed())
+
+			resp, err := steadyState.Execute(context.Background(), logger, ssReq)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.MeanInstancesPerHost).To(BeNumerically("~", 31, 1e-9))
+			for _, app := range resp.Apps {
+				Expect(app.Size).To(BeElementOf(1, 2, 10))
+			}
+			Expect(steadyState.Cost(ssReq)).To(Equal(int64(100*256 + 1000*8 + 3100*3)))
+		})
+
+		It("requires the mean of the histogram to be at most 100", func() {
+			req.Histogram = map[int]int{101: 1}
+			_, err := histograms.Execute(logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(steadyState.Validate(ssReq)).To(MatchError(
+				"the mean of AppSizeDistribution my-fleet must be at most 100, or MeanInstancesPerApp must scale it"))
+		})
+
+		It("still requires MeanInstancesPerApp for other distributions", func() {
+			ssReq.AppSizeDistribution = "geometric"
+			Expect(steadyState.Validate(ssReq)).To(MatchError("MeanInstancesPerApp must be 1 - 100"))
+		})
+	})
+
+	It("replaces the histogram when a name is uploaded again", func() {
+		_, err := histograms.Execute(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		req.Histogram = map[int]int{2: 10}
+		_, err = histograms.Execute(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := steadyState.Execute(context.Background(), logger, models.SteadyStateRequest{
+			NumHosts:            10,
+			NumApps:             20,
+			MeanInstancesPerApp: 2,
+			AppSizeDistribution: "my-fleet",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TotalInstances).To(Equal(40))
+	})
+
+	It("lists uploaded histograms along with the built-in distributions", func() {
+		_, err := histograms.Execute(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = steadyState.Validate(models.SteadyStateRequest{
+			NumHosts:            10,
+			NumApps:             20,
+			MeanInstancesPerApp: 2,
+			AppSizeDistribution: "banana",
+		})
+		Expect(err).To(MatchError("AppSizeDistribution must be one of: geometric, my-fleet"))
+	})
+
+	Describe("Validate", func() {
+		It("returns nil for a valid name and histogram", func() {
+			Expect(histograms.Validate(req)).To(Succeed())
+		})
+
+		It("requires a simple name", func() {
+			for _, name := range []string{"", "My-Fleet", "my fleet", "../fleet"} {
+				req.Name = name
+				Expect(histograms.Validate(req)).To(MatchError("Name must be 1 - 64 characters from a-z, 0-9, '-' and '_'"))
+			}
+		})
+
+		It("does not allow built-in distributions to be replaced", func() {
+			req.Name = "geometric"
+			Expect(histograms.Validate(req)).To(MatchError("Name geometric is reserved for a built-in distribution"))
+		})
+
+		It("requires a valid histogram", func() {
+			req.Histogram = map[int]int{0: 1}
+			Expect(histograms.Validate(req)).To(MatchError("histogram sizes must be 1 - 10000"))
+		})
+
+		It("limits the number of uploaded histograms", func() {
+			for i := 0; i < 100; i++ {
+				req.Name = fmt.Sprintf("fleet-%d", i)
+				_, err := histograms.Execute(logger, req)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			req.Name = "fleet-0"
+			Expect(histograms.Validate(req)).To(Succeed())
+
+			req.Name = "one-too-many"
+			Expect(histograms.Validate(req)).To(MatchError("at most 100 app size distributions may be uploaded"))
+			_, err := histograms.Execute(logger, req)
+			Expect(err).To(MatchError("at most 100 app size distributions may be uploaded"))
+		})
+	})
+})
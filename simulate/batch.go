@@ -0,0 +1,221 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	maxTrials = 1000
+
+	// each worker holds a whole simulation in memory
+	defaultWorkers = 1
+
+	// bounds the expected number of instances simulated across all trials
+	maxBatchInstances = 100000000
+)
+
+// Batch runs independent trials of a steady state simulation in parallel
+// and aggregates their summary metrics.
+type Batch struct {
+	SteadyState *SteadyState
+	Workers     int // defaults to 1
+}
+
+func (b *Batch) Execute(ctx context.Context, logger lager.Logger, req models.BatchRequest) (*models.BatchResponse, error) {
+	logger.Info("start", lager.Data{"input": req})
+	defer logger.Info("done")
+
+	var resp models.BatchResponse
+	resp.Request = req
+	resp.Seed = req.Seed
+	if resp.Seed == 0 {
+		resp.Seed = newSeed()
+	}
+	strategyName, _, err := lookupPlacementStrategy(req.PlacementStrategy)
+	if err != nil {
+		return nil, err
+	}
+	resp.PlacementStrategy = strategyName
+	resp.TrialSeeds = deriveSeeds(resp.Seed, req.Trials)
+
+	trialReqs := make([]models.SteadyStateRequest, req.Trials)
+	for i, seed := range resp.TrialSeeds {
+		trialReqs[i] = req.SteadyStateRequest
+		trialReqs[i].Seed = seed
+	}
+	trialMetrics, err := runParallel(ctx, logger, b.SteadyState, b.Workers, trialReqs)
+	if err != nil {
+		return nil, fmt.Errorf("trial: %s", err)
+	}
+	resp.Metrics = estimate(trialMetrics)
+
+	logger.Info("success")
+	return &resp, nil
+}
+
+func deriveSeeds(seed int64, n int) []int64 {
+	rng := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, n)
+	for i := range seeds {
+		for seeds[i] == 0 {
+			seeds[i] = rng.Int63()
+		}
+	}
+	return seeds
+}
+
+// runParallel executes each request on a bounded pool of workers and
+// returns the summary metrics of each, in order. It stops dispatching
+// requests after the first failure.
+func runParallel(ctx context.Context, logger lager.Logger, steadyState *SteadyState, workers int, reqs []models.SteadyStateRequest) ([]map[string]float64, error) {
+	workers = numWorkers(workers)
+
+	results := make([]map[string]float64, len(reqs))
+	indices := make(chan int)
+	failed := make(chan struct{})
+	var firstErr error
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				run, err := steadyState.simulate(ctx, logger.Session("run", lager.Data{"index": i}), reqs[i], nil)
+				if err != nil {
+					failOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				results[i] = summaryMetrics(run.resp)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range reqs {
+		select {
+		case indices <- i:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+func numWorkers(workers int) int {
+	if workers <= 0 {
+		return defaultWorkers
+	}
+	return workers
+}
+
+// summaryMetrics flattens the scalar results of a simulation that are worth
+// comparing across runs.
+func summaryMetrics(resp *models.SteadyStateResponse) map[string]float64 {
+	metrics := map[string]float64{
+		"TotalInstances":                   float64(resp.TotalInstances),
+		"HostStats.Instances.Min":          float64(resp.HostStats.Instances.Min),
+		"HostStats.Instances.Max":          float64(resp.HostStats.Instances.Max),
+		"HostStats.Instances.StdDev":       resp.HostStats.Instances.StdDev,
+		"HostStats.Instances.P50":          float64(resp.HostStats.Instances.P50),
+		"HostStats.Instances.P90":          float64(resp.HostStats.Instances.P90),
+		"HostStats.Instances.P99":          float64(resp.HostStats.Instances.P99),
+		"HostStats.DistinctApps.Mean":      resp.HostStats.DistinctApps.Mean,
+		"HostStats.DistinctApps.Max":       float64(resp.HostStats.DistinctApps.Max),
+		"Network.FullMesh.ARPEntries.Max":  float64(resp.Network.FullMesh.ARPEntries.Max),
+		"Network.PeersOnly.Routes.Mean":    resp.Network.PeersOnly.Routes.Mean,
+		"Network.PeersOnly.Routes.Max":     float64(resp.Network.PeersOnly.Routes.Max),
+		"Network.PeersOnly.ARPEntries.Max": float64(resp.Network.PeersOnly.ARPEntries.Max),
+		"PolicyStats.TotalRules":           float64(resp.PolicyStats.TotalRules),
+		"PolicyStats.Rules.Max":            float64(resp.PolicyStats.Rules.Max),
+		"Traffic.HostLocalFraction":        resp.Traffic.HostLocalFraction,
+		"Traffic.CrossHostFraction":        resp.Traffic.CrossHostFraction,
+		"Traffic.CrossZoneFraction":        resp.Traffic.CrossZoneFraction,
+	}
+	if resp.Capacity != nil {
+		metrics["Capacity.UnplacedInstances"] = float64(resp.Capacity.UnplacedInstances)
+		metrics["Capacity.FullHosts"] = float64(len(resp.Capacity.FullHosts))
+	}
+	if resp.Zones != nil {
+		metrics["Zones.Imbalance.Max"] = float64(resp.Zones.Imbalance.Max)
+		metrics["Zones.UnbalancedApps"] = float64(resp.Zones.UnbalancedApps)
+		metrics["Zones.MaxFractionOfAppsLost"] = resp.Zones.MaxFractionOfAppsLost
+	}
+	if resp.IPAM != nil {
+		metrics["IPAM.OverflowingHosts"] = float64(len(resp.IPAM.OverflowingHosts))
+		metrics["IPAM.UnaddressedInstances"] = float64(resp.IPAM.UnaddressedInstances)
+		metrics["IPAM.AddressesWasted"] = float64(resp.IPAM.AddressesWasted)
+	}
+	if resp.Evacuation != nil {
+		metrics["Evacuation.InstancesMoved"] = float64(resp.Evacuation.InstancesMoved)
+		metrics["Evacuation.Instances.Max"] = float64(resp.Evacuation.Instances.Max)
+		metrics["Evacuation.HostsOverCapacity"] = float64(resp.Evacuation.HostsOverCapacity)
+		metrics["Evacuation.UnplacedInstances"] = float64(resp.Evacuation.UnplacedInstances)
+	}
+	return metrics
+}
+
+// estimate uses the Student t distribution with n-1 degrees of freedom for
+// the confidence interval of each metric's mean, based on the sample
+// standard deviation, since the number of trials is often small. It needs
+// at least two trials, as Validate requires.
+func estimate(trials []map[string]float64) map[string]models.Estimate {
+	estimates := make(map[string]models.Estimate)
+	if len(trials) == 0 {
+		return estimates
+	}
+	n := float64(len(trials))
+	t95 := studentTQuantile(0.975, n-1)
+	for name := range trials[0] {
+		total := 0.0
+		for _, metrics := range trials {
+			total += metrics[name]
+		}
+		mean := total / n
+
+		sumSquares := 0.0
+		for _, metrics := range trials {
+			d := metrics[name] - mean
+			sumSquares += d * d
+		}
+		stdDev := math.Sqrt(sumSquares / (n - 1))
+
+		halfWidth := t95 * stdDev / math.Sqrt(n)
+		estimates[name] = models.Estimate{
+			Mean:     mean,
+			StdDev:   stdDev,
+			CI95Low:  mean - halfWidth,
+			CI95High: mean + halfWidth,
+		}
+	}
+	return estimates
+}
+
+func (b *Batch) Validate(req models.BatchRequest) error {
+	var errs fieldErrors
+	errs.add(b.SteadyState.Validate(req.SteadyStateRequest))
+	// a single trial has no spread from which to estimate an interval
+	errs.add(validateRange("Trials", req.Trials, 2, maxTrials))
+	if len(errs) == 0 && float64(req.Trials)*float64(req.NumApps)*b.SteadyState.meanInstancesPerApp(req.SteadyStateRequest) > maxBatchInstances {
+		errs.add(fieldError("Trials", "limit", req.Trials, "Trials * NumApps * MeanInstancesPerApp must be at most %d", maxBatchInstances))
+	}
+	return errs.err()
+}
@@ -0,0 +1,185 @@
+package simulate_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Batch simulator", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		steadyState         *simulate.SteadyState
+		sim                 *simulate.Batch
+		logger              *lagertest.TestLogger
+		req                 models.BatchRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		steadyState = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		sim = &simulate.Batch{
+			SteadyState: steadyState,
+			Workers:     4,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.BatchRequest{
+			SteadyStateRequest: models.SteadyStateRequest{
+				NumHosts:            50,
+				NumApps:             200,
+				MeanInstancesPerApp: 5,
+				PlacementStrategy:   "random",
+			},
+			Trials: 30,
+		}
+	})
+
+	Describe("Execute", func() {
+		It("derives a distinct seed for every trial", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.TrialSeeds).To(HaveLen(30))
+
+			seen := make(map[int64]bool)
+			for _, seed := range resp.TrialSeeds {
+				Expect(seed).NotTo(BeZero())
+				Expect(seen[seed]).To(BeFalse())
+				seen[seed] = true
+			}
+		})
+
+		It("aggregates the metrics of each trial", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.PlacementStrategy).To(Equal("random"))
+
+			total := 0.0
+			for _, seed := range resp.TrialSeeds {
+				trialReq := req.SteadyStateRequest
+				trialReq.Seed = seed
+				trial, err := steadyState.Execute(context.Background(), logger, trialReq)
+				Expect(err).NotTo(HaveOccurred())
+				total += float64(trial.TotalInstances)
+			}
+
+			estimate := resp.Metrics["TotalInstances"]
+			Expect(estimate.Mean).To(BeNumerically("~", total/30, 1e-9))
+			Expect(estimate.StdDev).To(BeNumerically(">", 0))
+			Expect(estimate.CI95Low).To(BeNumerically("<", estimate.Mean))
+			Expect(estimate.CI95High).To(BeNumerically(">", estimate.Mean))
+			Expect(estimate.CI95High - estimate.Mean).To(BeNumerically("~", estimate.Mean-estimate.CI95Low, 1e-9))
+		})
+
+		It("widens the confidence interval by the Student t quantile for few trials", func() {
+			req.Seed = 42 // so that the trials cannot all agree
+			for trials, t95 := range map[int]float64{2: 12.7062047362, 5: 2.7764451052, 30: 2.0452296421} {
+				req.Trials = trials
+				resp, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).NotTo(HaveOccurred())
+
+				estimate := resp.Metrics["TotalInstances"]
+				Expect(estimate.StdDev).To(BeNumerically(">", 0))
+				halfWidth := t95 * estimate.StdDev / math.Sqrt(float64(trials))
+				Expect(estimate.CI95High - estimate.Mean).To(BeNumerically("~", halfWidth, 1e-6*halfWidth))
+			}
+		})
+
+		It("runs one trial at a time by default", func() {
+			sim.Workers = 0
+			req.Trials = 4
+			req.NumApps = 20
+			var lock sync.Mutex
+			sampling, mostSampling := 0, 0
+			appSizeDistribution.SampleStub = func(context.Context, *rand.Rand, float64) (int, error) {
+				lock.Lock()
+				sampling++
+				if sampling > mostSampling {
+					mostSampling = sampling
+				}
+				lock.Unlock()
+				time.Sleep(time.Microsecond)
+				lock.Lock()
+				sampling--
+				lock.Unlock()
+				return 2, nil
+			}
+			_, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mostSampling).To(Equal(1))
+		})
+
+		It("includes metrics for optional stages only when they run", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Metrics).To(HaveKey("HostStats.Instances.Max"))
+			Expect(resp.Metrics).NotTo(HaveKey("Evacuation.InstancesMoved"))
+
+			req.FailedHosts = 5
+			resp, err = sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Metrics).To(HaveKey("Evacuation.InstancesMoved"))
+		})
+
+		It("is reproducible given a seed", func() {
+			req.Seed = 11
+			first, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).To(Equal(first))
+		})
+
+		It("gives up once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := sim.Execute(ctx, logger, req)
+			Expect(err).To(MatchError("trial: context canceled"))
+			Expect(appSizeDistribution.SampleCallCount()).To(Equal(0))
+		})
+
+		Context("when a trial fails", func() {
+			BeforeEach(func() {
+				appSizeDistribution.SampleReturns(0, errors.New("banana"))
+			})
+
+			It("wraps and returns the error", func() {
+				_, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).To(MatchError("trial: sampling app size: banana"))
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("validates the steady state parameters", func() {
+			req.NumHosts = 0
+			Expect(sim.Validate(req)).To(MatchError("NumHosts must be 1 - 1000"))
+		})
+
+		It("validates the number of trials", func() {
+			req.Trials = 1
+			Expect(sim.Validate(req)).To(MatchError("Trials must be 2 - 1000"))
+		})
+
+		It("bounds the total size of the batch", func() {
+			req.Trials = 1000
+			req.NumApps = 65534
+			req.MeanInstancesPerApp = 100
+			Expect(sim.Validate(req)).To(MatchError("Trials * NumApps * MeanInstancesPerApp must be at most 100000000"))
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package simulate
+
+import (
+	"fmt"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const maxHostClasses = 100
+
+// withHostClasses fills in NumHosts from the host classes, if any.
+func withHostClasses(req models.SteadyStateRequest) (models.SteadyStateRequest, error) {
+	if len(req.HostClasses) == 0 {
+		return req, nil
+	}
+	if len(req.HostClasses) > maxHostClasses {
+		return req, rangeError("HostClasses", len(req.HostClasses), 0, maxHostClasses,
+			fmt.Sprintf("at most %d HostClasses may be given", maxHostClasses))
+	}
+
+	var errs fieldErrors
+	total := 0
+	for i, class := range req.HostClasses {
+		errs.add(validateRange(fmt.Sprintf("HostClasses[%d].Count", i), class.Count, 1, 1000))
+		errs.add(validateRange(fmt.Sprintf("HostClasses[%d].Slots", i), class.Slots, 1, 100000))
+		errs.add(validateRange(fmt.Sprintf("HostClasses[%d].MemoryMB", i), class.MemoryMB, 0, 10000000))
+		total += class.Count
+	}
+
+	if req.NumHosts == 0 {
+		req.NumHosts = total
+	} else if req.NumHosts != total {
+		errs.add(rangeError("NumHosts", req.NumHosts, float64(total), float64(total),
+			fmt.Sprintf("NumHosts must be the total Count of HostClasses, %d", total)))
+	}
+	return req, errs.err()
+}
+
+// limitCluster applies the capacity of each host class to the hosts of the
+// cluster, and the memory of each app, which may be nil, to its instances.
+func limitCluster(c *cluster, req models.SteadyStateRequest, appMemoryMB []int) {
+	hostId := 0
+	for _, class := range req.HostClasses {
+		for i := 0; i < class.Count; i++ {
+			if _, ok := c.byHost[hostId]; ok {
+				c.setCapacity(hostId, class.Slots, class.MemoryMB)
+			}
+			hostId++
+		}
+	}
+
+	c.appMemoryMB = appMemoryMB
+}
+
+func (s *SteadyState) populateCapacity(c *cluster, unplacedInstances int, appMemoryMB []int, resp *models.SteadyStateResponse) {
+	// a host is full when not even the smallest app fits
+	smallestAppMemoryMB := 0
+	for i, memoryMB := range appMemoryMB {
+		if i == 0 || memoryMB < smallestAppMemoryMB {
+			smallestAppMemoryMB = memoryMB
+		}
+	}
+	isFull := func(entry *hostEntry) bool {
+		return entry.load >= entry.slots ||
+			(entry.memoryMB > 0 && entry.usedMemoryMB+smallestAppMemoryMB > entry.memoryMB)
+	}
+
+	stats := &models.CapacityStats{
+		UnplacedInstances: unplacedInstances,
+		FullHosts:         []int{},
+	}
+	hostId := 0
+	for _, class := range resp.Request.HostClasses {
+		classStats := models.HostClassStats{
+			HostClass:   class,
+			FirstHostId: hostId,
+		}
+		loads := make([]int, class.Count)
+		usedSlots, usedMemoryMB := 0, 0
+		for i := range loads {
+			entry := c.byHost[hostId]
+			loads[i] = entry.load
+			usedSlots += entry.load
+			usedMemoryMB += entry.usedMemoryMB
+			if isFull(entry) {
+				classStats.FullHosts++
+				stats.FullHosts = append(stats.FullHosts, hostId)
+			}
+			hostId++
+		}
+
+		classStats.Instances = summarize(loads)
+		classStats.SlotUtilization = float64(usedSlots) / float64(class.Slots*class.Count)
+		if class.MemoryMB > 0 {
+			classStats.MemoryUtilization = float64(usedMemoryMB) / float64(class.MemoryMB*class.Count)
+		}
+		stats.HostClasses = append(stats.HostClasses, classStats)
+	}
+	resp.Capacity = stats
+}
@@ -0,0 +1,215 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Host capacity", func() {
+	var (
+		appSizeDistribution   *fakes.MeanParameterizedDiscreteDistribution
+		appMemoryDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                   *simulate.SteadyState
+		logger                *lagertest.TestLogger
+		req                   models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleReturns(8, nil)
+		appMemoryDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appMemoryDistribution.SampleReturns(1000, nil)
+		sim = &simulate.SteadyState{
+			AppSizeDistribution:   appSizeDistribution,
+			AppMemoryDistribution: appMemoryDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+
+		// 80 instances, but only 60 slots
+		req = models.SteadyStateRequest{
+			NumApps:             10,
+			MeanInstancesPerApp: 8,
+			HostClasses: []models.HostClass{
+				{Name: "small", Count: 5, Slots: 2},
+				{Name: "large", Count: 5, Slots: 10},
+			},
+		}
+	})
+
+	It("is skipped when no host classes are given", func() {
+		req.HostClasses = nil
+		req.NumHosts = 10
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Capacity).To(BeNil())
+		Expect(resp.Instances).To(HaveLen(80))
+	})
+
+	It("numbers the hosts in class order", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Request.NumHosts).To(Equal(10))
+		Expect(resp.HostStats.InstancesPerHost).To(Equal([]int{2, 2, 2, 2, 2, 10, 10, 10, 10, 10}))
+
+		classes := resp.Capacity.HostClasses
+		Expect(classes).To(HaveLen(2))
+		Expect(classes[0].Name).To(Equal("small"))
+		Expect(classes[0].FirstHostId).To(Equal(0))
+		Expect(classes[1].Name).To(Equal("large"))
+		Expect(classes[1].FirstHostId).To(Equal(5))
+	})
+
+	DescribeTable("never places more instances on a host than it has slots",
+		func(strategy string) {
+			req.PlacementStrategy = strategy
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resp.TotalInstances).To(Equal(80))
+			Expect(resp.Instances).To(HaveLen(60))
+			Expect(resp.Capacity.UnplacedInstances).To(Equal(20))
+			Expect(resp.Capacity.FullHosts).To(Equal([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}))
+			for _, class := range resp.Capacity.HostClasses {
+				Expect(class.FullHosts).To(Equal(5))
+				Expect(class.SlotUtilization).To(Equal(1.0))
+				Expect(class.Instances.Max).To(Equal(class.Slots))
+			}
+		},
+		Entry("round-robin", "round-robin"),
+		Entry("random", "random"),
+		Entry("least-loaded", "least-loaded"),
+		Entry("spread", "spread"),
+	)
+
+	It("reports utilization per host class when there is room to spare", func() {
+		req.NumApps = 5
+		req.PlacementStrategy = "least-loaded"
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.Capacity.UnplacedInstances).To(Equal(0))
+		Expect(resp.Capacity.FullHosts).To(Equal([]int{0, 1, 2, 3, 4}))
+
+		small, large := resp.Capacity.HostClasses[0], resp.Capacity.HostClasses[1]
+		Expect(small.SlotUtilization).To(Equal(1.0))
+		Expect(large.SlotUtilization).To(Equal(0.6))
+		Expect(large.FullHosts).To(Equal(0))
+		Expect(large.MemoryUtilization).To(Equal(0.0))
+	})
+
+	Context("when apps need memory", func() {
+		BeforeEach(func() {
+			req.MeanAppMemoryMB = 1024
+			req.HostClasses = []models.HostClass{
+				{Name: "a", Count: 4, Slots: 100, MemoryMB: 2500},
+			}
+		})
+
+		It("samples the memory of each app", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			for _, app := range resp.Apps {
+				Expect(app.MemoryMB).To(Equal(1000))
+			}
+			_, _, mean := appMemoryDistribution.SampleArgsForCall(0)
+			Expect(mean).To(Equal(1024.0))
+		})
+
+		DescribeTable("never places more memory on a host than it has",
+			func(strategy string) {
+				req.PlacementStrategy = strategy
+				resp, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resp.HostStats.InstancesPerHost).To(Equal([]int{2, 2, 2, 2}))
+				Expect(resp.Capacity.UnplacedInstances).To(Equal(72))
+				Expect(resp.Capacity.FullHosts).To(HaveLen(4))
+				Expect(resp.Capacity.HostClasses[0].MemoryUtilization).To(Equal(0.8))
+				Expect(resp.Capacity.HostClasses[0].SlotUtilization).To(Equal(0.02))
+			},
+			Entry("round-robin", "round-robin"),
+			Entry("random", "random"),
+			Entry("least-loaded", "least-loaded"),
+			Entry("spread", "spread"),
+		)
+
+		It("still places smaller apps once larger ones no longer fit", func() {
+			memory := []int{2000, 2000, 2000, 2000, 100}
+			appMemoryDistribution.SampleStub = func(_ context.Context, _ *rand.Rand, _ float64) (int, error) {
+				// every pass over the apps samples them again, in order
+				return memory[(appMemoryDistribution.SampleCallCount()-1)%len(memory)], nil
+			}
+			req.NumApps = 5
+			appSizeDistribution.SampleReturns(4, nil)
+
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Capacity.UnplacedInstances).To(Equal(12))
+			Expect(resp.Instances).To(HaveLen(8))
+			Expect(resp.Instances[4].AppId).To(Equal(4))
+		})
+	})
+
+	It("leaves evacuated instances unplaced when the surviving hosts are full", func() {
+		req.NumApps = 6
+		req.HostClasses = []models.HostClass{{Count: 10, Slots: 6}}
+		req.FailedHosts = 5
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Capacity.UnplacedInstances).To(Equal(0))
+
+		By("filling the 30 surviving slots with 48 instances")
+		evacuation := resp.Evacuation
+		Expect(evacuation.UnplacedInstances).To(Equal(18))
+		Expect(evacuation.Instances.Max).To(Equal(6))
+		Expect(evacuation.Instances.Min).To(Equal(6))
+	})
+
+	Describe("validation", func() {
+		It("accepts host classes in place of NumHosts", func() {
+			Expect(sim.Validate(req)).To(Succeed())
+
+			req.NumHosts = 10
+			Expect(sim.Validate(req)).To(Succeed())
+		})
+
+		It("requires NumHosts to agree with the host classes", func() {
+			req.NumHosts = 11
+			Expect(sim.Validate(req)).To(MatchError("NumHosts must be the total Count of HostClasses, 10"))
+		})
+
+		It("checks the range of each class", func() {
+			req.HostClasses[1].Count = 0
+			Expect(sim.Validate(req)).To(MatchError("HostClasses[1].Count must be 1 - 1000"))
+
+			req.HostClasses[1].Count = 5
+			req.HostClasses[0].Slots = 0
+			Expect(sim.Validate(req)).To(MatchError("HostClasses[0].Slots must be 1 - 100000"))
+
+			req.HostClasses[0].Slots = 2
+			req.HostClasses[0].MemoryMB = -1
+			Expect(sim.Validate(req)).To(MatchError("HostClasses[0].MemoryMB must be 0 - 10000000"))
+		})
+
+		It("limits the total number of hosts", func() {
+			req.HostClasses[0].Count = 1000
+			Expect(sim.Validate(req)).To(MatchError("NumHosts must be 1 - 1000"))
+		})
+
+		It("requires a memory distribution to sample app memory", func() {
+			req.MeanAppMemoryMB = 1024
+			Expect(sim.Validate(req)).To(Succeed())
+
+			sim.AppMemoryDistribution = nil
+			Expect(sim.Validate(req)).To(MatchError("MeanAppMemoryMB is not supported without an AppMemoryDistribution"))
+		})
+	})
+})
@@ -0,0 +1,425 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	maxChurnSamples        = 1000
+	maxChurnExpectedEvents = 100000
+
+	// maxChurnPeakBytes keeps the peak heap of a churn request, including
+	// its response, within the 24 MB that the handler benchmarks allow.
+	maxChurnPeakBytes         = 20 << 20
+	maxChurnExpectedInstances = maxChurnPeakBytes / churnBytesPerInstance
+)
+
+// Bytes of heap that each part of a churn simulation needs at its peak, as
+// measured by BenchmarkChurn* with GOGC=25.
+const (
+	churnBytesPerInstance = 4
+	churnBytesPerApp      = 96
+	churnBytesPerPolicy   = 8
+	churnBytesPerLoad     = 16 // per host in each sample
+)
+
+type Churn struct {
+	AppSizeDistribution meanParameterizedDiscreteDistribution
+}
+
+type churnApp struct {
+	id    int
+	index int // position in churnState.apps
+	live  bool
+
+	hosts           []uint16 // host of each instance, as in instanceSet
+	inboundPolicies int
+	outbound        []*churnApp
+}
+
+type churnState struct {
+	ctx          context.Context
+	req          models.ChurnRequest
+	rng          *rand.Rand
+	distribution meanParameterizedDiscreteDistribution
+	cluster      *cluster
+	strategy     placementStrategy
+
+	apps      []*churnApp
+	nextAppId int
+
+	// changes are binned per second of simulated time, once recording starts
+	recording       bool
+	second          int
+	instanceChanges []int
+	ruleChanges     []int
+}
+
+// Execute runs a discrete-event simulation. The initial apps are placed at
+// time zero without being counted as changes; after that, pushes, scales,
+// restarts and deletes arrive as independent Poisson processes.
+func (c *Churn) Execute(ctx context.Context, logger lager.Logger, req models.ChurnRequest) (*models.ChurnResponse, error) {
+	logger.Info("start", lager.Data{"input": req})
+	defer logger.Info("done")
+
+	var resp models.ChurnResponse
+	resp.Request = req
+	resp.Seed = req.Seed
+	if resp.Seed == 0 {
+		resp.Seed = newSeed()
+	}
+	rng := rand.New(rand.NewSource(resp.Seed))
+
+	strategyName, strategy, err := lookupPlacementStrategy(req.PlacementStrategy)
+	if err != nil {
+		return nil, err
+	}
+	resp.PlacementStrategy = strategyName
+
+	hostIds := make([]int, req.NumHosts)
+	for i := range hostIds {
+		hostIds[i] = i
+	}
+	state := &churnState{
+		ctx:             ctx,
+		req:             req,
+		rng:             rng,
+		distribution:    c.AppSizeDistribution,
+		cluster:         newCluster(rng, hostIds),
+		strategy:        strategy,
+		instanceChanges: make([]int, req.DurationSeconds),
+		ruleChanges:     make([]int, req.DurationSeconds),
+	}
+
+	for i := 0; i < req.NumApps; i++ {
+		if _, err := state.placeNewApp(); err != nil {
+			return nil, err
+		}
+	}
+	for _, app := range state.apps {
+		state.addPolicies(app)
+	}
+	state.recording = true
+
+	if err := state.run(&resp); err != nil {
+		return nil, err
+	}
+
+	resp.PeakInstanceChangesPerSecond = maxInt(state.instanceChanges)
+	resp.PeakPolicyRuleChangesPerSecond = maxInt(state.ruleChanges)
+
+	logger.Info("success")
+	return &resp, nil
+}
+
+// run plays events until DurationSeconds of simulated time pass, or ctx is
+// done.
+func (s *churnState) run(resp *models.ChurnResponse) error {
+	req := s.req
+	rates := []float64{req.PushesPerSecond, req.ScalesPerSecond, req.RestartsPerSecond, req.DeletesPerSecond}
+	totalRate := 0.0
+	for _, rate := range rates {
+		totalRate += rate
+	}
+
+	duration := float64(req.DurationSeconds)
+	nextSample := req.SampleIntervalSeconds
+	t := 0.0
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		if totalRate > 0 {
+			t += s.rng.ExpFloat64() / totalRate
+		} else {
+			t = duration
+		}
+
+		for nextSample <= req.DurationSeconds && float64(nextSample) <= t {
+			resp.Samples = append(resp.Samples, s.sample(nextSample))
+			nextSample += req.SampleIntervalSeconds
+		}
+		if t >= duration {
+			return nil
+		}
+		s.second = int(t)
+
+		var err error
+		switch pickEvent(s.rng.Float64()*totalRate, rates) {
+		case 0:
+			resp.Events.Pushes++
+			err = s.push()
+		case 1:
+			resp.Events.Scales++
+			err = s.scale()
+		case 2:
+			resp.Events.Restarts++
+			s.restart()
+		case 3:
+			resp.Events.Deletes++
+			s.delete()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func pickEvent(u float64, rates []float64) int {
+	for i, rate := range rates {
+		if u < rate {
+			return i
+		}
+		u -= rate
+	}
+	return len(rates) - 1
+}
+
+func (s *churnState) sample(end int) models.ChurnSample {
+	start := end - s.req.SampleIntervalSeconds
+	instanceChanges, ruleChanges := 0, 0
+	for i := start; i < end; i++ {
+		instanceChanges += s.instanceChanges[i]
+		ruleChanges += s.ruleChanges[i]
+	}
+	interval := float64(s.req.SampleIntervalSeconds)
+	return models.ChurnSample{
+		Time:                       end,
+		InstancesPerHost:           s.cluster.loads(),
+		InstanceChangesPerSecond:   float64(instanceChanges) / interval,
+		PolicyRuleChangesPerSecond: float64(ruleChanges) / interval,
+	}
+}
+
+func (s *churnState) record(instanceChanges, ruleChanges int) {
+	if !s.recording {
+		return
+	}
+	s.instanceChanges[s.second] += instanceChanges
+	s.ruleChanges[s.second] += ruleChanges
+}
+
+func (s *churnState) sampleSize() (int, error) {
+	size, err := s.distribution.Sample(s.ctx, s.rng, float64(s.req.MeanInstancesPerApp))
+	if err != nil {
+		return 0, fmt.Errorf("sampling app size: %s", err)
+	}
+	return size, nil
+}
+
+func (s *churnState) randomApp() *churnApp {
+	if len(s.apps) == 0 {
+		return nil
+	}
+	return s.apps[s.rng.Intn(len(s.apps))]
+}
+
+func (s *churnState) placeNewApp() (*churnApp, error) {
+	size, err := s.sampleSize()
+	if err != nil {
+		return nil, err
+	}
+	app := &churnApp{id: s.nextAppId, index: len(s.apps), live: true, hosts: make([]uint16, 0, size)}
+	s.nextAppId++
+	s.apps = append(s.apps, app)
+	s.focus(app)
+	defer s.cluster.forget(app.id)
+	for i := 0; i < size; i++ {
+		s.addInstance(app)
+	}
+	return app, nil
+}
+
+// focus has the cluster count the instances of the app, which strategies
+// such as spread need before placing more of them. The caller must have the
+// cluster forget the app once done.
+func (s *churnState) focus(app *churnApp) {
+	for _, hostId := range app.hosts {
+		s.cluster.count(app.id, int(hostId), 1)
+	}
+}
+
+// addPolicies gives the app outbound policies to other live apps. Each
+// policy needs a rule for every instance of its destination app.
+func (s *churnState) addPolicies(app *churnApp) {
+	if len(s.apps) < 2 {
+		return
+	}
+	mean := s.req.MeanPoliciesPerApp
+	count := int(math.Floor(mean))
+	if s.rng.Float64() < mean-math.Floor(mean) {
+		count++
+	}
+	app.outbound = make([]*churnApp, 0, count)
+	for i := 0; i < count; i++ {
+		dest := s.randomApp()
+		for dest == app {
+			dest = s.randomApp()
+		}
+		app.outbound = append(app.outbound, dest)
+		dest.inboundPolicies++
+		s.record(0, len(dest.hosts))
+	}
+}
+
+func (s *churnState) addInstance(app *churnApp) {
+	hostId, _ := s.strategy.place(s.cluster, app.id) // hosts are unlimited
+	s.cluster.assign(app.id, hostId)
+	app.hosts = append(app.hosts, uint16(hostId))
+	s.record(1, app.inboundPolicies)
+}
+
+func (s *churnState) removeInstance(app *churnApp) {
+	last := len(app.hosts) - 1
+	s.cluster.unassign(app.id, int(app.hosts[last]))
+	app.hosts = app.hosts[:last]
+	s.record(1, app.inboundPolicies)
+}
+
+func (s *churnState) push() error {
+	app, err := s.placeNewApp()
+	if err != nil {
+		return err
+	}
+	s.addPolicies(app)
+	return nil
+}
+
+func (s *churnState) scale() error {
+	app := s.randomApp()
+	if app == nil {
+		return nil
+	}
+	size, err := s.sampleSize()
+	if err != nil {
+		return err
+	}
+	s.focus(app)
+	defer s.cluster.forget(app.id)
+	for len(app.hosts) < size {
+		s.addInstance(app)
+	}
+	for len(app.hosts) > size {
+		s.removeInstance(app)
+	}
+	return nil
+}
+
+// restart replaces each instance of an app in turn, as in a rolling restart.
+func (s *churnState) restart() {
+	app := s.randomApp()
+	if app == nil {
+		return
+	}
+	s.focus(app)
+	defer s.cluster.forget(app.id)
+	for i, oldHostId := range app.hosts {
+		s.cluster.unassign(app.id, int(oldHostId))
+		s.record(1, app.inboundPolicies)
+
+		newHostId, _ := s.strategy.place(s.cluster, app.id)
+		s.cluster.assign(app.id, newHostId)
+		app.hosts[i] = uint16(newHostId)
+		s.record(1, app.inboundPolicies)
+	}
+}
+
+func (s *churnState) delete() {
+	app := s.randomApp()
+	if app == nil {
+		return
+	}
+	s.focus(app)
+	for len(app.hosts) > 0 {
+		s.removeInstance(app)
+	}
+	s.cluster.forget(app.id)
+	app.hosts = nil // other apps may still point to it
+	for _, dest := range app.outbound {
+		if dest.live {
+			dest.inboundPolicies--
+			s.record(0, len(dest.hosts))
+		}
+	}
+
+	app.live = false
+	last := s.apps[len(s.apps)-1]
+	last.index = app.index
+	s.apps[app.index] = last
+	s.apps = s.apps[:len(s.apps)-1]
+}
+
+func maxInt(values []int) int {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func (c *Churn) Validate(req models.ChurnRequest) error {
+	var errs fieldErrors
+	errs.add(validateRange("NumHosts", req.NumHosts, 1, 1000))
+	errs.add(validateRange("NumApps", req.NumApps, 0, 65534))
+	errs.add(validateRange("MeanInstancesPerApp", req.MeanInstancesPerApp, 1, 100))
+	errs.add(validateFloatRange("MeanPoliciesPerApp", req.MeanPoliciesPerApp, 0, 10))
+	if _, _, err := lookupPlacementStrategy(req.PlacementStrategy); err != nil {
+		errs.add(err)
+	}
+
+	durationErr := validateRange("DurationSeconds", req.DurationSeconds, 1, 86400)
+	errs.add(durationErr)
+	if durationErr == nil {
+		intervalErr := validateRange("SampleIntervalSeconds", req.SampleIntervalSeconds, 1, req.DurationSeconds)
+		errs.add(intervalErr)
+		if intervalErr == nil && req.DurationSeconds/req.SampleIntervalSeconds > maxChurnSamples {
+			errs.add(fieldError("SampleIntervalSeconds", "limit", req.SampleIntervalSeconds,
+				"DurationSeconds / SampleIntervalSeconds must be at most %d", maxChurnSamples))
+		}
+	}
+
+	rateErrs := len(errs)
+	errs.add(validateFloatRange("PushesPerSecond", req.PushesPerSecond, 0, 100))
+	errs.add(validateFloatRange("ScalesPerSecond", req.ScalesPerSecond, 0, 100))
+	errs.add(validateFloatRange("RestartsPerSecond", req.RestartsPerSecond, 0, 100))
+	errs.add(validateFloatRange("DeletesPerSecond", req.DeletesPerSecond, 0, 100))
+	totalRate := req.PushesPerSecond + req.ScalesPerSecond + req.RestartsPerSecond + req.DeletesPerSecond
+	if len(errs) == rateErrs && durationErr == nil && totalRate*float64(req.DurationSeconds) > maxChurnExpectedEvents {
+		errs.add(fieldError("", "limit", nil, "expected number of events must be at most %d", maxChurnExpectedEvents))
+	}
+	if len(errs) == 0 && churnExpectedInstances(req) > maxChurnExpectedInstances {
+		errs.add(fieldError("", "limit", nil, "expected number of instances placed must be at most %d", maxChurnExpectedInstances))
+	}
+	if len(errs) == 0 && churnPeakBytes(req) > maxChurnPeakBytes {
+		errs.add(fieldError("", "limit", nil, "expected peak memory of %.0f MB must be at most %d MB; lower NumApps, MeanPoliciesPerApp, PushesPerSecond or the number of samples",
+			churnPeakBytes(req)/(1<<20), maxChurnPeakBytes>>20))
+	}
+	return errs.err()
+}
+
+// churnPeakBytes estimates the heap that a request needs at its peak, were
+// no instance or app ever deleted.
+func churnPeakBytes(req models.ChurnRequest) float64 {
+	apps := float64(req.NumApps) + float64(req.DurationSeconds)*req.PushesPerSecond
+	samples := req.DurationSeconds / req.SampleIntervalSeconds
+	return churnBytesPerInstance*churnExpectedInstances(req) +
+		churnBytesPerApp*apps +
+		churnBytesPerPolicy*apps*req.MeanPoliciesPerApp +
+		churnBytesPerLoad*float64(samples*req.NumHosts)
+}
+
+// churnExpectedInstances counts the initial instances and those that each
+// push, scale or restart places, an app's worth on average.
+func churnExpectedInstances(req models.ChurnRequest) float64 {
+	placingEvents := float64(req.DurationSeconds) * (req.PushesPerSecond + req.ScalesPerSecond + req.RestartsPerSecond)
+	return (float64(req.NumApps) + placingEvents) * float64(req.MeanInstancesPerApp)
+}
@@ -0,0 +1,248 @@
+package simulate_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Churn simulator", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.Churn
+		logger              *lagertest.TestLogger
+		req                 models.ChurnRequest
+	)
+
+	var sumInts = func(values []int) int {
+		total := 0
+		for _, v := range values {
+			total += v
+		}
+		return total
+	}
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		sim = &simulate.Churn{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.ChurnRequest{
+			NumHosts:              20,
+			NumApps:               100,
+			MeanInstancesPerApp:   3,
+			MeanPoliciesPerApp:    1,
+			DurationSeconds:       600,
+			SampleIntervalSeconds: 60,
+			PushesPerSecond:       0.5,
+			ScalesPerSecond:       0.5,
+			RestartsPerSecond:     0.5,
+			DeletesPerSecond:      0.5,
+		}
+	})
+
+	Describe("Execute", func() {
+		It("logs the structured request", func() {
+			_, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger.Buffer()).To(gbytes.Say(`start.*input`))
+			Expect(logger.Buffer()).To(gbytes.Say(`success`))
+		})
+
+		It("samples the instances per host at every interval", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Samples).To(HaveLen(10))
+			for i, sample := range resp.Samples {
+				Expect(sample.Time).To(Equal(60 * (i + 1)))
+				Expect(sample.InstancesPerHost).To(HaveLen(req.NumHosts))
+			}
+		})
+
+		It("runs each kind of event at roughly its configured rate", func() {
+			req.DurationSeconds = 4000
+			req.SampleIntervalSeconds = 400
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, count := range []int{resp.Events.Pushes, resp.Events.Scales, resp.Events.Restarts, resp.Events.Deletes} {
+				Expect(count).To(BeNumerically("~", 2000, 300))
+			}
+		})
+
+		It("reports change rates and peaks", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var sawInstanceChanges, sawRuleChanges bool
+			for _, sample := range resp.Samples {
+				Expect(sample.InstanceChangesPerSecond).To(BeNumerically("<=", resp.PeakInstanceChangesPerSecond))
+				Expect(sample.PolicyRuleChangesPerSecond).To(BeNumerically("<=", resp.PeakPolicyRuleChangesPerSecond))
+				sawInstanceChanges = sawInstanceChanges || sample.InstanceChangesPerSecond > 0
+				sawRuleChanges = sawRuleChanges || sample.PolicyRuleChangesPerSecond > 0
+			}
+			Expect(sawInstanceChanges).To(BeTrue())
+			Expect(sawRuleChanges).To(BeTrue())
+		})
+
+		It("does not count the initial population as changes", func() {
+			req.PushesPerSecond = 0
+			req.ScalesPerSecond = 0
+			req.RestartsPerSecond = 0
+			req.DeletesPerSecond = 0
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resp.PeakInstanceChangesPerSecond).To(Equal(0))
+			Expect(resp.PeakPolicyRuleChangesPerSecond).To(Equal(0))
+			first := sumInts(resp.Samples[0].InstancesPerHost)
+			Expect(first).To(BeNumerically(">=", req.NumApps))
+			for _, sample := range resp.Samples {
+				Expect(sumInts(sample.InstancesPerHost)).To(Equal(first))
+			}
+		})
+
+		It("removes every instance when only deletes occur", func() {
+			req.PushesPerSecond = 0
+			req.ScalesPerSecond = 0
+			req.RestartsPerSecond = 0
+			req.DeletesPerSecond = 10
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			last := resp.Samples[len(resp.Samples)-1]
+			Expect(sumInts(last.InstancesPerHost)).To(Equal(0))
+		})
+
+		It("is reproducible given a seed", func() {
+			req.Seed = 7
+			first, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).To(Equal(first))
+		})
+
+		Context("when the context is done", func() {
+			var (
+				ctx    context.Context
+				cancel context.CancelFunc
+			)
+
+			BeforeEach(func() {
+				ctx, cancel = context.WithCancel(context.Background())
+			})
+
+			It("passes the context to the distribution", func() {
+				sim.Execute(ctx, logger, req)
+				sampleCtx, _, _ := appSizeDistribution.SampleArgsForCall(0)
+				Expect(sampleCtx).To(Equal(ctx))
+			})
+
+			It("gives up between events", func() {
+				req.PushesPerSecond = 0
+				req.ScalesPerSecond = 0
+				cancel()
+				_, err := sim.Execute(ctx, logger, req)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(appSizeDistribution.SampleCallCount()).To(Equal(req.NumApps))
+			})
+		})
+
+		Context("when sampling from the app size distribution fails", func() {
+			BeforeEach(func() {
+				appSizeDistribution.SampleReturns(0, errors.New("banana"))
+			})
+
+			It("wraps and returns the error", func() {
+				_, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).To(MatchError("sampling app size: banana"))
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("returns nil when values are within their allowed ranges", func() {
+			Expect(sim.Validate(req)).To(Succeed())
+		})
+
+		It("returns an error when values are out of range", func() {
+			bad := req
+			bad.DurationSeconds = 0
+			Expect(sim.Validate(bad)).To(MatchError("DurationSeconds must be 1 - 86400"))
+
+			bad = req
+			bad.SampleIntervalSeconds = 601
+			Expect(sim.Validate(bad)).To(MatchError("SampleIntervalSeconds must be 1 - 600"))
+
+			bad = req
+			bad.DurationSeconds = 2000
+			bad.SampleIntervalSeconds = 1
+			Expect(sim.Validate(bad)).To(MatchError("DurationSeconds / SampleIntervalSeconds must be at most 1000"))
+
+			bad = req
+			bad.RestartsPerSecond = -1
+			Expect(sim.Validate(bad)).To(MatchError("RestartsPerSecond must be 0 - 100"))
+
+			bad = req
+			bad.DurationSeconds = 86400
+			bad.SampleIntervalSeconds = 3600
+			Expect(sim.Validate(bad)).To(MatchError("expected number of events must be at most 100000"))
+		})
+
+		It("bounds the instances that the events place, not just their number", func() {
+			bad := req
+			bad.NumHosts = 1000
+			bad.NumApps = 1000
+			bad.MeanInstancesPerApp = 100
+			bad.DurationSeconds = 1000
+			bad.SampleIntervalSeconds = 1000
+			bad.PushesPerSecond = 100
+			bad.ScalesPerSecond, bad.RestartsPerSecond, bad.DeletesPerSecond = 0, 0, 0
+			Expect(sim.Validate(bad)).To(MatchError("expected number of instances placed must be at most 5242880"))
+
+			bad.MeanInstancesPerApp = 90
+			bad.PushesPerSecond = 38
+			bad.MeanPoliciesPerApp = 10
+			Expect(sim.Validate(bad)).To(Succeed())
+		})
+
+		It("bounds the memory that apps, policies and samples need too", func() {
+			bad := req
+			bad.NumHosts = 1000
+			bad.NumApps = 20000
+			bad.MeanInstancesPerApp = 10
+			bad.MeanPoliciesPerApp = 10
+			bad.DurationSeconds = 1000
+			bad.SampleIntervalSeconds = 1
+			bad.PushesPerSecond, bad.ScalesPerSecond, bad.RestartsPerSecond, bad.DeletesPerSecond = 0, 0, 0, 0
+			Expect(sim.Validate(bad)).To(Succeed())
+
+			bad.NumApps = 30000
+			Expect(sim.Validate(bad)).To(MatchError("expected peak memory of 21 MB must be at most 20 MB; lower NumApps, MeanPoliciesPerApp, PushesPerSecond or the number of samples"))
+		})
+
+		It("reports every invalid field at once", func() {
+			bad := req
+			bad.NumHosts = 0
+			bad.DurationSeconds = 0
+			bad.PushesPerSecond = 101
+
+			err := sim.Validate(bad)
+			Expect(err).To(MatchError("NumHosts must be 1 - 1000; DurationSeconds must be 1 - 86400; PushesPerSecond must be 0 - 100"))
+			Expect(err).To(BeAssignableToTypeOf(models.ValidationError{}))
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package simulate
+
+import (
+	"math"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// The cost of a request is an estimate of the most heap, in bytes, that
+// simulating it takes, as the handler benchmarks measure it with GOGC=25.
+// It is meant for requests that have passed validation.
+
+const (
+	steadyStateBytesPerHost     = 256
+	steadyStateBytesPerApp      = 8
+	steadyStateBytesPerInstance = 3
+	steadyStateBytesPerPolicy   = 2
+
+	// the summary metrics that a batch keeps of each trial, or a sweep of
+	// each point
+	summaryBytes = 2048
+)
+
+func (s *SteadyState) Cost(req models.SteadyStateRequest) int64 {
+	return toCost(s.cost(req))
+}
+
+// Cost counts a whole trial for each worker, since each holds one in memory
+// at a time.
+func (b *Batch) Cost(req models.BatchRequest) int64 {
+	running := minInt(numWorkers(b.Workers), req.Trials)
+	return toCost(float64(running)*b.SteadyState.cost(req.SteadyStateRequest) + float64(req.Trials)*summaryBytes)
+}
+
+// Cost counts the largest point for each worker, since each holds one in
+// memory at a time.
+func (s *Sweep) Cost(req models.SweepRequest) int64 {
+	_, pointReqs, err := sweepPoints(req)
+	if err != nil {
+		return 0
+	}
+	largest := 0.0
+	for _, pointReq := range pointReqs {
+		largest = math.Max(largest, s.SteadyState.cost(pointReq))
+	}
+	running := minInt(numWorkers(s.Workers), len(pointReqs))
+	return toCost(float64(running)*largest + float64(len(pointReqs))*summaryBytes)
+}
+
+func (c *Churn) Cost(req models.ChurnRequest) int64 {
+	return toCost(churnPeakBytes(req))
+}
+
+// cost leaves out the instances on failed hosts, since placing them again
+// takes little more memory. It is never less than the resultSize of the
+// request, which is part of the peak.
+func (s *SteadyState) cost(req models.SteadyStateRequest) float64 {
+	req, _ = withHostClasses(req)
+	instances := float64(req.NumApps) * s.meanInstancesPerApp(req)
+	policies := float64(req.NumApps) * req.MeanPoliciesPerApp
+	return steadyStateBytesPerHost*float64(req.NumHosts) +
+		steadyStateBytesPerApp*float64(req.NumApps) +
+		steadyStateBytesPerInstance*instances +
+		steadyStateBytesPerPolicy*policies
+}
+
+func toCost(cost float64) int64 {
+	return int64(math.Ceil(cost))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
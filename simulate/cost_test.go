@@ -0,0 +1,114 @@
+package simulate_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Cost", func() {
+	var (
+		steadyState *simulate.SteadyState
+		req         models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		steadyState = &simulate.SteadyState{}
+		req = models.SteadyStateRequest{
+			NumHosts:            100,
+			NumApps:             300,
+			MeanInstancesPerApp: 5,
+		}
+	})
+
+	Describe("of a steady state simulation", func() {
+		It("counts the bytes of the hosts, the apps and the expected instances", func() {
+			Expect(steadyState.Cost(req)).To(Equal(int64(100*256 + 300*8 + 1500*3)))
+		})
+
+		It("counts the bytes of the expected policies", func() {
+			req.MeanPoliciesPerApp = 1.5
+			Expect(steadyState.Cost(req)).To(Equal(int64(100*256 + 300*8 + 1500*3 + 450*2)))
+		})
+
+		It("does not count the instances on failed hosts again", func() {
+			req.FailedHostFraction = 0.1
+			Expect(steadyState.Cost(req)).To(Equal(int64(100*256 + 300*8 + 1500*3)))
+		})
+
+		It("counts the hosts of every host class", func() {
+			req.NumHosts = 0
+			req.HostClasses = []models.HostClass{{Count: 30, Slots: 100}, {Count: 70, Slots: 100}}
+			Expect(steadyState.Cost(req)).To(Equal(int64(100*256 + 300*8 + 1500*3)))
+		})
+	})
+
+	Describe("of a batch", func() {
+		var batch *simulate.Batch
+
+		BeforeEach(func() {
+			batch = &simulate.Batch{SteadyState: steadyState}
+		})
+
+		It("counts one trial in memory, and the summary of every trial", func() {
+			Expect(batch.Cost(models.BatchRequest{SteadyStateRequest: req, Trials: 4})).To(Equal(int64(32500 + 4*2048)))
+		})
+
+		It("counts a trial in memory for each worker", func() {
+			batch.Workers = 3
+			Expect(batch.Cost(models.BatchRequest{SteadyStateRequest: req, Trials: 4})).To(Equal(int64(3*32500 + 4*2048)))
+
+			batch.Workers = 8
+			Expect(batch.Cost(models.BatchRequest{SteadyStateRequest: req, Trials: 4})).To(Equal(int64(4*32500 + 4*2048)))
+		})
+	})
+
+	Describe("of a sweep", func() {
+		var (
+			sweep    *simulate.Sweep
+			sweepReq models.SweepRequest
+		)
+
+		BeforeEach(func() {
+			sweep = &simulate.Sweep{SteadyState: steadyState}
+			sweepReq = models.SweepRequest{
+				SteadyStateRequest: req,
+				Parameter:          "NumApps",
+				From:               100,
+				To:                 300,
+				Step:               100,
+			}
+		})
+
+		It("counts the largest point in memory, and the summary of every point", func() {
+			Expect(sweep.Cost(sweepReq)).To(Equal(int64(32500 + 3*2048)))
+		})
+
+		It("counts the largest point in memory for each worker", func() {
+			sweep.Workers = 2
+			Expect(sweep.Cost(sweepReq)).To(Equal(int64(2*32500 + 3*2048)))
+		})
+
+		It("is zero when the sweep is invalid", func() {
+			Expect(sweep.Cost(models.SweepRequest{SteadyStateRequest: req, Parameter: "banana"})).To(BeZero())
+		})
+	})
+
+	It("of churn counts the instances, apps, policies and sampled loads it holds at its peak", func() {
+		churn := &simulate.Churn{}
+		cost := churn.Cost(models.ChurnRequest{
+			NumHosts:              100,
+			NumApps:               300,
+			MeanInstancesPerApp:   5,
+			MeanPoliciesPerApp:    2,
+			DurationSeconds:       10,
+			SampleIntervalSeconds: 5,
+			PushesPerSecond:       2,
+			ScalesPerSecond:       1,
+			RestartsPerSecond:     0.5,
+			DeletesPerSecond:      1,
+		})
+		Expect(cost).To(Equal(int64((1500+35*5)*4 + 320*96 + 640*8 + 2*100*16)))
+	})
+})
@@ -0,0 +1,110 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+func numFailedHosts(req models.SteadyStateRequest) (int, error) {
+	if req.FailedHosts != 0 && req.FailedHostFraction != 0 {
+		return 0, fieldError("FailedHosts", "exclusive", req.FailedHosts, "at most one of FailedHosts and FailedHostFraction may be set")
+	}
+	if err := validateFloatRange("FailedHostFraction", req.FailedHostFraction, 0, 1); err != nil {
+		return 0, err
+	}
+	failed := req.FailedHosts
+	if req.FailedHostFraction != 0 {
+		failed = int(math.Floor(req.FailedHostFraction*float64(req.NumHosts) + 0.5))
+	}
+	if failed < 0 || failed > req.NumHosts-1 {
+		return 0, rangeError("FailedHosts", failed, 0, float64(req.NumHosts-1),
+			fmt.Sprintf("at least one host must survive: FailedHosts must be 0 - %d", req.NumHosts-1))
+	}
+	return failed, nil
+}
+
+// populateEvacuation fails hosts at random and re-places their instances
+// onto the surviving hosts using the placement strategy, with the surviving
+// instances left where they are.
+func (s *SteadyState) populateEvacuation(ctx context.Context, rng *rand.Rand, strategy placementStrategy, p *progress, numFailed int, instances *instanceSet, appMemoryMB []int, resp *models.SteadyStateResponse) error {
+	req := resp.Request
+
+	failedHostIds := rng.Perm(req.NumHosts)[:numFailed]
+	sort.Ints(failedHostIds)
+	failed := make(map[int]bool, numFailed)
+	for _, id := range failedHostIds {
+		failed[id] = true
+	}
+
+	survivingHostIds := make([]int, 0, req.NumHosts-numFailed)
+	for id := 0; id < req.NumHosts; id++ {
+		if !failed[id] {
+			survivingHostIds = append(survivingHostIds, id)
+		}
+	}
+
+	c := newCluster(rng, survivingHostIds)
+	limitCluster(c, req, appMemoryMB)
+	c.setZones(req.NumZones)
+	// the surviving instances stay put, then the evacuees move in order
+	for appId := 0; appId < instances.numApps(); appId++ {
+		for _, hostId := range instances.ofApp(appId) {
+			if !failed[int(hostId)] {
+				c.assign(appId, int(hostId))
+			}
+		}
+		c.forget(appId)
+	}
+	moved, unplaced := 0, 0
+	for appId := 0; appId < instances.numApps(); appId++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.step()
+		hostIds := instances.ofApp(appId)
+		moving := 0
+		for _, hostId := range hostIds {
+			if failed[int(hostId)] {
+				moving++
+			} else {
+				c.count(appId, int(hostId), 1)
+			}
+		}
+		for i := 0; i < moving; i++ {
+			hostId, ok := strategy.place(c, appId)
+			if !ok {
+				unplaced++
+				continue
+			}
+			c.assign(appId, hostId)
+			moved++
+		}
+		c.forget(appId)
+	}
+
+	instancesPerHost := make([]int, req.NumHosts)
+	survivingLoads := c.loads()
+	hostsOverCapacity := 0
+	for i, id := range survivingHostIds {
+		instancesPerHost[id] = survivingLoads[i]
+		if req.HostCapacity > 0 && survivingLoads[i] > req.HostCapacity {
+			hostsOverCapacity++
+		}
+	}
+
+	resp.Evacuation = &models.EvacuationStats{
+		FailedHostIds:     failedHostIds,
+		InstancesMoved:    moved,
+		InstancesPerHost:  instancesPerHost,
+		Instances:         summarize(survivingLoads),
+		HostCapacity:      req.HostCapacity,
+		HostsOverCapacity: hostsOverCapacity,
+		UnplacedInstances: unplaced,
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Host failure and evacuation", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            100,
+			NumApps:             1000,
+			MeanInstancesPerApp: 5,
+			FailedHosts:         10,
+		}
+	})
+
+	It("is skipped when no hosts fail", func() {
+		req.FailedHosts = 0
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Evacuation).To(BeNil())
+	})
+
+	It("moves every instance off the failed hosts", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		evacuation := resp.Evacuation
+		Expect(evacuation.FailedHostIds).To(HaveLen(10))
+
+		expectedMoved := 0
+		for _, hostId := range evacuation.FailedHostIds {
+			expectedMoved += resp.HostStats.InstancesPerHost[hostId]
+			Expect(evacuation.InstancesPerHost[hostId]).To(Equal(0))
+		}
+		Expect(evacuation.InstancesMoved).To(Equal(expectedMoved))
+
+		total := 0
+		for _, count := range evacuation.InstancesPerHost {
+			total += count
+		}
+		Expect(total).To(Equal(resp.TotalInstances))
+	})
+
+	It("keeps the surviving hosts balanced with a load-aware strategy", func() {
+		req.PlacementStrategy = "least-loaded"
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Evacuation.Instances.Max - resp.Evacuation.Instances.Min).To(BeNumerically("<=", 1))
+		Expect(resp.Evacuation.Instances.Mean).To(BeNumerically("~", float64(resp.TotalInstances)/90, 1e-9))
+	})
+
+	It("fails a fraction of the hosts", func() {
+		req.FailedHosts = 0
+		req.FailedHostFraction = 0.25
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Evacuation.FailedHostIds).To(HaveLen(25))
+	})
+
+	It("counts the hosts over capacity after evacuation", func() {
+		req.PlacementStrategy = "least-loaded"
+		req.Seed = 17
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		max := resp.Evacuation.Instances.Max
+
+		req.HostCapacity = max
+		resp, err = sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Evacuation.HostCapacity).To(Equal(max))
+		Expect(resp.Evacuation.HostsOverCapacity).To(Equal(0))
+
+		req.HostCapacity = max - 1
+		resp, err = sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Evacuation.HostsOverCapacity).To(BeNumerically(">", 0))
+	})
+
+	It("counts only the instances it places as moved", func() {
+		req.NumHosts = 0
+		req.HostClasses = []models.HostClass{{Count: 10, Slots: 6}}
+		req.NumApps = 12
+		appSizeDistribution.SampleReturns(4, nil)
+		req.FailedHosts = 5
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("fitting 30 of the 48 instances on the surviving hosts")
+		evacuation := resp.Evacuation
+		Expect(evacuation.UnplacedInstances).To(Equal(18))
+		onFailedHosts := 0
+		for _, hostId := range evacuation.FailedHostIds {
+			onFailedHosts += resp.HostStats.InstancesPerHost[hostId]
+		}
+		Expect(evacuation.InstancesMoved).To(Equal(onFailedHosts - 18))
+	})
+
+	It("does not change the steady state placement", func() {
+		req.Seed = 3
+		withFailures, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.FailedHosts = 0
+		withoutFailures, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(withFailures.Instances).To(Equal(withoutFailures.Instances))
+	})
+
+	Describe("validation", func() {
+		It("requires at least one host to survive", func() {
+			req.FailedHosts = 100
+			Expect(sim.Validate(req)).To(MatchError("at least one host must survive: FailedHosts must be 0 - 99"))
+
+			req.FailedHosts = 0
+			req.FailedHostFraction = 1
+			Expect(sim.Validate(req)).To(MatchError("at least one host must survive: FailedHosts must be 0 - 99"))
+		})
+
+		It("rejects setting both a number and a fraction of hosts", func() {
+			req.FailedHostFraction = 0.1
+			Expect(sim.Validate(req)).To(MatchError("at most one of FailedHosts and FailedHostFraction may be set"))
+		})
+
+		It("rejects fractions out of range", func() {
+			req.FailedHosts = 0
+			req.FailedHostFraction = 1.5
+			Expect(sim.Validate(req)).To(MatchError("FailedHostFraction must be 0 - 1"))
+		})
+	})
+})
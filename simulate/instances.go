@@ -0,0 +1,138 @@
+package simulate
+
+import (
+	"context"
+	"math"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// instanceSet records the host of every placed instance. Instances are
+// numbered in order of app, so only their hosts need to be stored, and a
+// uint16 holds the id of any of the at most maxHosts hosts.
+type instanceSet struct {
+	hostIds  []uint16
+	appStart []int // the first instance of each app, then the total
+}
+
+func newInstanceSet(numApps, expectedInstances int) *instanceSet {
+	return &instanceSet{
+		hostIds:  make([]uint16, 0, expectedInstances),
+		appStart: make([]int, numApps+1),
+	}
+}
+
+func (s *instanceSet) len() int {
+	return len(s.hostIds)
+}
+
+func (s *instanceSet) numApps() int {
+	return len(s.appStart) - 1
+}
+
+// startApp must be called for each app in turn, before adding its instances.
+func (s *instanceSet) startApp(appId int) {
+	s.appStart[appId] = len(s.hostIds)
+	s.appStart[appId+1] = len(s.hostIds)
+}
+
+func (s *instanceSet) add(appId, hostId int) {
+	s.hostIds = append(s.hostIds, uint16(hostId))
+	s.appStart[appId+1] = len(s.hostIds)
+}
+
+// ofApp returns the hosts of the app's instances.
+func (s *instanceSet) ofApp(appId int) []uint16 {
+	return s.hostIds[s.appStart[appId]:s.appStart[appId+1]]
+}
+
+// steadyStateRun is the outcome of a simulation whose apps, instances and
+// policies have not yet been materialized.
+type steadyStateRun struct {
+	resp      *models.SteadyStateResponse // without Apps, Instances or Policies
+	apps      *appSource
+	instances *instanceSet
+	policies  *policySource
+	ipam      *ipamConfig
+}
+
+// numInstances is zero for a nil run, which a failed simulation returns.
+func (r *steadyStateRun) numInstances() int {
+	if r == nil {
+		return 0
+	}
+	return r.instances.len()
+}
+
+// runIntsPerHost is about the number of lists per host in the statistics of
+// a steady state response.
+const runIntsPerHost = 8
+
+// size estimates the bytes that the run holds on to: the host of each
+// instance, the first instance of each app, and the few lists per host in
+// the statistics of the response. It is zero for a nil run.
+func (r *steadyStateRun) size() int {
+	if r == nil {
+		return 0
+	}
+	return 2*cap(r.instances.hostIds) + 8*len(r.instances.appStart) + 8*runIntsPerHost*r.resp.Request.NumHosts
+}
+
+// resultSize estimates the size of the run of a request before simulating
+// it, from the expected number of instances.
+func (s *SteadyState) resultSize(req models.SteadyStateRequest) int {
+	req, _ = withHostClasses(req)
+	instances := float64(req.NumApps) * s.meanInstancesPerApp(req)
+	return int(math.Ceil(2*instances)) + 8*(req.NumApps+1) + 8*runIntsPerHost*req.NumHosts
+}
+
+// eachInstance materializes the instances one at a time, in order, giving
+// each the next free address of its host when there is an overlay.
+func (r *steadyStateRun) eachInstance(ctx context.Context, f func(models.Instance) error) error {
+	req := r.resp.Request
+	var nextOffset []int
+	if r.ipam != nil {
+		nextOffset = make([]int, req.NumHosts)
+	}
+
+	id := 0
+	for appId := 0; appId < r.instances.numApps(); appId++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, hostId := range r.instances.ofApp(appId) {
+			instance := models.Instance{
+				Id:     id,
+				AppId:  appId,
+				HostId: int(hostId),
+				Zone:   zoneOf(int(hostId), req.NumZones),
+			}
+			if r.ipam != nil {
+				instance.IP = r.ipam.instanceIP(instance.HostId, nextOffset[hostId])
+				nextOffset[hostId]++
+			}
+			if err := f(instance); err != nil {
+				return err
+			}
+			id++
+		}
+	}
+	return nil
+}
+
+// write hands the response to out in pieces, until ctx is done.
+func (r *steadyStateRun) write(ctx context.Context, out models.SteadyStateWriter) error {
+	if err := out.WriteSummary(r.resp); err != nil {
+		return err
+	}
+	if err := r.apps.each(ctx, out.WriteApp); err != nil {
+		return err
+	}
+	if err := r.eachInstance(ctx, out.WriteInstance); err != nil {
+		return err
+	}
+	if err := r.policies.each(ctx, out.WritePolicy); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,130 @@
+package simulate
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	DefaultHostSubnetPrefixLength = 24
+	maxHostSubnetPrefixLength     = 30
+
+	// the network address, gateway and broadcast address of each host subnet
+	// cannot be given to instances
+	reservedAddressesPerSubnet = 3
+)
+
+type ipamConfig struct {
+	overlay      *net.IPNet
+	prefixLength int
+}
+
+func parseIPAMConfig(req models.SteadyStateRequest) (*ipamConfig, error) {
+	if req.OverlayCIDR == "" {
+		if req.HostSubnetPrefixLength != 0 {
+			return nil, fieldError("HostSubnetPrefixLength", "requires", req.HostSubnetPrefixLength, "HostSubnetPrefixLength requires OverlayCIDR")
+		}
+		return nil, nil
+	}
+
+	_, overlay, err := net.ParseCIDR(req.OverlayCIDR)
+	if err != nil || overlay.IP.To4() == nil {
+		return nil, fieldError("OverlayCIDR", "format", req.OverlayCIDR, "OverlayCIDR must be an IPv4 CIDR")
+	}
+	overlayPrefixLength, bits := overlay.Mask.Size()
+	if bits != 32 { // an IPv4-mapped IPv6 CIDR, such as ::ffff:10.0.0.0/104
+		return nil, fieldError("OverlayCIDR", "format", req.OverlayCIDR, "OverlayCIDR must be an IPv4 CIDR")
+	}
+
+	prefixLength := req.HostSubnetPrefixLength
+	if prefixLength == 0 {
+		prefixLength = DefaultHostSubnetPrefixLength
+	}
+	if err := validateRange("HostSubnetPrefixLength", prefixLength, overlayPrefixLength, maxHostSubnetPrefixLength); err != nil {
+		return nil, err
+	}
+
+	config := &ipamConfig{overlay: overlay, prefixLength: prefixLength}
+	if config.numSubnets() < req.NumHosts {
+		return nil, fieldError("OverlayCIDR", "limit", req.OverlayCIDR,
+			"OverlayCIDR %s only has room for %d /%d subnets, fewer than NumHosts", overlay, config.numSubnets(), prefixLength)
+	}
+	return config, nil
+}
+
+func (c *ipamConfig) numSubnets() int {
+	overlayPrefixLength, _ := c.overlay.Mask.Size()
+	return 1 << uint(c.prefixLength-overlayPrefixLength)
+}
+
+func (c *ipamConfig) subnetSize() int {
+	return 1 << uint(32-c.prefixLength)
+}
+
+func (c *ipamConfig) subnetBase(hostId int) uint32 {
+	return binary.BigEndian.Uint32(c.overlay.IP.To4()) + uint32(hostId*c.subnetSize())
+}
+
+func (c *ipamConfig) usablePerHost() int {
+	return c.subnetSize() - reservedAddressesPerSubnet
+}
+
+// instanceIP returns the address of the host's instance at the offset among
+// those given addresses, after the network address and gateway, or nothing
+// when the subnet is exhausted.
+func (c *ipamConfig) instanceIP(hostId, offset int) string {
+	if offset >= c.usablePerHost() {
+		return ""
+	}
+	return uint32ToIP(c.subnetBase(hostId) + uint32(offset+2)).String()
+}
+
+func uint32ToIP(addr uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, addr)
+	return ip
+}
+
+// populateIPAM gives each host the subnet matching its id. Each instance
+// takes the next free address in the subnet of its host, as given by
+// instanceIP, so instances on a host whose subnet is exhausted are left
+// without an IP.
+func (s *SteadyState) populateIPAM(config *ipamConfig, resp *models.SteadyStateResponse) {
+	numHosts := resp.Request.NumHosts
+	usablePerHost := config.usablePerHost()
+
+	hostSubnets := make([]string, numHosts)
+	for hostId := range hostSubnets {
+		subnet := net.IPNet{
+			IP:   uint32ToIP(config.subnetBase(hostId)),
+			Mask: net.CIDRMask(config.prefixLength, 32),
+		}
+		hostSubnets[hostId] = subnet.String()
+	}
+
+	placed, addressed := 0, 0
+	overflowingHosts := []int{}
+	for hostId, count := range resp.HostStats.InstancesPerHost {
+		placed += count
+		if count > usablePerHost {
+			overflowingHosts = append(overflowingHosts, hostId)
+			count = usablePerHost
+		}
+		addressed += count
+	}
+
+	allocated := numHosts * usablePerHost
+	resp.IPAM = &models.IPAMStats{
+		OverlayCIDR:            config.overlay.String(),
+		HostSubnetPrefixLength: config.prefixLength,
+		HostSubnets:            hostSubnets,
+		AddressesPerHost:       usablePerHost,
+		OverflowingHosts:       overflowingHosts,
+		UnaddressedInstances:   placed - addressed,
+		AddressesAllocated:     allocated,
+		AddressesUsed:          addressed,
+		AddressesWasted:        allocated - addressed,
+	}
+}
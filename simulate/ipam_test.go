@@ -0,0 +1,136 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+	"net"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("IPAM", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            100,
+			NumApps:             1000,
+			MeanInstancesPerApp: 5,
+			OverlayCIDR:         "10.255.0.0/16",
+		}
+	})
+
+	It("is skipped when no overlay CIDR is requested", func() {
+		req.OverlayCIDR = ""
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.IPAM).To(BeNil())
+		for _, instance := range resp.Instances {
+			Expect(instance.IP).To(BeEmpty())
+		}
+	})
+
+	It("carves the overlay into /24 host subnets by default", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.IPAM.HostSubnetPrefixLength).To(Equal(24))
+		Expect(resp.IPAM.HostSubnets).To(HaveLen(100))
+		Expect(resp.IPAM.HostSubnets[0]).To(Equal("10.255.0.0/24"))
+		Expect(resp.IPAM.HostSubnets[99]).To(Equal("10.255.99.0/24"))
+		Expect(resp.IPAM.AddressesPerHost).To(Equal(253))
+	})
+
+	It("gives every instance a unique IP within its host's subnet", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		seen := make(map[string]bool)
+		for _, instance := range resp.Instances {
+			Expect(seen[instance.IP]).To(BeFalse())
+			seen[instance.IP] = true
+
+			_, subnet, err := net.ParseCIDR(resp.IPAM.HostSubnets[instance.HostId])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnet.Contains(net.ParseIP(instance.IP))).To(BeTrue())
+		}
+
+		Expect(resp.IPAM.OverflowingHosts).To(BeEmpty())
+		Expect(resp.IPAM.AddressesUsed).To(Equal(resp.TotalInstances))
+		Expect(resp.IPAM.AddressesAllocated).To(Equal(100 * 253))
+		Expect(resp.IPAM.AddressesWasted).To(Equal(100*253 - resp.TotalInstances))
+	})
+
+	Context("when a host has more instances than its subnet can address", func() {
+		BeforeEach(func() {
+			req.NumHosts = 2
+			req.NumApps = 1
+			req.HostSubnetPrefixLength = 30
+			appSizeDistribution.SampleReturns(3, nil)
+		})
+
+		It("flags the host and leaves the extra instances without an IP", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resp.Instances[0].IP).To(Equal("10.255.0.2"))
+			Expect(resp.Instances[1].IP).To(Equal("10.255.0.6"))
+			Expect(resp.Instances[2].IP).To(BeEmpty())
+
+			Expect(resp.IPAM.OverflowingHosts).To(Equal([]int{0}))
+			Expect(resp.IPAM.UnaddressedInstances).To(Equal(1))
+			Expect(resp.IPAM.AddressesAllocated).To(Equal(2))
+			Expect(resp.IPAM.AddressesUsed).To(Equal(2))
+			Expect(resp.IPAM.AddressesWasted).To(Equal(0))
+		})
+	})
+
+	Describe("validation", func() {
+		It("requires an IPv4 CIDR", func() {
+			req.OverlayCIDR = "banana"
+			Expect(sim.Validate(req)).To(MatchError("OverlayCIDR must be an IPv4 CIDR"))
+
+			req.OverlayCIDR = "fd00::/64"
+			Expect(sim.Validate(req)).To(MatchError("OverlayCIDR must be an IPv4 CIDR"))
+
+			req.OverlayCIDR = "::ffff:10.0.0.0/104"
+			Expect(sim.Validate(req)).To(MatchError("OverlayCIDR must be an IPv4 CIDR"))
+		})
+
+		It("requires the host prefix to fit inside the overlay", func() {
+			req.HostSubnetPrefixLength = 15
+			Expect(sim.Validate(req)).To(MatchError("HostSubnetPrefixLength must be 16 - 30"))
+
+			req.HostSubnetPrefixLength = 31
+			Expect(sim.Validate(req)).To(MatchError("HostSubnetPrefixLength must be 16 - 30"))
+		})
+
+		It("requires a subnet for every host", func() {
+			req.NumHosts = 257
+			Expect(sim.Validate(req)).To(MatchError("OverlayCIDR 10.255.0.0/16 only has room for 256 /24 subnets, fewer than NumHosts"))
+		})
+
+		It("requires an overlay CIDR when a host prefix is given", func() {
+			req.OverlayCIDR = ""
+			req.HostSubnetPrefixLength = 24
+			Expect(sim.Validate(req)).To(MatchError("HostSubnetPrefixLength requires OverlayCIDR"))
+		})
+	})
+})
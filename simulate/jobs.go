@@ -0,0 +1,419 @@
+package simulate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	defaultJobWorkers       = 1
+	defaultMaxJobs          = 100
+	defaultJobRetention     = 10 * time.Minute
+	defaultMaxRetainedBytes = 16 << 20 // more than the result of the largest request
+)
+
+// progress follows a simulation app by app. A nil progress does nothing, so
+// that simulations outside of a job need not report.
+type progress struct {
+	done  int64 // updated atomically
+	total int64
+}
+
+func (p *progress) start(total int) {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt64(&p.total, int64(total))
+}
+
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.done, 1)
+}
+
+func (p *progress) fraction() float64 {
+	total := atomic.LoadInt64(&p.total)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&p.done)) / float64(total)
+}
+
+type admitter interface {
+	Admit(cost int64) (func(), error)
+	Fits(cost int64) error
+	RetryAfter() time.Duration
+}
+
+// Jobs runs steady-state simulations in the background, on a pool of
+// Workers. It holds at most MaxJobs jobs, whether queued, running or
+// finished, and forgets each finished job once Retention has passed. The
+// results of the jobs it holds take at most about MaxRetainedBytes between
+// them, counting the estimated result of each job not yet finished. Given an
+// Admission, a job stays queued until its cost is admitted, releases it once
+// it finishes, apart from its result, and releases that once it is
+// forgotten; a job that costs more than the whole budget fails.
+type Jobs struct {
+	SteadyState      *SteadyState
+	Admission        admitter      // optional
+	Workers          int           // defaults to 1
+	MaxJobs          int           // defaults to 100
+	Retention        time.Duration // defaults to 10 minutes
+	MaxRetainedBytes int           // defaults to 16 MB
+
+	startOnce sync.Once
+
+	lock     sync.Mutex
+	jobs     map[string]*job
+	pending  []*job     // queued jobs that no worker has taken
+	wake     *sync.Cond // signalled when a job is queued
+	retained int        // bytes in the results of jobs
+	reserved int        // bytes estimated for the results of unfinished jobs
+}
+
+type job struct {
+	logger      lager.Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
+	status      models.Job // guarded by Jobs.lock, apart from Progress
+	progress    progress
+	run         *steadyStateRun
+	resultBytes int // estimated, until the job finishes
+
+	cancelled     bool   // guarded by Jobs.lock
+	releaseResult func() // guarded by Jobs.lock
+}
+
+// Validate also rejects a request whose result would never fit within
+// MaxRetainedBytes.
+func (j *Jobs) Validate(req models.SteadyStateRequest) error {
+	if err := j.SteadyState.Validate(req); err != nil {
+		return err
+	}
+	if resultBytes := j.SteadyState.resultSize(req); resultBytes > j.maxRetainedBytes() {
+		return fieldError("", "limit", nil, "the result would take about %d bytes, more than the %d that jobs may retain",
+			resultBytes, j.maxRetainedBytes())
+	}
+	return nil
+}
+
+// Submit queues a simulation, returning an error if there are already
+// MaxJobs jobs, or its result would not fit with those of the others.
+func (j *Jobs) Submit(logger lager.Logger, req models.SteadyStateRequest) (models.Job, error) {
+	j.startOnce.Do(j.start)
+
+	id, err := newJobId()
+	if err != nil {
+		return models.Job{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	newJob := &job{
+		logger: logger.Session("job", lager.Data{"id": id}),
+		ctx:    ctx,
+		cancel: cancel,
+		status: models.Job{
+			Id:        id,
+			Status:    models.JobQueued,
+			Request:   req,
+			CreatedAt: time.Now(),
+		},
+		resultBytes:   j.SteadyState.resultSize(req),
+		releaseResult: func() {},
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.expire()
+	if len(j.jobs) >= j.maxJobs() {
+		cancel()
+		return models.Job{}, fmt.Errorf("at most %d jobs may be queued, running or retained", j.maxJobs())
+	}
+	if left := j.maxRetainedBytes() - j.retained - j.reserved; newJob.resultBytes > left {
+		cancel()
+		return models.Job{}, fmt.Errorf("the result would take about %d bytes, more than the %d left of the %d that jobs may retain",
+			newJob.resultBytes, left, j.maxRetainedBytes())
+	}
+	j.jobs[id] = newJob
+	j.reserved += newJob.resultBytes
+	j.pending = append(j.pending, newJob)
+	j.wake.Signal()
+	newJob.logger.Info("queued")
+	return newJob.snapshot(), nil
+}
+
+// Status returns the job, or false if there is no such job or it has
+// expired.
+func (j *Jobs) Status(id string) (models.Job, bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.expire()
+	found, ok := j.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	return found.snapshot(), true
+}
+
+// Cancel stops a queued or running job, or forgets a finished one. It
+// returns the job as it was left, or false if there is no such job.
+func (j *Jobs) Cancel(id string) (models.Job, bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.expire()
+	found, ok := j.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+
+	found.cancelled = true
+	found.cancel()
+	switch found.status.Status {
+	case models.JobQueued:
+		j.dequeue(found)
+		j.finish(found, models.JobCancelled)
+	case models.JobRunning:
+		// the worker finishes the job once the simulation gives up
+	default:
+		j.forget(id)
+	}
+	found.logger.Info("cancel", lager.Data{"status": found.status.Status})
+	return found.snapshot(), true
+}
+
+// WriteResult hands the result of a job that has succeeded to out, as
+// SteadyState.Stream does.
+func (j *Jobs) WriteResult(ctx context.Context, id string, out models.SteadyStateWriter) error {
+	j.lock.Lock()
+	j.expire()
+	found, ok := j.jobs[id]
+	var run *steadyStateRun
+	if ok {
+		run = found.run
+	}
+	j.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	if run == nil {
+		return fmt.Errorf("job %s has not succeeded", id)
+	}
+	return run.write(ctx, out)
+}
+
+func (j *Jobs) start() {
+	j.lock.Lock()
+	j.jobs = make(map[string]*job)
+	j.wake = sync.NewCond(&j.lock)
+	j.lock.Unlock()
+
+	workers := j.Workers
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go j.work()
+	}
+}
+
+func (j *Jobs) work() {
+	for {
+		next := j.next()
+		releaseRun, releaseResult, err := j.admit(next)
+
+		j.lock.Lock()
+		if next.status.Status != models.JobQueued {
+			j.lock.Unlock()
+			if err == nil {
+				releaseRun()
+				releaseResult()
+			}
+			continue // cancelled while queued
+		}
+		if err != nil {
+			next.status.Error = err.Error()
+			j.finish(next, models.JobFailed)
+			next.logger.Info("finished", lager.Data{"status": next.status.Status})
+			j.lock.Unlock()
+			continue
+		}
+		now := time.Now()
+		next.status.Status = models.JobRunning
+		next.status.StartedAt = &now
+		next.releaseResult = releaseResult
+		j.lock.Unlock()
+
+		run, err := j.SteadyState.simulate(next.ctx, next.logger.Session("execute"), next.status.Request, &next.progress)
+		next.cancel() // releases the context
+		releaseRun()
+
+		j.lock.Lock()
+		left := j.maxRetainedBytes() - j.retained - (j.reserved - next.resultBytes)
+		switch {
+		case next.cancelled:
+			j.finish(next, models.JobCancelled)
+		case err != nil:
+			next.status.Error = err.Error()
+			j.finish(next, models.JobFailed)
+		case run.size() > left:
+			next.status.Error = fmt.Sprintf("the result takes %d bytes, more than the %d left of the %d that jobs may retain",
+				run.size(), left, j.maxRetainedBytes())
+			j.finish(next, models.JobFailed)
+		default:
+			next.run = run
+			j.retained += run.size()
+			j.finish(next, models.JobSucceeded)
+		}
+		next.logger.Info("finished", lager.Data{"status": next.status.Status})
+		j.lock.Unlock()
+	}
+}
+
+// next waits for a queued job, and takes it.
+func (j *Jobs) next() *job {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for len(j.pending) == 0 {
+		j.wake.Wait()
+	}
+	next := j.pending[0]
+	j.pending[0] = nil
+	j.pending = j.pending[1:]
+	return next
+}
+
+// dequeue takes a job that no worker has taken yet out of the queue. It
+// must be called with lock held.
+func (j *Jobs) dequeue(queued *job) {
+	for i, pending := range j.pending {
+		if pending == queued {
+			j.pending = append(j.pending[:i], j.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// admit waits until the cost of the job is admitted. It admits the part of
+// the cost that the estimated result of the job takes apart from the rest,
+// since the job holds on to it once the simulation is done. It returns an
+// error if the job is cancelled first, or costs more than the whole budget.
+func (j *Jobs) admit(next *job) (releaseRun, releaseResult func(), err error) {
+	if j.Admission == nil {
+		return func() {}, func() {}, nil
+	}
+	cost := j.SteadyState.Cost(next.status.Request)
+	resultCost := int64(next.resultBytes)
+	if err := j.Admission.Fits(cost); err != nil {
+		return nil, nil, fmt.Errorf("admission: %s", err)
+	}
+	for {
+		if err := next.ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		releaseResult, err := j.Admission.Admit(resultCost)
+		if err == nil {
+			releaseRun, err = j.Admission.Admit(cost - resultCost)
+			if err == nil {
+				return releaseRun, releaseResult, nil
+			}
+			releaseResult()
+		}
+		next.logger.Info("awaiting-admission", lager.Data{"cost": cost, "reason": err.Error()})
+
+		timer := time.NewTimer(j.Admission.RetryAfter())
+		select {
+		case <-next.ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// finish gives up the estimate reserved for the result of a job, and the
+// admission of the result unless the job succeeded. It must be called with
+// lock held.
+func (j *Jobs) finish(jb *job, status string) {
+	now := time.Now()
+	expiresAt := now.Add(j.retention())
+	jb.status.Status = status
+	jb.status.FinishedAt = &now
+	jb.status.ExpiresAt = &expiresAt
+
+	j.reserved -= jb.resultBytes
+	jb.resultBytes = 0
+	if status != models.JobSucceeded {
+		jb.releaseResult()
+		jb.releaseResult = func() {}
+	}
+}
+
+// snapshot must be called with Jobs.lock held.
+func (jb *job) snapshot() models.Job {
+	status := jb.status
+	status.Progress = jb.progress.fraction()
+	if status.Status == models.JobSucceeded {
+		status.Progress = 1
+	}
+	return status
+}
+
+// expire forgets the jobs whose retention has passed. It must be called with
+// lock held.
+func (j *Jobs) expire() {
+	now := time.Now()
+	for id, expiring := range j.jobs {
+		if expiring.status.ExpiresAt != nil && !now.Before(*expiring.status.ExpiresAt) {
+			expiring.logger.Info("expired")
+			j.forget(id)
+		}
+	}
+}
+
+// forget drops a finished job and its result. It must be called with lock
+// held.
+func (j *Jobs) forget(id string) {
+	forgotten := j.jobs[id]
+	j.retained -= forgotten.run.size()
+	forgotten.releaseResult()
+	delete(j.jobs, id)
+}
+
+func (j *Jobs) maxJobs() int {
+	if j.MaxJobs <= 0 {
+		return defaultMaxJobs
+	}
+	return j.MaxJobs
+}
+
+func (j *Jobs) maxRetainedBytes() int {
+	if j.MaxRetainedBytes <= 0 {
+		return defaultMaxRetainedBytes
+	}
+	return j.MaxRetainedBytes
+}
+
+func (j *Jobs) retention() time.Duration {
+	if j.Retention <= 0 {
+		return defaultJobRetention
+	}
+	return j.Retention
+}
+
+func newJobId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
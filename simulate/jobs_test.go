@@ -0,0 +1,362 @@
+package simulate_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/admission"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Jobs", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		jobs                *simulate.Jobs
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(3), nil
+		}
+		jobs = &simulate.Jobs{
+			SteadyState: &simulate.SteadyState{AppSizeDistribution: appSizeDistribution},
+			Workers:     1,
+			MaxJobs:     3,
+			Retention:   time.Minute,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            10,
+			NumApps:             20,
+			MeanInstancesPerApp: 2,
+			Seed:                7,
+		}
+	})
+
+	submit := func() models.Job {
+		job, err := jobs.Submit(logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		return job
+	}
+
+	waitFor := func(id, status string) models.Job {
+		var job models.Job
+		Eventually(func() string {
+			job, _ = jobs.Status(id)
+			return job.Status
+		}).Should(Equal(status))
+		return job
+	}
+
+	It("queues a job and runs it in the background", func() {
+		job := submit()
+		Expect(job.Id).To(MatchRegexp(`^[0-9a-f]{32}$`))
+		Expect(job.Status).To(Equal(models.JobQueued))
+		Expect(job.Request).To(Equal(req))
+
+		job = waitFor(job.Id, models.JobSucceeded)
+		Expect(job.Progress).To(Equal(1.0))
+		Expect(job.StartedAt).NotTo(BeNil())
+		Expect(job.FinishedAt).NotTo(BeNil())
+		Expect(*job.ExpiresAt).To(Equal(job.FinishedAt.Add(time.Minute)))
+	})
+
+	It("gives each job a different id", func() {
+		Expect(submit().Id).NotTo(Equal(submit().Id))
+	})
+
+	It("writes the result of a job that has succeeded, as Stream would", func() {
+		job := submit()
+		waitFor(job.Id, models.JobSucceeded)
+
+		fromJob := &recordingWriter{}
+		Expect(jobs.WriteResult(context.Background(), job.Id, fromJob)).To(Succeed())
+		streamed := &recordingWriter{}
+		Expect(jobs.SteadyState.Stream(context.Background(), logger, req, streamed)).To(Succeed())
+
+		Expect(fromJob.summary).To(Equal(streamed.summary))
+		Expect(fromJob.instances).To(Equal(streamed.instances))
+		Expect(fromJob.closed).To(BeTrue())
+	})
+
+	It("reports a job that failed", func() {
+		appSizeDistribution.SampleReturns(0, errors.New("banana"))
+		job := waitFor(submit().Id, models.JobFailed)
+		Expect(job.Error).To(Equal("sampling app size: banana"))
+		Expect(jobs.WriteResult(context.Background(), job.Id, &recordingWriter{})).To(MatchError("job " + job.Id + " has not succeeded"))
+	})
+
+	It("does not know unknown jobs", func() {
+		_, ok := jobs.Status("banana")
+		Expect(ok).To(BeFalse())
+		_, ok = jobs.Cancel("banana")
+		Expect(ok).To(BeFalse())
+		Expect(jobs.WriteResult(context.Background(), "banana", &recordingWriter{})).To(MatchError("job banana not found"))
+	})
+
+	It("forgets a finished job once it expires", func() {
+		jobs.Retention = 50 * time.Millisecond
+		job := submit()
+		waitFor(job.Id, models.JobSucceeded)
+
+		Eventually(func() bool {
+			_, ok := jobs.Status(job.Id)
+			return ok
+		}).Should(BeFalse())
+	})
+
+	It("forgets a finished job when it is cancelled", func() {
+		job := submit()
+		waitFor(job.Id, models.JobSucceeded)
+
+		job, ok := jobs.Cancel(job.Id)
+		Expect(ok).To(BeTrue())
+		Expect(job.Status).To(Equal(models.JobSucceeded))
+
+		_, ok = jobs.Status(job.Id)
+		Expect(ok).To(BeFalse())
+	})
+
+	Describe("the results it retains", func() {
+		BeforeEach(func() {
+			jobs.MaxRetainedBytes = 1500 // room for one result of req
+		})
+
+		It("does not validate a job whose result would never fit", func() {
+			Expect(jobs.Validate(req)).To(Succeed())
+
+			req.NumApps = 100
+			Expect(jobs.Validate(req)).To(MatchError("the result would take about 1848 bytes, more than the 1500 that jobs may retain"))
+		})
+
+		It("refuses a job whose estimated result does not fit beside the others", func() {
+			first := submit()
+			_, err := jobs.Submit(logger, req)
+			Expect(err).To(MatchError("the result would take about 888 bytes, more than the 612 left of the 1500 that jobs may retain"))
+
+			waitFor(first.Id, models.JobSucceeded)
+			_, err = jobs.Submit(logger, req)
+			Expect(err).To(MatchError(HavePrefix("the result would take about 888 bytes")))
+		})
+
+		It("fails a job whose result turns out not to fit", func() {
+			appSizeDistribution.SampleReturns(30, nil)
+			job := waitFor(submit().Id, models.JobFailed)
+			Expect(job.Error).To(Equal("the result takes 2008 bytes, more than the 1500 left of the 1500 that jobs may retain"))
+			Expect(jobs.WriteResult(context.Background(), job.Id, &recordingWriter{})).To(MatchError("job " + job.Id + " has not succeeded"))
+
+			appSizeDistribution.SampleReturns(2, nil)
+			waitFor(submit().Id, models.JobSucceeded)
+		})
+
+		It("makes room for results again as jobs are forgotten", func() {
+			first := submit()
+			waitFor(first.Id, models.JobSucceeded)
+			_, ok := jobs.Cancel(first.Id)
+			Expect(ok).To(BeTrue())
+
+			waitFor(submit().Id, models.JobSucceeded)
+		})
+	})
+
+	Describe("with an admission controller", func() {
+		var controller *admission.Controller
+
+		BeforeEach(func() {
+			controller = &admission.Controller{
+				Budget: jobs.SteadyState.Cost(req),
+				Wait:   10 * time.Millisecond,
+			}
+			jobs.Admission = controller
+		})
+
+		It("holds the cost of a job while it runs", func() {
+			release := make(chan struct{})
+			appSizeDistribution.SampleStub = func(context.Context, *rand.Rand, float64) (int, error) {
+				<-release
+				return 2, nil
+			}
+			job := submit()
+			waitFor(job.Id, models.JobRunning)
+			Expect(controller.InFlight()).To(Equal(jobs.SteadyState.Cost(req)))
+
+			close(release)
+			waitFor(job.Id, models.JobSucceeded)
+			Expect(controller.InFlight()).To(BeNumerically(">", 0), "the result")
+			Expect(controller.InFlight()).To(BeNumerically("<", jobs.SteadyState.Cost(req)))
+
+			jobs.Cancel(job.Id)
+			Expect(controller.InFlight()).To(BeZero())
+		})
+
+		It("keeps a job queued while the budget is spent", func() {
+			releaseOther, err := controller.Admit(1)
+			Expect(err).NotTo(HaveOccurred())
+
+			job := submit()
+			Consistently(func() string {
+				job, _ := jobs.Status(job.Id)
+				return job.Status
+			}, "50ms").Should(Equal(models.JobQueued))
+
+			releaseOther()
+			waitFor(job.Id, models.JobSucceeded)
+		})
+
+		It("fails a job that costs more than the whole budget, rather than keep it queued", func() {
+			controller.Budget--
+			job := waitFor(submit().Id, models.JobFailed)
+			Expect(job.Error).To(HavePrefix("admission: estimated cost"))
+			Expect(job.Error).To(HaveSuffix("exceeds the whole budget of %d", controller.Budget))
+			Expect(controller.InFlight()).To(BeZero())
+		})
+
+		It("cancels a job that waits for admission", func() {
+			releaseOther, err := controller.Admit(1)
+			Expect(err).NotTo(HaveOccurred())
+
+			waiting := submit()
+			job, ok := jobs.Cancel(waiting.Id)
+			Expect(ok).To(BeTrue())
+			Expect(job.Status).To(Equal(models.JobCancelled))
+
+			releaseOther()
+			job = waitFor(submit().Id, models.JobSucceeded)
+			jobs.Cancel(job.Id)
+			Expect(controller.InFlight()).To(BeZero())
+		})
+
+		It("never blocks a submission on jobs cancelled while others wait for admission", func() {
+			jobs.MaxJobs = 2
+			releaseOther, err := controller.Admit(controller.Budget)
+			Expect(err).NotTo(HaveOccurred())
+			defer releaseOther()
+
+			waiting := submit()
+			for i := 0; i < 2; i++ {
+				cancelled := submit()
+				jobs.Cancel(cancelled.Id) // cancels it
+				jobs.Cancel(cancelled.Id) // forgets it
+			}
+
+			submitted := make(chan models.Job)
+			go func() {
+				defer GinkgoRecover()
+				submitted <- submit()
+			}()
+			var last models.Job
+			Eventually(submitted).Should(Receive(&last))
+
+			jobs.Cancel(waiting.Id)
+			jobs.Cancel(last.Id)
+		})
+
+		It("accepts a job of the largest size within the default budget", func() {
+			req = models.SteadyStateRequest{NumHosts: 1000, NumApps: 65534, MeanInstancesPerApp: 100, MeanPoliciesPerApp: 10}
+			jobs.MaxRetainedBytes = 0
+			controller.Budget = 32<<20 - 10<<20 // as serve sets it by default for the manifest
+
+			Expect(jobs.Validate(req)).To(Succeed())
+			job := submit()
+			waitFor(job.Id, models.JobRunning)
+
+			jobs.Cancel(job.Id)
+			waitFor(job.Id, models.JobCancelled)
+			Expect(controller.InFlight()).To(BeZero())
+		})
+	})
+
+	Context("while the workers are busy", func() {
+		var (
+			release     chan struct{}
+			releaseOnce sync.Once
+			running     models.Job
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			releaseOnce = sync.Once{}
+			appSizeDistribution.SampleStub = func(context.Context, *rand.Rand, float64) (int, error) {
+				<-release
+				return 2, nil
+			}
+			running = submit()
+			waitFor(running.Id, models.JobRunning)
+		})
+
+		AfterEach(func() {
+			releaseOnce.Do(func() { close(release) })
+		})
+
+		It("queues further jobs", func() {
+			queued := submit()
+			Consistently(func() string {
+				job, _ := jobs.Status(queued.Id)
+				return job.Status
+			}, "50ms").Should(Equal(models.JobQueued))
+
+			releaseOnce.Do(func() { close(release) })
+			waitFor(queued.Id, models.JobSucceeded)
+		})
+
+		It("cancels a queued job at once", func() {
+			queued := submit()
+			job, ok := jobs.Cancel(queued.Id)
+			Expect(ok).To(BeTrue())
+			Expect(job.Status).To(Equal(models.JobCancelled))
+			Expect(job.FinishedAt).NotTo(BeNil())
+
+			releaseOnce.Do(func() { close(release) })
+			waitFor(running.Id, models.JobSucceeded)
+			job, _ = jobs.Status(queued.Id)
+			Expect(job.Status).To(Equal(models.JobCancelled))
+		})
+
+		It("cancels a running job when it next checks", func() {
+			job, ok := jobs.Cancel(running.Id)
+			Expect(ok).To(BeTrue())
+			Expect(job.Status).To(Equal(models.JobRunning))
+
+			releaseOnce.Do(func() { close(release) })
+			job = waitFor(running.Id, models.JobCancelled)
+			Expect(job.Progress).To(BeNumerically("<", 1))
+		})
+
+		It("refuses jobs beyond MaxJobs", func() {
+			submit()
+			submit()
+			_, err := jobs.Submit(logger, req)
+			Expect(err).To(MatchError("at most 3 jobs may be queued, running or retained"))
+		})
+	})
+
+	Context("when there are several workers", func() {
+		BeforeEach(func() {
+			jobs.Workers = 2
+		})
+
+		It("runs jobs at the same time", func() {
+			release := make(chan struct{})
+			defer close(release)
+			appSizeDistribution.SampleStub = func(context.Context, *rand.Rand, float64) (int, error) {
+				<-release
+				return 2, nil
+			}
+
+			first, second := submit(), submit()
+			waitFor(first.Id, models.JobRunning)
+			waitFor(second.Id, models.JobRunning)
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package simulate
+
+import (
+	"context"
+	"math/bits"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// populateNetworkStats models a VXLAN overlay in which each host owns a
+// subnet for its instances. For every remote host it peers with, a host needs
+// a route to the remote subnet, an FDB entry for the remote VTEP and an ARP
+// entry for the remote VTEP address. It also needs an ARP entry for each of
+// its local instances.
+func (s *SteadyState) populateNetworkStats(ctx context.Context, instances *instanceSet, resp *models.SteadyStateResponse) error {
+	numHosts := resp.Request.NumHosts
+	peers, err := peerHosts(ctx, numHosts, instances)
+	if err != nil {
+		return err
+	}
+
+	fullMesh := newOverlayTables(numHosts)
+	peersOnly := newOverlayTables(numHosts)
+	for hostId := 0; hostId < numHosts; hostId++ {
+		localInstances := resp.HostStats.InstancesPerHost[hostId]
+		fullMesh.add(hostId, numHosts-1, localInstances)
+		peersOnly.add(hostId, peers[hostId].count()-1, localInstances)
+	}
+
+	resp.Network = models.NetworkStats{
+		FullMesh:  fullMesh.summarize(),
+		PeersOnly: peersOnly.summarize(),
+	}
+	return nil
+}
+
+type overlayTables struct {
+	routes, fdbEntries, arpEntries []int
+}
+
+func newOverlayTables(numHosts int) *overlayTables {
+	return &overlayTables{
+		routes:     make([]int, numHosts),
+		fdbEntries: make([]int, numHosts),
+		arpEntries: make([]int, numHosts),
+	}
+}
+
+func (t *overlayTables) add(hostId, remoteHosts, localInstances int) {
+	if remoteHosts < 0 {
+		remoteHosts = 0
+	}
+	t.routes[hostId] = remoteHosts
+	t.fdbEntries[hostId] = remoteHosts
+	t.arpEntries[hostId] = remoteHosts + localInstances
+}
+
+func (t *overlayTables) summarize() models.OverlayStats {
+	return models.OverlayStats{
+		Routes:     summarize(t.routes),
+		FDBEntries: summarize(t.fdbEntries),
+		ARPEntries: summarize(t.arpEntries),
+	}
+}
+
+// peerHosts returns, for each host, the set of hosts running an instance of
+// any app that also runs on that host. A host with instances is its own peer.
+func peerHosts(ctx context.Context, numHosts int, instances *instanceSet) ([]hostSet, error) {
+	peers := make([]hostSet, numHosts)
+	for i := range peers {
+		peers[i] = newHostSet(numHosts)
+	}
+
+	appHosts := newHostSet(numHosts)
+	var appHostIds []int
+	for appId := 0; appId < instances.numApps(); appId++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, hostId := range instances.ofApp(appId) {
+			if !appHosts.has(int(hostId)) {
+				appHosts.add(int(hostId))
+				appHostIds = append(appHostIds, int(hostId))
+			}
+		}
+		for _, hostId := range appHostIds {
+			peers[hostId].union(appHosts)
+		}
+		appHosts.clear()
+		appHostIds = appHostIds[:0]
+	}
+
+	return peers, nil
+}
+
+type hostSet []uint64
+
+func newHostSet(numHosts int) hostSet {
+	return make(hostSet, (numHosts+63)/64)
+}
+
+func (s hostSet) add(hostId int) {
+	s[hostId/64] |= 1 << uint(hostId%64)
+}
+
+func (s hostSet) has(hostId int) bool {
+	return s[hostId/64]&(1<<uint(hostId%64)) != 0
+}
+
+func (s hostSet) union(other hostSet) {
+	for i := range s {
+		s[i] |= other[i]
+	}
+}
+
+func (s hostSet) clear() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+func (s hostSet) count() int {
+	n := 0
+	for _, word := range s {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
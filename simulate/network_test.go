@@ -0,0 +1,88 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Network cost model", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+		sizes               []int
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, _ *rand.Rand, _ float64) (int, error) {
+			// every pass over the apps samples them again, in order
+			return sizes[(appSizeDistribution.SampleCallCount()-1)%len(sizes)], nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+
+		// round-robin placement puts app 0 on hosts 0 and 1, app 1 on host 2
+		// and leaves host 3 empty
+		req = models.SteadyStateRequest{
+			NumHosts:            4,
+			NumApps:             2,
+			MeanInstancesPerApp: 1,
+		}
+		sizes = []int{2, 1}
+	})
+
+	It("gives every host an entry for every other host in a full mesh", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		fullMesh := resp.Network.FullMesh
+		Expect(fullMesh.Routes.Min).To(Equal(3))
+		Expect(fullMesh.Routes.Max).To(Equal(3))
+		Expect(fullMesh.FDBEntries.Mean).To(Equal(3.0))
+
+		By("adding an ARP entry for each local instance")
+		Expect(fullMesh.ARPEntries.Min).To(Equal(3))
+		Expect(fullMesh.ARPEntries.Max).To(Equal(4))
+		Expect(fullMesh.ARPEntries.Mean).To(Equal(3.75))
+	})
+
+	It("only gives hosts entries for hosts that run the same apps when peering", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		peersOnly := resp.Network.PeersOnly
+		Expect(peersOnly.Routes.Min).To(Equal(0))
+		Expect(peersOnly.Routes.Max).To(Equal(1))
+		Expect(peersOnly.Routes.Mean).To(Equal(0.5))
+		Expect(peersOnly.FDBEntries).To(Equal(peersOnly.Routes))
+
+		Expect(peersOnly.ARPEntries.Min).To(Equal(0))
+		Expect(peersOnly.ARPEntries.Max).To(Equal(2))
+		Expect(peersOnly.ARPEntries.Mean).To(Equal(1.25))
+	})
+
+	It("never needs more entries when peering than in a full mesh", func() {
+		req.NumHosts = 50
+		req.NumApps = 200
+		sizes = make([]int, req.NumApps)
+		for i := range sizes {
+			sizes[i] = 1 + rand.Intn(10)
+		}
+
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Network.PeersOnly.Routes.Max).To(BeNumerically("<=", resp.Network.FullMesh.Routes.Max))
+		Expect(resp.Network.PeersOnly.ARPEntries.Mean).To(BeNumerically("<=", resp.Network.FullMesh.ARPEntries.Mean))
+	})
+})
@@ -0,0 +1,323 @@
+package simulate
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const DefaultPlacementStrategy = "round-robin"
+
+// placementStrategy picks a host with room for another instance of the app,
+// returning false if there is none.
+type placementStrategy interface {
+	place(c *cluster, appId int) (hostId int, ok bool)
+}
+
+var placementStrategies = map[string]placementStrategy{
+	"round-robin":   roundRobin{},
+	"random":        uniformRandom{},
+	"least-loaded":  leastLoaded{},
+	"spread":        spread{},
+	"zone-balanced": zoneBalanced{},
+}
+
+func placementStrategyNames() []string {
+	names := make([]string, 0, len(placementStrategies))
+	for name := range placementStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupPlacementStrategy(name string) (string, placementStrategy, error) {
+	if name == "" {
+		name = DefaultPlacementStrategy
+	}
+	strategy, ok := placementStrategies[name]
+	if !ok {
+		return "", nil, fieldError("PlacementStrategy", "one-of", name, "PlacementStrategy must be one of: %s", strings.Join(placementStrategyNames(), ", "))
+	}
+	return name, strategy, nil
+}
+
+// roundRobin cycles through the hosts in order, ignoring their load.
+type roundRobin struct{}
+
+func (roundRobin) place(c *cluster, appId int) (int, bool) {
+	n := len(c.hostIds)
+	for i := 0; i < n; i++ {
+		id := c.hostIds[(c.numPlaced+i)%n]
+		if c.fits(id, appId) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// uniformRandom picks any host with room with equal probability.
+type uniformRandom struct{}
+
+func (uniformRandom) place(c *cluster, appId int) (int, bool) {
+	id := c.hostIds[c.rng.Intn(len(c.hostIds))]
+	if c.fits(id, appId) {
+		return id, true
+	}
+
+	var candidates []int
+	for _, id := range c.hostIds {
+		if c.fits(id, appId) {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	return candidates[c.rng.Intn(len(candidates))], true
+}
+
+// leastLoaded picks the host with the fewest instances, breaking ties at random.
+type leastLoaded struct{}
+
+func (leastLoaded) place(c *cluster, appId int) (int, bool) {
+	return c.leastLoadedWhere(func(id int) bool {
+		return c.fits(id, appId)
+	})
+}
+
+// spread mimics the Diego auctioneer: it prefers hosts running the fewest
+// instances of the same app, and among those the least loaded host.
+type spread struct{}
+
+func (spread) place(c *cluster, appId int) (int, bool) {
+	appHosts, _ := c.appInstances(appId)
+	if len(appHosts) < len(c.hostIds) {
+		id, ok := c.leastLoadedWhere(func(id int) bool {
+			_, running := appHosts[id]
+			return !running && c.fits(id, appId)
+		})
+		if ok {
+			return id, true
+		}
+	}
+
+	var best *hostEntry
+	for _, id := range c.hostIds {
+		if !c.fits(id, appId) {
+			continue
+		}
+		candidate := c.byHost[id]
+		if best == nil || appHosts[id] < appHosts[best.id] ||
+			(appHosts[id] == appHosts[best.id] && candidate.less(best)) {
+			best = candidate
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.id, true
+}
+
+type hostEntry struct {
+	id       int
+	load     int
+	tiebreak float64
+	index    int
+
+	slots        int // zero means unlimited
+	memoryMB     int // zero means unlimited
+	usedMemoryMB int
+
+	zone      int
+	zoneIndex int
+}
+
+func (h *hostEntry) less(other *hostEntry) bool {
+	if h.load != other.load {
+		return h.load < other.load
+	}
+	return h.tiebreak < other.tiebreak
+}
+
+type hostHeap []*hostEntry
+
+func (h hostHeap) Len() int           { return len(h) }
+func (h hostHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+func (h hostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hostHeap) Push(x interface{}) {
+	entry := x.(*hostEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+func (h *hostHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// cluster tracks the load on each host while instances are being placed.
+// It counts the instances of one app at a time, the app being placed, so
+// that its memory does not grow with the number of apps.
+type cluster struct {
+	rng       *rand.Rand
+	hostIds   []int
+	byHost    map[int]*hostEntry
+	byLoad    hostHeap
+	numPlaced int
+
+	limited     bool  // whether any host has a capacity
+	appMemoryMB []int // per instance, by app id
+
+	// only tracked when there is more than one zone
+	byZone    []zoneHeap
+	zoneLoads []int
+
+	// the instances of the app being placed, until forget
+	appId    int
+	appHosts map[int]int
+	appZones []int // only tracked when there is more than one zone
+}
+
+func newCluster(rng *rand.Rand, hostIds []int) *cluster {
+	c := &cluster{
+		rng:      rng,
+		hostIds:  hostIds,
+		byHost:   make(map[int]*hostEntry, len(hostIds)),
+		byLoad:   make(hostHeap, 0, len(hostIds)),
+		appHosts: make(map[int]int),
+	}
+	for _, id := range hostIds {
+		entry := &hostEntry{id: id, tiebreak: rng.Float64()}
+		c.byHost[id] = entry
+		heap.Push(&c.byLoad, entry)
+	}
+	return c
+}
+
+func (c *cluster) setCapacity(hostId, slots, memoryMB int) {
+	entry := c.byHost[hostId]
+	entry.slots = slots
+	entry.memoryMB = memoryMB
+	c.limited = c.limited || slots > 0 || memoryMB > 0
+}
+
+func (c *cluster) memoryOf(appId int) int {
+	if appId < len(c.appMemoryMB) {
+		return c.appMemoryMB[appId]
+	}
+	return 0
+}
+
+// fits reports whether the host has room for another instance of the app.
+func (c *cluster) fits(hostId, appId int) bool {
+	if !c.limited {
+		return true
+	}
+	entry := c.byHost[hostId]
+	if entry.slots > 0 && entry.load >= entry.slots {
+		return false
+	}
+	if entry.memoryMB > 0 && entry.usedMemoryMB+c.memoryOf(appId) > entry.memoryMB {
+		return false
+	}
+	return true
+}
+
+func (c *cluster) assign(appId, hostId int) {
+	entry := c.byHost[hostId]
+	entry.load++
+	entry.usedMemoryMB += c.memoryOf(appId)
+	entry.tiebreak = c.rng.Float64()
+	heap.Fix(&c.byLoad, entry.index)
+	c.addToZone(entry, 1)
+	c.count(appId, hostId, 1)
+	c.numPlaced++
+}
+
+func (c *cluster) unassign(appId, hostId int) {
+	entry := c.byHost[hostId]
+	entry.load--
+	entry.usedMemoryMB -= c.memoryOf(appId)
+	heap.Fix(&c.byLoad, entry.index)
+	c.addToZone(entry, -1)
+	c.count(appId, hostId, -1)
+}
+
+// count tracks the instances of an app on each host and in each zone,
+// without changing the load on the host. The cluster must forget any other
+// app that it counts first.
+func (c *cluster) count(appId, hostId, delta int) {
+	if len(c.appHosts) > 0 && appId != c.appId {
+		panic(fmt.Sprintf("counting app %d before forgetting app %d", appId, c.appId))
+	}
+	c.appId = appId
+	c.appHosts[hostId] += delta
+	if c.appHosts[hostId] == 0 {
+		delete(c.appHosts, hostId)
+	}
+	if c.appZones != nil {
+		c.appZones[c.byHost[hostId].zone] += delta
+	}
+}
+
+// appInstances returns the instances of the app on each host and in each
+// zone, or nothing if the cluster is counting another app.
+func (c *cluster) appInstances(appId int) (perHost map[int]int, perZone []int) {
+	if appId != c.appId {
+		return nil, nil
+	}
+	return c.appHosts, c.appZones
+}
+
+// forget drops the counts of the app, once it has been placed.
+func (c *cluster) forget(appId int) {
+	if appId != c.appId {
+		return
+	}
+	for hostId := range c.appHosts {
+		delete(c.appHosts, hostId)
+	}
+	for zone := range c.appZones {
+		c.appZones[zone] = 0
+	}
+}
+
+func (c *cluster) loads() []int {
+	loads := make([]int, len(c.hostIds))
+	for i, id := range c.hostIds {
+		loads[i] = c.byHost[id].load
+	}
+	return loads
+}
+
+// leastLoadedWhere returns the least loaded host that satisfies the predicate,
+// or false if there is none.
+func (c *cluster) leastLoadedWhere(predicate func(hostId int) bool) (int, bool) {
+	return leastLoadedIn(c.byLoad, predicate)
+}
+
+// leastLoadedIn looks for a host in a heap ordered by load.
+func leastLoadedIn(byLoad []*hostEntry, predicate func(hostId int) bool) (int, bool) {
+	if predicate(byLoad[0].id) {
+		return byLoad[0].id, true
+	}
+
+	var best *hostEntry
+	for _, entry := range byLoad[1:] {
+		if (best == nil || entry.less(best)) && predicate(entry.id) {
+			best = entry
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.id, true
+}
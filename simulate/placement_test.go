@@ -0,0 +1,166 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Placement strategies", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	var countPerHost = func(instances []models.Instance) map[int]int {
+		perHost := make(map[int]int)
+		for _, instance := range instances {
+			perHost[instance.HostId]++
+		}
+		return perHost
+	}
+
+	var minMax = func(counts map[int]int) (int, int) {
+		min, max := -1, 0
+		for _, count := range counts {
+			if min < 0 || count < min {
+				min = count
+			}
+			if count > max {
+				max = count
+			}
+		}
+		return min, max
+	}
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            100,
+			NumApps:             1000,
+			MeanInstancesPerApp: 5,
+		}
+	})
+
+	It("defaults to round-robin placement in app order", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.PlacementStrategy).To(Equal("round-robin"))
+		for i, instance := range resp.Instances {
+			Expect(instance.HostId).To(Equal(i % req.NumHosts))
+		}
+	})
+
+	It("samples the same app population regardless of strategy", func() {
+		req.Seed = 1234
+		req.PlacementStrategy = "round-robin"
+		roundRobin, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.PlacementStrategy = "spread"
+		spread, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spread.Apps).To(Equal(roundRobin.Apps))
+		Expect(spread.Instances).NotTo(Equal(roundRobin.Instances))
+	})
+
+	Context("random", func() {
+		BeforeEach(func() {
+			req.PlacementStrategy = "random"
+		})
+
+		It("reports the strategy and places every instance on a valid host", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.PlacementStrategy).To(Equal("random"))
+
+			perHost := countPerHost(resp.Instances)
+			Expect(len(perHost)).To(BeNumerically(">", 1))
+			for hostId := range perHost {
+				Expect(hostId).To(BeNumerically(">=", 0))
+				Expect(hostId).To(BeNumerically("<", req.NumHosts))
+			}
+		})
+
+		It("is reproducible given a seed", func() {
+			req.Seed = 99
+			first, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second.Instances).To(Equal(first.Instances))
+		})
+	})
+
+	Context("least-loaded", func() {
+		BeforeEach(func() {
+			req.PlacementStrategy = "least-loaded"
+		})
+
+		It("keeps every host within one instance of every other", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.PlacementStrategy).To(Equal("least-loaded"))
+
+			perHost := countPerHost(resp.Instances)
+			Expect(perHost).To(HaveLen(req.NumHosts))
+			min, max := minMax(perHost)
+			Expect(max - min).To(BeNumerically("<=", 1))
+		})
+	})
+
+	Context("spread", func() {
+		BeforeEach(func() {
+			req.PlacementStrategy = "spread"
+		})
+
+		It("places instances of the same app on different hosts", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.PlacementStrategy).To(Equal("spread"))
+
+			hostsPerApp := make(map[int]map[int]bool)
+			for _, instance := range resp.Instances {
+				if hostsPerApp[instance.AppId] == nil {
+					hostsPerApp[instance.AppId] = make(map[int]bool)
+				}
+				Expect(hostsPerApp[instance.AppId]).NotTo(HaveKey(instance.HostId))
+				hostsPerApp[instance.AppId][instance.HostId] = true
+			}
+		})
+
+		It("evenly spreads apps that are larger than the number of hosts", func() {
+			req.NumHosts = 3
+			req.NumApps = 1
+			appSizeDistribution.SampleReturns(7, nil)
+
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			min, max := minMax(countPerHost(resp.Instances))
+			Expect(min).To(Equal(2))
+			Expect(max).To(Equal(3))
+		})
+	})
+
+	It("rejects unknown strategies during validation", func() {
+		req.PlacementStrategy = "banana"
+		Expect(sim.Validate(req)).To(MatchError("PlacementStrategy must be one of: least-loaded, random, round-robin, spread, zone-balanced"))
+	})
+})
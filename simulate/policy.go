@@ -0,0 +1,115 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	minEphemeralPort = 1024
+	maxPort          = 65535
+	probTCP          = 0.9
+)
+
+// policySource samples a random app-to-app policy graph. Sources are
+// chosen uniformly, while destinations are chosen with probability
+// proportional to 1/rank^PolicyFanInSkew, so that a positive skew makes a few
+// apps the destination of most policies. Policies are sampled from a seed of
+// their own, so that every pass over them sees the same policies without
+// them being kept.
+type policySource struct {
+	numApps     int
+	numPolicies int
+	fanInSkew   float64
+	volumes     meanParameterizedDiscreteDistribution // nil without volumes
+	meanVolume  float64
+	seed        int64
+}
+
+func newPolicySource(req models.SteadyStateRequest, volumes meanParameterizedDiscreteDistribution, rng *rand.Rand) *policySource {
+	return &policySource{
+		numApps:     req.NumApps,
+		numPolicies: int(math.Floor(float64(req.NumApps)*req.MeanPoliciesPerApp + 0.5)),
+		fanInSkew:   req.PolicyFanInSkew,
+		volumes:     volumes,
+		meanVolume:  req.MeanPolicyVolume,
+		seed:        rng.Int63(),
+	}
+}
+
+// each materializes the policies one at a time, in order, until ctx is
+// done.
+func (p *policySource) each(ctx context.Context, f func(models.Policy) error) error {
+	if p.numPolicies == 0 {
+		return nil
+	}
+
+	cumulativeWeights := make([]float64, p.numApps)
+	total := 0.0
+	for i := range cumulativeWeights {
+		total += math.Pow(float64(i+1), -p.fanInSkew)
+		cumulativeWeights[i] = total
+	}
+
+	rng := rand.New(rand.NewSource(p.seed))
+	for i := 0; i < p.numPolicies; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		policy := models.Policy{
+			SourceAppId:      rng.Intn(p.numApps),
+			DestinationAppId: sort.SearchFloat64s(cumulativeWeights, rng.Float64()*total),
+			Protocol:         "udp",
+		}
+		if rng.Float64() < probTCP {
+			policy.Protocol = "tcp"
+		}
+		policy.Port = minEphemeralPort + rng.Intn(maxPort-minEphemeralPort+1)
+		if p.volumes != nil {
+			var err error
+			policy.Volume, err = p.volumes.Sample(ctx, rng, p.meanVolume)
+			if err != nil {
+				return fmt.Errorf("sampling policy volume: %s", err)
+			}
+		}
+		if err := f(policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// populatePolicyStats counts the rules each host needs to enforce policies on
+// ingress: one rule per policy for every local instance of the destination app.
+func (s *SteadyState) populatePolicyStats(ctx context.Context, policies *policySource, instances *instanceSet, resp *models.SteadyStateResponse) error {
+	inboundPolicies := make([]int, resp.Request.NumApps)
+	err := policies.each(ctx, func(policy models.Policy) error {
+		inboundPolicies[policy.DestinationAppId]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rulesPerHost := make([]int, resp.Request.NumHosts)
+	totalRules := 0
+	for appId, inbound := range inboundPolicies {
+		for _, hostId := range instances.ofApp(appId) {
+			rulesPerHost[hostId] += inbound
+			totalRules += inbound
+		}
+	}
+
+	resp.PolicyStats = models.PolicyStats{
+		TotalPolicies: policies.numPolicies,
+		TotalRules:    totalRules,
+		RulesPerHost:  rulesPerHost,
+		Rules:         summarize(rulesPerHost),
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package simulate_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Policy model", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(2*req.MeanInstancesPerApp-1), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            100,
+			NumApps:             1000,
+			MeanInstancesPerApp: 5,
+			MeanPoliciesPerApp:  2,
+		}
+	})
+
+	It("generates the requested number of policies between existing apps", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Policies).To(HaveLen(2000))
+		Expect(resp.PolicyStats.TotalPolicies).To(Equal(2000))
+
+		for _, policy := range resp.Policies {
+			Expect(policy.SourceAppId).To(BeNumerically("<", req.NumApps))
+			Expect(policy.DestinationAppId).To(BeNumerically("<", req.NumApps))
+			Expect(policy.Protocol).To(BeElementOf("tcp", "udp"))
+			Expect(policy.Port).To(BeNumerically(">=", 1024))
+			Expect(policy.Port).To(BeNumerically("<=", 65535))
+		}
+	})
+
+	It("generates no policies by default", func() {
+		req.MeanPoliciesPerApp = 0
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Policies).To(BeEmpty())
+		Expect(resp.PolicyStats.TotalRules).To(Equal(0))
+	})
+
+	It("concentrates policies on a few destinations when fan-in is skewed", func() {
+		maxFanIn := func(resp *models.SteadyStateResponse) int {
+			fanIn := make(map[int]int)
+			max := 0
+			for _, policy := range resp.Policies {
+				fanIn[policy.DestinationAppId]++
+				if fanIn[policy.DestinationAppId] > max {
+					max = fanIn[policy.DestinationAppId]
+				}
+			}
+			return max
+		}
+
+		uniform, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.PolicyFanInSkew = 1.5
+		skewed, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(maxFanIn(skewed)).To(BeNumerically(">", 10*maxFanIn(uniform)))
+	})
+
+	It("needs one rule per inbound policy for each local destination instance", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		inbound := make(map[int]int)
+		for _, policy := range resp.Policies {
+			inbound[policy.DestinationAppId]++
+		}
+		expectedPerHost := make([]int, req.NumHosts)
+		expectedTotal := 0
+		for _, instance := range resp.Instances {
+			expectedPerHost[instance.HostId] += inbound[instance.AppId]
+			expectedTotal += inbound[instance.AppId]
+		}
+
+		Expect(resp.PolicyStats.RulesPerHost).To(Equal(expectedPerHost))
+		Expect(resp.PolicyStats.TotalRules).To(Equal(expectedTotal))
+		Expect(resp.PolicyStats.Rules.Mean).To(BeNumerically("~", float64(expectedTotal)/float64(req.NumHosts), 1e-9))
+	})
+
+	It("does not change the app population or placement", func() {
+		req.Seed = 5
+		withPolicies, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		req.MeanPoliciesPerApp = 0
+		withoutPolicies, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(withPolicies.Apps).To(Equal(withoutPolicies.Apps))
+		Expect(withPolicies.Instances).To(Equal(withoutPolicies.Instances))
+	})
+
+	It("validates the policy parameters", func() {
+		bad := req
+		bad.MeanPoliciesPerApp = -1
+		Expect(sim.Validate(bad)).To(MatchError("MeanPoliciesPerApp must be 0 - 10"))
+
+		bad = req
+		bad.MeanPoliciesPerApp = 10.5
+		Expect(sim.Validate(bad)).To(MatchError("MeanPoliciesPerApp must be 0 - 10"))
+
+		bad = req
+		bad.PolicyFanInSkew = math.NaN()
+		Expect(sim.Validate(bad)).To(MatchError("PolicyFanInSkew must be 0 - 3"))
+	})
+})
@@ -0,0 +1,140 @@
+package simulate
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+// summarize computes order statistics using the nearest-rank method,
+// along with the population standard deviation.
+func summarize(values []int) models.Summary {
+	if len(values) == 0 {
+		return models.Summary{}
+	}
+
+	sorted := make([]int, len(values))
+	copy(sorted, values)
+	sort.Ints(sorted)
+
+	total := 0
+	for _, v := range sorted {
+		total += v
+	}
+	mean := float64(total) / float64(len(sorted))
+
+	sumSquares := 0.0
+	for _, v := range sorted {
+		d := float64(v) - mean
+		sumSquares += d * d
+	}
+
+	return models.Summary{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   mean,
+		StdDev: math.Sqrt(sumSquares / float64(len(sorted))),
+		P50:    percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+		P99:    percentile(sorted, 99),
+	}
+}
+
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// studentTQuantile returns the t such that a Student t distribution with df
+// degrees of freedom has probability p, above one half, of being at most t.
+// It bisects the distribution function, which is accurate to well under
+// 1e-9 in a few dozen steps.
+func studentTQuantile(p, df float64) float64 {
+	low, high := 0.0, 1.0
+	for studentTCDF(high, df) < p {
+		low, high = high, 2*high
+	}
+	for i := 0; i < 100 && high-low > 1e-12; i++ {
+		mid := (low + high) / 2
+		if studentTCDF(mid, df) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// studentTCDF is the distribution function at t of the Student t
+// distribution with df degrees of freedom, for t >= 0.
+func studentTCDF(t, df float64) float64 {
+	return 1 - incompleteBeta(df/(df+t*t), df/2, 0.5)/2
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated by its continued fraction.
+func incompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+	// the continued fraction converges quickly only on this side of the mean
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+// betaContinuedFraction evaluates the continued fraction for the incomplete
+// beta function by the modified Lentz method.
+func betaContinuedFraction(x, a, b float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1.0; m <= 300; m++ {
+		// even step
+		numerator := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+
+		// odd step
+		numerator = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		result *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return result
+}
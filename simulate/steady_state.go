@@ -1,7 +1,11 @@
 package simulate
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 
@@ -10,88 +14,468 @@ import (
 
 //go:generate counterfeiter -o ../fakes/mean_parameterized_discrete_distribution.go --fake-name MeanParameterizedDiscreteDistribution . meanParameterizedDiscreteDistribution
 type meanParameterizedDiscreteDistribution interface {
-	Sample(mean float64) (int, error)
+	Sample(ctx context.Context, rng *rand.Rand, mean float64) (int, error)
 }
 
+//go:generate counterfeiter -o ../fakes/simulation_observer.go --fake-name SimulationObserver . simulationObserver
+type simulationObserver interface {
+	Started()
+	Finished(outcome string, duration time.Duration, instances int)
+	StageFinished(stage string, duration time.Duration)
+}
+
+// NamedDistributions maps names that requests may use to distributions.
+type NamedDistributions map[string]meanParameterizedDiscreteDistribution
+
 type SteadyState struct {
 	AppSizeDistribution meanParameterizedDiscreteDistribution
+
+	// AppSizeDistributions, along with any histograms uploaded through
+	// AppSizeHistograms, can be selected by name on the request. Requests
+	// that don't name one use AppSizeDistribution.
+	AppSizeDistributions NamedDistributions
+
+	// AppMemoryDistribution samples the memory of each app instance, when the
+	// request asks for it.
+	AppMemoryDistribution meanParameterizedDiscreteDistribution
+
+	// Observer, if set, is told of each simulation, how it ended and how
+	// long each of its stages took.
+	Observer simulationObserver
+
+	uploadedLock sync.RWMutex
+	uploaded     map[string]meanParameterizedDiscreteDistribution
 }
 
-func (s *SteadyState) Execute(logger lager.Logger, req models.SteadyStateRequest) (*models.SteadyStateResponse, error) {
+// maxHosts bounds NumHosts, so that a host id fits in a uint16.
+const maxHosts = 1000
+
+// Execute runs a simulation, giving up with the error of ctx once it is
+// done.
+func (s *SteadyState) Execute(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest) (*models.SteadyStateResponse, error) {
+	run, err := s.simulate(ctx, logger, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := run.resp
+	resp.Apps = make([]models.App, 0, resp.Request.NumApps)
+	err = run.apps.each(ctx, func(app models.App) error {
+		resp.Apps = append(resp.Apps, app)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Instances = make([]models.Instance, 0, run.instances.len())
+	err = run.eachInstance(ctx, func(instance models.Instance) error {
+		resp.Instances = append(resp.Instances, instance)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Policies = make([]models.Policy, 0, run.policies.numPolicies)
+	err = run.policies.each(ctx, func(policy models.Policy) error {
+		resp.Policies = append(resp.Policies, policy)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Stream runs a simulation like Execute, then hands the response to out in
+// pieces. Each app, instance and policy is materialized only as it is
+// written, so that the memory used is independent of the number written.
+func (s *SteadyState) Stream(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest, out models.SteadyStateWriter) error {
+	run, err := s.simulate(ctx, logger, req, nil)
+	if err != nil {
+		return err
+	}
+	stages := s.startStages()
+	err = run.write(ctx, out)
+	stages.done("write")
+	return err
+}
+
+// simulate places the instances of every app and computes the statistics
+// of the response, without materializing its instances. It reports to p,
+// which may be nil, and checks ctx in every loop over the apps.
+func (s *SteadyState) simulate(ctx context.Context, logger lager.Logger, req models.SteadyStateRequest, p *progress) (run *steadyStateRun, err error) {
 	logger.Info("start", lager.Data{"input": req})
 	defer logger.Info("done")
 
+	observer := s.observer()
+	observer.Started()
+	started := time.Now()
+	defer func() {
+		observer.Finished(outcome(ctx, err), time.Since(started), run.numInstances())
+	}()
+	stages := s.startStages()
+
+	req, err = withHostClasses(req)
+	if err != nil {
+		return nil, err
+	}
+
 	var resp models.SteadyStateResponse
 	resp.Request = req
-	totalInstances := float64(req.NumApps) * float64(req.MeanInstancesPerApp)
+	resp.Seed = req.Seed
+	if resp.Seed == 0 {
+		resp.Seed = newSeed()
+	}
+	rng := rand.New(rand.NewSource(resp.Seed))
+
+	strategyName, strategy, err := lookupPlacementStrategy(req.PlacementStrategy)
+	if err != nil {
+		return nil, err
+	}
+	resp.PlacementStrategy = strategyName
+
+	appSizeDistribution, err := s.lookupAppSizeDistribution(req.AppSizeDistribution)
+	if err != nil {
+		return nil, err
+	}
+
+	policyVolumeDistribution, err := s.lookupPolicyVolumeDistribution(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ipam, err := parseIPAMConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	numFailed, err := numFailedHosts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if numFailed > 0 {
+		p.start(2 * req.NumApps) // placing and then evacuating each app
+	} else {
+		p.start(req.NumApps)
+	}
+
+	apps := s.newAppSource(req, appSizeDistribution, rng)
+	policies := newPolicySource(req, policyVolumeDistribution, rng)
+	totalInstances := float64(req.NumApps) * apps.meanSize
 	resp.MeanInstancesPerHost = totalInstances / float64(req.NumHosts)
+	stages.done("setup")
 
-	if err := s.populateApps(&resp); err != nil {
+	if err := s.populateTotalInstances(ctx, apps, &resp); err != nil {
 		return nil, err
 	}
+	stages.done("apps")
+	appMemoryMB, err := apps.memoryMB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if appMemoryMB != nil {
+		stages.done("app-memory")
+	}
 
-	if err := s.populateInstances(&resp); err != nil {
+	c, instances, unplacedInstances, err := s.populateInstances(ctx, rng, strategy, p, apps, appMemoryMB, &resp)
+	if err != nil {
 		return nil, err
 	}
+	stages.done("placement")
+	if len(req.HostClasses) > 0 {
+		s.populateCapacity(c, unplacedInstances, appMemoryMB, &resp)
+		stages.done("capacity")
+	}
+	if req.NumZones > 0 {
+		s.populateZones(instances, &resp)
+		stages.done("zones")
+	}
+
+	s.populateHostStats(instances, &resp)
+	stages.done("host-stats")
+	if ipam != nil {
+		s.populateIPAM(ipam, &resp)
+		stages.done("ipam")
+	}
+	if err := s.populateNetworkStats(ctx, instances, &resp); err != nil {
+		return nil, err
+	}
+	stages.done("network")
+
+	if err := s.populatePolicyStats(ctx, policies, instances, &resp); err != nil {
+		return nil, err
+	}
+	stages.done("policies")
+	if err := s.populateTraffic(ctx, policies, instances, &resp); err != nil {
+		return nil, err
+	}
+	stages.done("traffic")
+
+	if numFailed > 0 {
+		if err := s.populateEvacuation(ctx, rng, strategy, p, numFailed, instances, appMemoryMB, &resp); err != nil {
+			return nil, err
+		}
+		stages.done("evacuation")
+	}
 
 	logger.Info("success")
-	return &resp, nil
+	return &steadyStateRun{resp: &resp, apps: apps, instances: instances, policies: policies, ipam: ipam}, nil
 }
 
-func (s *SteadyState) populateApps(resp *models.SteadyStateResponse) error {
-	req := resp.Request
-	resp.Apps = make([]models.App, req.NumApps)
-	var err error
-	totalInstances := 0
-	for i, _ := range resp.Apps {
-		resp.Apps[i].Id = i
-		resp.Apps[i].Size, err = s.AppSizeDistribution.Sample(float64(req.MeanInstancesPerApp))
+// outcome names how a simulation that returned err ended.
+func outcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case ctx.Err() != nil:
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
+
+// stageTimer tells an observer how long each stage took since the one
+// before.
+type stageTimer struct {
+	observer simulationObserver
+	last     time.Time
+}
+
+func (s *SteadyState) startStages() *stageTimer {
+	return &stageTimer{observer: s.observer(), last: time.Now()}
+}
+
+func (t *stageTimer) done(stage string) {
+	now := time.Now()
+	t.observer.StageFinished(stage, now.Sub(t.last))
+	t.last = now
+}
+
+func (s *SteadyState) observer() simulationObserver {
+	if s.Observer == nil {
+		return noObserver{}
+	}
+	return s.Observer
+}
+
+type noObserver struct{}
+
+func (noObserver) Started()                            {}
+func (noObserver) Finished(string, time.Duration, int) {}
+func (noObserver) StageFinished(string, time.Duration) {}
+
+// newSeed returns a non-zero seed, since a zero Seed on the request means
+// that the caller did not provide one.
+func newSeed() int64 {
+	for {
+		if seed := rand.Int63(); seed != 0 {
+			return seed
+		}
+	}
+}
+
+// appSource samples the apps of a request in order. Sizes and memory are
+// sampled from seeds of their own, so that every pass over the apps sees
+// the same apps without them being kept.
+type appSource struct {
+	numApps      int
+	sizes        meanParameterizedDiscreteDistribution
+	meanSize     float64
+	memory       meanParameterizedDiscreteDistribution // nil without memory
+	meanMemoryMB float64
+	sizeSeed     int64
+	memorySeed   int64
+}
+
+func (s *SteadyState) newAppSource(req models.SteadyStateRequest, sizes meanParameterizedDiscreteDistribution, rng *rand.Rand) *appSource {
+	apps := &appSource{
+		numApps:    req.NumApps,
+		sizes:      sizes,
+		meanSize:   s.meanInstancesPerApp(req),
+		sizeSeed:   rng.Int63(),
+		memorySeed: rng.Int63(),
+	}
+	if req.MeanAppMemoryMB > 0 {
+		apps.memory = s.AppMemoryDistribution
+		apps.meanMemoryMB = float64(req.MeanAppMemoryMB)
+	}
+	return apps
+}
+
+// eachSize calls f with the id and size of each app in turn, until ctx is
+// done.
+func (a *appSource) eachSize(ctx context.Context, f func(appId, size int) error) error {
+	rng := rand.New(rand.NewSource(a.sizeSeed))
+	for appId := 0; appId < a.numApps; appId++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size, err := a.sizes.Sample(ctx, rng, a.meanSize)
 		if err != nil {
 			return fmt.Errorf("sampling app size: %s", err)
 		}
-		totalInstances += resp.Apps[i].Size
+		if err := f(appId, size); err != nil {
+			return err
+		}
 	}
-	resp.TotalInstances = totalInstances
 	return nil
 }
 
-func (s *SteadyState) populateInstances(resp *models.SteadyStateResponse) error {
+// memoryMB returns the memory of every app, by id, or nil when the request
+// does not ask for memory.
+func (a *appSource) memoryMB(ctx context.Context) ([]int, error) {
+	if a.memory == nil {
+		return nil, nil
+	}
+	rng := rand.New(rand.NewSource(a.memorySeed))
+	memoryMB := make([]int, a.numApps)
+	for appId := range memoryMB {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		memoryMB[appId], err = a.memory.Sample(ctx, rng, a.meanMemoryMB)
+		if err != nil {
+			return nil, fmt.Errorf("sampling app memory: %s", err)
+		}
+	}
+	return memoryMB, nil
+}
+
+// each materializes the apps one at a time, in order.
+func (a *appSource) each(ctx context.Context, f func(models.App) error) error {
+	memoryRng := rand.New(rand.NewSource(a.memorySeed))
+	return a.eachSize(ctx, func(appId, size int) error {
+		app := models.App{Id: appId, Size: size}
+		if a.memory != nil {
+			var err error
+			app.MemoryMB, err = a.memory.Sample(ctx, memoryRng, a.meanMemoryMB)
+			if err != nil {
+				return fmt.Errorf("sampling app memory: %s", err)
+			}
+		}
+		return f(app)
+	})
+}
+
+func (s *SteadyState) populateTotalInstances(ctx context.Context, apps *appSource, resp *models.SteadyStateResponse) error {
+	resp.TotalInstances = 0
+	return apps.eachSize(ctx, func(_, size int) error {
+		resp.TotalInstances += size
+		return nil
+	})
+}
+
+// populateInstances places the instances of each app in turn, returning the
+// cluster, the placed instances and the number of instances that did not fit
+// on any host. Those instances are left out of the response.
+func (s *SteadyState) populateInstances(ctx context.Context, rng *rand.Rand, strategy placementStrategy, p *progress, apps *appSource, appMemoryMB []int, resp *models.SteadyStateResponse) (*cluster, *instanceSet, int, error) {
 	req := resp.Request
-	resp.Instances = make([]models.Instance, resp.TotalInstances)
+	instances := newInstanceSet(req.NumApps, resp.TotalInstances)
 
-	appId := 0
-	appInstanceCounter := 0
-	for i := 0; i < resp.TotalInstances; i++ {
-		resp.Instances[i].Id = i
+	hostIds := make([]int, req.NumHosts)
+	for i := range hostIds {
+		hostIds[i] = i
+	}
+	c := newCluster(rng, hostIds)
+	limitCluster(c, req, appMemoryMB)
+	c.setZones(req.NumZones)
 
-		if appInstanceCounter >= resp.Apps[appId].Size {
-			appId++
-			appInstanceCounter = 0
+	unplaced := 0
+	err := apps.eachSize(ctx, func(appId, size int) error {
+		p.step()
+		instances.startApp(appId)
+		for i := 0; i < size; i++ {
+			hostId, ok := strategy.place(c, appId)
+			if !ok {
+				// hosts only fill up, so the rest of the app won't fit either
+				unplaced += size - i
+				break
+			}
+			c.assign(appId, hostId)
+			instances.add(appId, hostId)
 		}
-		appInstanceCounter++
-
-		resp.Instances[i].AppId = appId
-		resp.Instances[i].HostId = i % req.NumHosts
+		c.forget(appId)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	return nil
+	return c, instances, unplaced, nil
 }
 
-func validateRange(noun string, value int, min, max int) error {
-	if value < min || value > max {
-		return fmt.Errorf("%s must be %d - %d", noun, min, max)
+func (s *SteadyState) populateHostStats(instances *instanceSet, resp *models.SteadyStateResponse) {
+	numHosts := resp.Request.NumHosts
+	instancesPerHost := make([]int, numHosts)
+	distinctAppsPerHost := make([]int, numHosts)
+
+	// an app is new to a host whenever it differs from the last app seen there
+	lastAppOnHost := make([]int, numHosts)
+	for i := range lastAppOnHost {
+		lastAppOnHost[i] = -1
+	}
+	for appId := 0; appId < instances.numApps(); appId++ {
+		for _, hostId := range instances.ofApp(appId) {
+			instancesPerHost[hostId]++
+			if lastAppOnHost[hostId] != appId {
+				lastAppOnHost[hostId] = appId
+				distinctAppsPerHost[hostId]++
+			}
+		}
+	}
+
+	resp.HostStats = models.HostStats{
+		InstancesPerHost:    instancesPerHost,
+		DistinctAppsPerHost: distinctAppsPerHost,
+		Instances:           summarize(instancesPerHost),
+		DistinctApps:        summarize(distinctAppsPerHost),
 	}
-	return nil
 }
 
+// Validate checks the whole request, returning a models.ValidationError
+// that lists every violation. Checks that depend on NumHosts are skipped
+// while it is invalid.
 func (s *SteadyState) Validate(req models.SteadyStateRequest) error {
-	if err := validateRange("NumHosts", req.NumHosts, 1, 1000); err != nil {
-		return err
+	var errs fieldErrors
+	req, err := withHostClasses(req)
+	errs.add(err)
+
+	hostsErr := validateRange("NumHosts", req.NumHosts, 1, maxHosts)
+	errs.add(hostsErr)
+	errs.add(validateRange("NumApps", req.NumApps, 1, 65534))
+	distribution, distributionErr := s.lookupAppSizeDistribution(req.AppSizeDistribution)
+	if _, ok := distribution.(histogram); ok && req.MeanInstancesPerApp == 0 {
+		if s.meanInstancesPerApp(req) > 100 {
+			errs.add(fieldError("AppSizeDistribution", "limit", req.AppSizeDistribution,
+				"the mean of AppSizeDistribution %s must be at most 100, or MeanInstancesPerApp must scale it", req.AppSizeDistribution))
+		}
+	} else {
+		errs.add(validateRange("MeanInstancesPerApp", req.MeanInstancesPerApp, 1, 100))
 	}
-	if err := validateRange("NumApps", req.NumApps, 1, 65534); err != nil {
-		return err
+	errs.add(distributionErr)
+	if _, _, err := lookupPlacementStrategy(req.PlacementStrategy); err != nil {
+		errs.add(err)
 	}
-	if err := validateRange("MeanInstancesPerApp", req.MeanInstancesPerApp, 1, 100); err != nil {
-		return err
+	errs.add(validateFloatRange("MeanPoliciesPerApp", req.MeanPoliciesPerApp, 0, 10))
+	errs.add(validateFloatRange("PolicyFanInSkew", req.PolicyFanInSkew, 0, 3))
+	if _, err := s.lookupPolicyVolumeDistribution(req); err != nil {
+		errs.add(err)
 	}
-	return nil
+	if hostsErr == nil {
+		if _, err := parseIPAMConfig(req); err != nil {
+			errs.add(err)
+		}
+		if _, err := numFailedHosts(req); err != nil {
+			errs.add(err)
+		}
+		errs.add(validateNumZones(req))
+	}
+	errs.add(validateRange("HostCapacity", req.HostCapacity, 0, 100000))
+	errs.add(validateRange("MeanAppMemoryMB", req.MeanAppMemoryMB, 0, 32768))
+	if req.MeanAppMemoryMB > 0 && s.AppMemoryDistribution == nil {
+		errs.add(fieldError("MeanAppMemoryMB", "unsupported", req.MeanAppMemoryMB,
+			"MeanAppMemoryMB is not supported without an AppMemoryDistribution"))
+	}
+	return errs.err()
 }
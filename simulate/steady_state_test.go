@@ -1,7 +1,9 @@
 package simulate_test
 
 import (
+	"context"
 	"errors"
+	"math"
 	"math/rand"
 
 	"code.cloudfoundry.org/lager/lagertest"
@@ -23,8 +25,8 @@ var _ = Describe("Steady state simulator", func() {
 
 	BeforeEach(func() {
 		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
-		appSizeDistribution.SampleStub = func(_ float64) (int, error) {
-			return req.MeanInstancesPerApp + rand.Intn(2) - 1, nil
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return req.MeanInstancesPerApp + rng.Intn(2) - 1, nil
 		}
 		sim = &simulate.SteadyState{
 			AppSizeDistribution: appSizeDistribution,
@@ -38,32 +40,94 @@ var _ = Describe("Steady state simulator", func() {
 	})
 
 	Describe("Execute", func() {
+		Context("when the context is done", func() {
+			var (
+				ctx    context.Context
+				cancel context.CancelFunc
+			)
+
+			BeforeEach(func() {
+				ctx, cancel = context.WithCancel(context.Background())
+			})
+
+			It("gives up before sampling", func() {
+				cancel()
+				_, err := sim.Execute(ctx, logger, req)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(appSizeDistribution.SampleCallCount()).To(Equal(0))
+			})
+
+			It("gives up between apps", func() {
+				appSizeDistribution.SampleStub = func(context.Context, *rand.Rand, float64) (int, error) {
+					if appSizeDistribution.SampleCallCount() == 10 {
+						cancel()
+					}
+					return 1, nil
+				}
+				_, err := sim.Execute(ctx, logger, req)
+				Expect(err).To(Equal(context.Canceled))
+				Expect(appSizeDistribution.SampleCallCount()).To(Equal(10))
+			})
+
+			It("passes the context to the distribution", func() {
+				sim.Execute(ctx, logger, req)
+				sampleCtx, _, _ := appSizeDistribution.SampleArgsForCall(0)
+				Expect(sampleCtx).To(Equal(ctx))
+			})
+		})
+
 		It("logs on start and stop", func() {
-			sim.Execute(logger, req)
+			sim.Execute(context.Background(), logger, req)
 			Expect(len(logger.LogMessages())).To(BeNumerically(">=", 2))
 		})
 
 		It("logs the structured request and responses", func() {
-			sim.Execute(logger, req)
+			sim.Execute(context.Background(), logger, req)
 
 			Expect(logger.Buffer()).To(gbytes.Say(`start.*input.*1000`))
 			Expect(logger.Buffer()).To(gbytes.Say(`success`))
 		})
 
 		It("returns the request data along with the response", func() {
-			resp, err := sim.Execute(logger, req)
+			resp, err := sim.Execute(context.Background(), logger, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(resp.Request).To(Equal(req))
 		})
 
+		It("echoes the seed from the request", func() {
+			req.Seed = 42
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Seed).To(Equal(int64(42)))
+		})
+
+		It("generates a non-zero seed when the request does not include one", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Seed).NotTo(BeZero())
+			Expect(resp.Request.Seed).To(BeZero())
+		})
+
+		It("produces identical results when replayed with the same seed", func() {
+			first, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			req.Seed = first.Seed
+			second, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(second.Apps).To(Equal(first.Apps))
+			Expect(second.Instances).To(Equal(first.Instances))
+		})
+
 		It("computes the average instances per host", func() {
-			resp, err := sim.Execute(logger, req)
+			resp, err := sim.Execute(context.Background(), logger, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(resp.MeanInstancesPerHost).To(Equal(50.0))
 		})
 
 		It("populates the Apps list by sampling from the AppSizeDistribution", func() {
-			resp, err := sim.Execute(logger, req)
+			resp, err := sim.Execute(context.Background(), logger, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(resp.Apps).To(HaveLen(10000))
 			for _, app := range resp.Apps {
@@ -72,7 +136,7 @@ var _ = Describe("Steady state simulator", func() {
 		})
 
 		It("populates the Instances list by trying to put apps on different hosts", func() {
-			resp, err := sim.Execute(logger, req)
+			resp, err := sim.Execute(context.Background(), logger, req)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(resp.Instances).To(HaveLen(resp.TotalInstances))
 
@@ -103,18 +167,201 @@ var _ = Describe("Steady state simulator", func() {
 			Expect(min).To(Equal(max - 1))
 		})
 
+		Describe("per-host statistics", func() {
+			It("counts the instances on every host", func() {
+				resp, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.HostStats.InstancesPerHost).To(HaveLen(req.NumHosts))
+
+				total := 0
+				for _, count := range resp.HostStats.InstancesPerHost {
+					total += count
+				}
+				Expect(total).To(Equal(resp.TotalInstances))
+				Expect(resp.HostStats.Instances.Max - resp.HostStats.Instances.Min).To(BeNumerically("<=", 1))
+			})
+
+			It("summarizes instances and distinct apps per host", func() {
+				req.NumHosts = 4
+				req.NumApps = 3
+				sizes := []int{3, 1, 2}
+				appSizeDistribution.SampleStub = func(_ context.Context, _ *rand.Rand, _ float64) (int, error) {
+					// every pass over the apps samples them again, in order
+					return sizes[(appSizeDistribution.SampleCallCount()-1)%len(sizes)], nil
+				}
+
+				resp, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resp.HostStats.InstancesPerHost).To(Equal([]int{2, 2, 1, 1}))
+				Expect(resp.HostStats.DistinctAppsPerHost).To(Equal([]int{2, 2, 1, 1}))
+				Expect(resp.HostStats.Instances).To(Equal(models.Summary{
+					Min:    1,
+					Max:    2,
+					Mean:   1.5,
+					StdDev: 0.5,
+					P50:    1,
+					P90:    2,
+					P99:    2,
+				}))
+			})
+		})
+
+		Context("when the request names an app size distribution", func() {
+			var named *fakes.MeanParameterizedDiscreteDistribution
+
+			BeforeEach(func() {
+				named = &fakes.MeanParameterizedDiscreteDistribution{}
+				named.SampleReturns(7, nil)
+				sim.AppSizeDistributions = simulate.NamedDistributions{"banana": named}
+				req.NumApps = 10
+				req.AppSizeDistribution = "banana"
+			})
+
+			It("samples app sizes from that distribution instead", func() {
+				resp, err := sim.Execute(context.Background(), logger, req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.TotalInstances).To(Equal(70))
+
+				Expect(appSizeDistribution.SampleCallCount()).To(Equal(0))
+				// once to total the instances, once to place them and once
+				// to materialize the apps
+				Expect(named.SampleCallCount()).To(Equal(30))
+				_, _, mean := named.SampleArgsForCall(0)
+				Expect(mean).To(Equal(5.0))
+			})
+		})
+
 		Context("when sampling from the app size distribution fails", func() {
 			BeforeEach(func() {
 				appSizeDistribution.SampleReturns(0, errors.New("banana"))
 			})
 
 			It("wraps and returns the error", func() {
-				_, err := sim.Execute(logger, req)
+				_, err := sim.Execute(context.Background(), logger, req)
 				Expect(err).To(MatchError("sampling app size: banana"))
 			})
 		})
 	})
 
+	Describe("Observer", func() {
+		var observer *fakes.SimulationObserver
+
+		BeforeEach(func() {
+			observer = &fakes.SimulationObserver{}
+			sim.Observer = observer
+			req.NumHosts = 20
+			req.NumApps = 100
+		})
+
+		stages := func() []string {
+			var names []string
+			for i := 0; i < observer.StageFinishedCallCount(); i++ {
+				name, _ := observer.StageFinishedArgsForCall(i)
+				names = append(names, name)
+			}
+			return names
+		}
+
+		It("is told how a successful simulation went, stage by stage", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(observer.StartedCallCount()).To(Equal(1))
+			Expect(observer.FinishedCallCount()).To(Equal(1))
+			outcome, duration, instances := observer.FinishedArgsForCall(0)
+			Expect(outcome).To(Equal("success"))
+			Expect(duration).To(BeNumerically(">", 0))
+			Expect(instances).To(Equal(len(resp.Instances)))
+
+			Expect(stages()).To(Equal([]string{
+				"setup", "apps", "placement", "host-stats", "network", "policies", "traffic",
+			}))
+		})
+
+		It("times the optional stages only when the request asks for them", func() {
+			req.NumZones = 3
+			req.FailedHostFraction = 0.1
+			_, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stages()).To(ContainElement("zones"))
+			Expect(stages()).To(ContainElement("evacuation"))
+		})
+
+		It("times writing a streamed response", func() {
+			Expect(sim.Stream(context.Background(), logger, req, &recordingWriter{})).To(Succeed())
+			Expect(stages()).To(HaveLen(8))
+			Expect(stages()[7]).To(Equal("write"))
+		})
+
+		It("is told of a simulation that failed", func() {
+			appSizeDistribution.SampleReturns(0, errors.New("banana"))
+			sim.Execute(context.Background(), logger, req)
+
+			outcome, _, instances := observer.FinishedArgsForCall(0)
+			Expect(outcome).To(Equal("error"))
+			Expect(instances).To(Equal(0))
+			Expect(stages()).To(Equal([]string{"setup"}))
+		})
+
+		It("is told of a simulation that was cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			sim.Execute(ctx, logger, req)
+
+			outcome, _, _ := observer.FinishedArgsForCall(0)
+			Expect(outcome).To(Equal("cancelled"))
+		})
+	})
+
+	Describe("Stream", func() {
+		It("writes the same response as Execute, in pieces", func() {
+			req.NumHosts = 20
+			req.NumApps = 100
+			req.Seed = 42
+			req.NumZones = 3
+			req.MeanPoliciesPerApp = 2
+			req.OverlayCIDR = "10.255.0.0/16"
+			req.HostSubnetPrefixLength = 29
+			expected, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			out := &recordingWriter{}
+			Expect(sim.Stream(context.Background(), logger, req, out)).To(Succeed())
+			Expect(out.closed).To(BeTrue())
+			Expect(out.summary.Apps).To(BeNil())
+			Expect(out.summary.Instances).To(BeNil())
+			Expect(out.summary.Policies).To(BeNil())
+
+			streamed := *out.summary
+			streamed.Apps, streamed.Instances, streamed.Policies = out.apps, out.instances, out.policies
+			Expect(streamed).To(Equal(*expected))
+		})
+
+		It("stops writing instances once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			out := &recordingWriter{onSummary: cancel}
+			Expect(sim.Stream(ctx, logger, req, out)).To(Equal(context.Canceled))
+			Expect(out.instances).To(BeEmpty())
+			Expect(out.closed).To(BeFalse())
+		})
+
+		It("stops when the writer fails", func() {
+			out := &recordingWriter{failAfter: 10}
+			Expect(sim.Stream(context.Background(), logger, req, out)).To(MatchError("banana"))
+			Expect(out.instances).To(HaveLen(10))
+			Expect(out.closed).To(BeFalse())
+		})
+
+		It("does not write anything when the simulation fails", func() {
+			appSizeDistribution.SampleReturns(0, errors.New("banana"))
+			out := &recordingWriter{}
+			Expect(sim.Stream(context.Background(), logger, req, out)).To(MatchError("sampling app size: banana"))
+			Expect(out.summary).To(BeNil())
+		})
+	})
+
 	Describe("Validate", func() {
 		It("returns nil when values are within their allowed ranges", func() {
 			Expect(sim.Validate(req)).To(Succeed())
@@ -145,5 +392,107 @@ var _ = Describe("Steady state simulator", func() {
 			bad.MeanInstancesPerApp = 101
 			Expect(sim.Validate(bad)).To(MatchError("MeanInstancesPerApp must be 1 - 100"))
 		})
+		It("returns an error when the app size distribution is unknown", func() {
+			sim.AppSizeDistributions = simulate.NamedDistributions{
+				"zipf":      &fakes.MeanParameterizedDiscreteDistribution{},
+				"geometric": &fakes.MeanParameterizedDiscreteDistribution{},
+			}
+			req.AppSizeDistribution = "geometric"
+			Expect(sim.Validate(req)).To(Succeed())
+
+			req.AppSizeDistribution = "banana"
+			Expect(sim.Validate(req)).To(MatchError("AppSizeDistribution must be one of: geometric, zipf"))
+		})
+		It("reports every invalid field at once", func() {
+			req.NumApps = 0
+			req.PlacementStrategy = "banana"
+			req.PolicyFanInSkew = 4
+
+			err := sim.Validate(req)
+			Expect(err).To(MatchError("NumApps must be 1 - 65534; " +
+				"PlacementStrategy must be one of: least-loaded, random, round-robin, spread, zone-balanced; " +
+				"PolicyFanInSkew must be 0 - 3"))
+
+			fields := err.(models.ValidationError)
+			Expect(fields).To(HaveLen(3))
+			Expect(fields[0].Field).To(Equal("NumApps"))
+			Expect(fields[0].Constraint).To(Equal("range"))
+			Expect(*fields[0].Min).To(Equal(1.0))
+			Expect(*fields[0].Max).To(Equal(65534.0))
+			Expect(fields[0].Got).To(Equal(0))
+
+			Expect(fields[1].Field).To(Equal("PlacementStrategy"))
+			Expect(fields[1].Constraint).To(Equal("one-of"))
+			Expect(fields[1].Got).To(Equal("banana"))
+			Expect(fields[1].Min).To(BeNil())
+
+			Expect(fields[2].Field).To(Equal("PolicyFanInSkew"))
+			Expect(fields[2].Got).To(Equal(4.0))
+		})
+		It("skips the checks that depend on an invalid NumHosts", func() {
+			req.NumHosts = 0
+			req.NumZones = 3
+			req.OverlayCIDR = "10.255.0.0/30"
+
+			err := sim.Validate(req)
+			Expect(err).To(MatchError("NumHosts must be 1 - 1000"))
+		})
+		It("reports every invalid host class", func() {
+			req.NumHosts = 0
+			req.HostClasses = []models.HostClass{
+				{Name: "small", Count: 0, Slots: 10},
+				{Name: "large", Count: 5, Slots: 0},
+			}
+
+			err := sim.Validate(req)
+			Expect(err).To(MatchError("HostClasses[0].Count must be 1 - 1000; HostClasses[1].Slots must be 1 - 100000"))
+		})
+		It("spells out values that JSON cannot encode", func() {
+			req.MeanPoliciesPerApp = math.NaN()
+
+			err := sim.Validate(req)
+			Expect(err.(models.ValidationError)[0].Got).To(Equal("NaN"))
+		})
 	})
 })
+
+type recordingWriter struct {
+	summary   *models.SteadyStateResponse
+	apps      []models.App
+	instances []models.Instance
+	policies  []models.Policy
+	closed    bool
+	failAfter int // instances, if positive
+	onSummary func()
+}
+
+func (w *recordingWriter) WriteSummary(resp *models.SteadyStateResponse) error {
+	w.summary = resp
+	if w.onSummary != nil {
+		w.onSummary()
+	}
+	return nil
+}
+
+func (w *recordingWriter) WriteApp(app models.App) error {
+	w.apps = append(w.apps, app)
+	return nil
+}
+
+func (w *recordingWriter) WriteInstance(instance models.Instance) error {
+	if w.failAfter > 0 && len(w.instances) == w.failAfter {
+		return errors.New("banana")
+	}
+	w.instances = append(w.instances, instance)
+	return nil
+}
+
+func (w *recordingWriter) WritePolicy(policy models.Policy) error {
+	w.policies = append(w.policies, policy)
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,159 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const (
+	maxSweepPoints = 1000
+
+	// bounds the expected number of instances simulated across all points
+	maxSweepInstances = 100000000
+)
+
+// Sweep runs a steady state simulation at each value of one request
+// parameter. Every point uses the same seed, so that differences between
+// points come from the parameter rather than from sampling noise.
+type Sweep struct {
+	SteadyState *SteadyState
+	Workers     int // defaults to 1
+}
+
+type sweepParameter struct {
+	integer bool
+	set     func(req *models.SteadyStateRequest, value float64)
+}
+
+var sweepParameters = map[string]sweepParameter{
+	"NumHosts":               {true, func(r *models.SteadyStateRequest, v float64) { r.NumHosts = int(v) }},
+	"NumApps":                {true, func(r *models.SteadyStateRequest, v float64) { r.NumApps = int(v) }},
+	"MeanInstancesPerApp":    {true, func(r *models.SteadyStateRequest, v float64) { r.MeanInstancesPerApp = int(v) }},
+	"MeanPoliciesPerApp":     {false, func(r *models.SteadyStateRequest, v float64) { r.MeanPoliciesPerApp = v }},
+	"PolicyFanInSkew":        {false, func(r *models.SteadyStateRequest, v float64) { r.PolicyFanInSkew = v }},
+	"MeanPolicyVolume":       {false, func(r *models.SteadyStateRequest, v float64) { r.MeanPolicyVolume = v }},
+	"HostSubnetPrefixLength": {true, func(r *models.SteadyStateRequest, v float64) { r.HostSubnetPrefixLength = int(v) }},
+	"FailedHosts":            {true, func(r *models.SteadyStateRequest, v float64) { r.FailedHosts = int(v) }},
+	"FailedHostFraction":     {false, func(r *models.SteadyStateRequest, v float64) { r.FailedHostFraction = v }},
+	"HostCapacity":           {true, func(r *models.SteadyStateRequest, v float64) { r.HostCapacity = int(v) }},
+	"MeanAppMemoryMB":        {true, func(r *models.SteadyStateRequest, v float64) { r.MeanAppMemoryMB = int(v) }},
+	"NumZones":               {true, func(r *models.SteadyStateRequest, v float64) { r.NumZones = int(v) }},
+}
+
+func sweepParameterNames() []string {
+	names := make([]string, 0, len(sweepParameters))
+	for name := range sweepParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Sweep) Execute(ctx context.Context, logger lager.Logger, req models.SweepRequest) (*models.SweepResponse, error) {
+	logger.Info("start", lager.Data{"input": req})
+	defer logger.Info("done")
+
+	var resp models.SweepResponse
+	resp.Request = req
+	resp.Seed = req.Seed
+	if resp.Seed == 0 {
+		resp.Seed = newSeed()
+	}
+	strategyName, _, err := lookupPlacementStrategy(req.PlacementStrategy)
+	if err != nil {
+		return nil, err
+	}
+	resp.PlacementStrategy = strategyName
+
+	values, pointReqs, err := sweepPoints(req)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pointReqs {
+		pointReqs[i].Seed = resp.Seed
+	}
+
+	pointMetrics, err := runParallel(ctx, logger, s.SteadyState, s.Workers, pointReqs)
+	if err != nil {
+		return nil, fmt.Errorf("point: %s", err)
+	}
+
+	resp.Points = make([]models.SweepPoint, len(values))
+	for i, value := range values {
+		resp.Points[i] = models.SweepPoint{Value: value, Metrics: pointMetrics[i]}
+	}
+
+	logger.Info("success")
+	return &resp, nil
+}
+
+func sweepPoints(req models.SweepRequest) ([]float64, []models.SteadyStateRequest, error) {
+	var errs fieldErrors
+	param, ok := sweepParameters[req.Parameter]
+	if !ok {
+		errs.add(fieldError("Parameter", "one-of", req.Parameter, "Parameter must be one of: %s", strings.Join(sweepParameterNames(), ", ")))
+	}
+	if !(req.Step > 0) {
+		errs.add(fieldError("Step", "positive", req.Step, "Step must be positive"))
+	}
+	if !(req.From <= req.To) {
+		errs.add(fieldError("From", "order", req.From, "From must not exceed To"))
+	}
+	if ok && param.integer && (req.From != math.Trunc(req.From) || req.Step != math.Trunc(req.Step)) {
+		errs.add(fieldError("", "integer", nil, "From and Step must be whole numbers for %s", req.Parameter))
+	}
+	if err := errs.err(); err != nil {
+		return nil, nil, err
+	}
+
+	numPoints := math.Floor((req.To-req.From)/req.Step+1e-9) + 1
+	if numPoints > maxSweepPoints {
+		return nil, nil, fieldError("Step", "limit", req.Step, "sweep must have at most %d points", maxSweepPoints)
+	}
+
+	values := make([]float64, int(numPoints))
+	reqs := make([]models.SteadyStateRequest, len(values))
+	for i := range values {
+		values[i] = req.From + float64(i)*req.Step
+		reqs[i] = req.SteadyStateRequest
+		param.set(&reqs[i], values[i])
+	}
+	return values, reqs, nil
+}
+
+func (s *Sweep) Validate(req models.SweepRequest) error {
+	values, pointReqs, err := sweepPoints(req)
+	if err != nil {
+		return err
+	}
+
+	// report only the first invalid point, since the rest usually repeat it
+	totalInstances := 0.0
+	for i, pointReq := range pointReqs {
+		if err := s.SteadyState.Validate(pointReq); err != nil {
+			return atPoint(fmt.Sprintf("at %s=%g: ", req.Parameter, values[i]), err)
+		}
+		totalInstances += float64(pointReq.NumApps) * s.SteadyState.meanInstancesPerApp(pointReq)
+	}
+	if totalInstances > maxSweepInstances {
+		return fieldError("", "limit", nil, "sweep would simulate %.0f instances, more than the limit of %d", totalInstances, maxSweepInstances)
+	}
+	return nil
+}
+
+// atPoint prefixes the message of every violation with the sweep point.
+func atPoint(prefix string, err error) error {
+	var errs fieldErrors
+	errs.add(err)
+	for i := range errs {
+		errs[i].Message = prefix + errs[i].Message
+	}
+	return errs.err()
+}
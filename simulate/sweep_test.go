@@ -0,0 +1,145 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Sweep simulator", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		steadyState         *simulate.SteadyState
+		sim                 *simulate.Sweep
+		logger              *lagertest.TestLogger
+		req                 models.SweepRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, mean float64) (int, error) {
+			return 1 + rng.Intn(2*int(mean)-1), nil
+		}
+		steadyState = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		sim = &simulate.Sweep{
+			SteadyState: steadyState,
+			Workers:     4,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SweepRequest{
+			SteadyStateRequest: models.SteadyStateRequest{
+				NumHosts:            10,
+				NumApps:             200,
+				MeanInstancesPerApp: 5,
+			},
+			Parameter: "NumHosts",
+			From:      10,
+			To:        100,
+			Step:      10,
+		}
+	})
+
+	Describe("Execute", func() {
+		It("runs the simulation at every point in the range", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Points).To(HaveLen(10))
+			for i, point := range resp.Points {
+				Expect(point.Value).To(Equal(float64(10 * (i + 1))))
+				Expect(point.Metrics).To(HaveKey("HostStats.Instances.Max"))
+			}
+		})
+
+		It("uses the same seed at every point", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("sampling the same apps, since NumHosts does not affect app sizes")
+			for _, point := range resp.Points {
+				Expect(point.Metrics["TotalInstances"]).To(Equal(resp.Points[0].Metrics["TotalInstances"]))
+			}
+
+			By("matching a single run with that seed")
+			pointReq := req.SteadyStateRequest
+			pointReq.NumHosts = 30
+			pointReq.Seed = resp.Seed
+			single, err := steadyState.Execute(context.Background(), logger, pointReq)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Points[2].Metrics["HostStats.Instances.Max"]).To(Equal(float64(single.HostStats.Instances.Max)))
+		})
+
+		It("sweeps fractional parameters", func() {
+			req.Parameter = "MeanPoliciesPerApp"
+			req.From = 0
+			req.To = 1
+			req.Step = 0.25
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Points).To(HaveLen(5))
+			Expect(resp.Points[4].Value).To(Equal(1.0))
+			Expect(resp.Points[0].Metrics["PolicyStats.TotalRules"]).To(Equal(0.0))
+			Expect(resp.Points[4].Metrics["PolicyStats.TotalRules"]).To(BeNumerically(">", 0))
+		})
+
+		It("gives up once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := sim.Execute(ctx, logger, req)
+			Expect(err).To(MatchError("point: context canceled"))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("returns nil for a valid sweep", func() {
+			Expect(sim.Validate(req)).To(Succeed())
+		})
+
+		It("rejects unknown parameters", func() {
+			req.Parameter = "Banana"
+			Expect(sim.Validate(req)).To(MatchError(HavePrefix("Parameter must be one of: FailedHostFraction, FailedHosts")))
+		})
+
+		It("rejects malformed ranges", func() {
+			bad := req
+			bad.Step = 0
+			Expect(sim.Validate(bad)).To(MatchError("Step must be positive"))
+
+			bad = req
+			bad.From = 200
+			Expect(sim.Validate(bad)).To(MatchError("From must not exceed To"))
+
+			bad = req
+			bad.Step = 2.5
+			Expect(sim.Validate(bad)).To(MatchError("From and Step must be whole numbers for NumHosts"))
+
+			bad = req
+			bad.From = 1
+			bad.To = 1000
+			bad.Step = 0.5
+			bad.Parameter = "PolicyFanInSkew"
+			Expect(sim.Validate(bad)).To(MatchError("sweep must have at most 1000 points"))
+		})
+
+		It("validates the request at every point", func() {
+			req.To = 1010
+			Expect(sim.Validate(req)).To(MatchError("at NumHosts=1010: NumHosts must be 1 - 1000"))
+		})
+
+		It("rejects sweeps over the instance budget", func() {
+			req.Parameter = "NumApps"
+			req.From = 1000
+			req.To = 65000
+			req.Step = 1000
+			req.MeanInstancesPerApp = 100
+			Expect(sim.Validate(req)).To(MatchError("sweep would simulate 214500000 instances, more than the limit of 100000000"))
+		})
+	})
+})
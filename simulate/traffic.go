@@ -0,0 +1,85 @@
+package simulate
+
+import (
+	"context"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const maxMeanPolicyVolume = 1000
+
+func (s *SteadyState) lookupPolicyVolumeDistribution(req models.SteadyStateRequest) (meanParameterizedDiscreteDistribution, error) {
+	if req.PolicyVolumeDistribution == "" {
+		if req.MeanPolicyVolume != 0 {
+			return nil, fieldError("MeanPolicyVolume", "requires", req.MeanPolicyVolume, "MeanPolicyVolume requires PolicyVolumeDistribution")
+		}
+		return nil, nil
+	}
+	if err := validateFloatRange("MeanPolicyVolume", req.MeanPolicyVolume, 1, maxMeanPolicyVolume); err != nil {
+		return nil, err
+	}
+	return s.lookupDistribution("PolicyVolumeDistribution", req.PolicyVolumeDistribution)
+}
+
+// populateTraffic splits the volume of each policy across every pair of
+// source and destination instances, other than an instance with itself.
+func (s *SteadyState) populateTraffic(ctx context.Context, policies *policySource, instances *instanceSet, resp *models.SteadyStateResponse) error {
+	req := resp.Request
+
+	numZones := req.NumZones
+	if numZones < 1 {
+		numZones = 1
+	}
+	destinationsOnHost := make([]int, req.NumHosts)
+	destinationsInZone := make([]int, numZones)
+	var stats models.TrafficStats
+	err := policies.each(ctx, func(policy models.Policy) error {
+		sources := instances.ofApp(policy.SourceAppId)
+		destinations := instances.ofApp(policy.DestinationAppId)
+
+		for _, hostId := range destinations {
+			destinationsOnHost[hostId]++
+			destinationsInZone[zoneOf(int(hostId), numZones)]++
+		}
+		pairs, local, sameZone := len(sources)*len(destinations), 0, 0
+		for _, hostId := range sources {
+			local += destinationsOnHost[hostId]
+			sameZone += destinationsInZone[zoneOf(int(hostId), numZones)]
+		}
+		for _, hostId := range destinations {
+			destinationsOnHost[hostId] = 0
+			destinationsInZone[zoneOf(int(hostId), numZones)] = 0
+		}
+
+		if policy.SourceAppId == policy.DestinationAppId {
+			pairs -= len(sources)
+			local -= len(sources)
+			sameZone -= len(sources)
+		}
+		if pairs == 0 {
+			return nil
+		}
+
+		volume := 1.0
+		if req.PolicyVolumeDistribution != "" {
+			volume = float64(policy.Volume)
+		}
+		perPair := volume / float64(pairs)
+		stats.TotalVolume += volume
+		stats.HostLocalVolume += perPair * float64(local)
+		stats.CrossHostVolume += perPair * float64(sameZone-local)
+		stats.CrossZoneVolume += perPair * float64(pairs-sameZone)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if stats.TotalVolume > 0 {
+		stats.HostLocalFraction = stats.HostLocalVolume / stats.TotalVolume
+		stats.CrossHostFraction = stats.CrossHostVolume / stats.TotalVolume
+		stats.CrossZoneFraction = stats.CrossZoneVolume / stats.TotalVolume
+	}
+	resp.Traffic = stats
+	return nil
+}
@@ -0,0 +1,151 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Traffic estimation", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		volumeDistribution  *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleReturns(4, nil)
+		volumeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		volumeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(100), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+			AppSizeDistributions: simulate.NamedDistributions{
+				"volume": volumeDistribution,
+			},
+		}
+		logger = lagertest.NewTestLogger("test")
+
+		// a single app with one instance per host, and zones 0, 1, 0, 1
+		req = models.SteadyStateRequest{
+			NumHosts:            4,
+			NumApps:             1,
+			MeanInstancesPerApp: 4,
+			MeanPoliciesPerApp:  3,
+			NumZones:            2,
+		}
+	})
+
+	It("splits flows between hosts into those within and across zones", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("counting each instance's flows to the other three instances")
+		traffic := resp.Traffic
+		Expect(traffic.TotalVolume).To(Equal(3.0))
+		Expect(traffic.HostLocalVolume).To(Equal(0.0))
+		Expect(traffic.CrossHostVolume).To(BeNumerically("~", 1.0, 1e-9))
+		Expect(traffic.CrossZoneVolume).To(BeNumerically("~", 2.0, 1e-9))
+		Expect(traffic.CrossHostFraction).To(BeNumerically("~", 1.0/3, 1e-9))
+		Expect(traffic.CrossZoneFraction).To(BeNumerically("~", 2.0/3, 1e-9))
+	})
+
+	It("counts flows between instances on the same host as local", func() {
+		req.NumHosts = 1
+		req.NumZones = 0
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Traffic.HostLocalFraction).To(Equal(1.0))
+		Expect(resp.Traffic.CrossHostFraction).To(Equal(0.0))
+		Expect(resp.Traffic.CrossZoneFraction).To(Equal(0.0))
+	})
+
+	It("accounts for all of the traffic", func() {
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 1 + rng.Intn(9), nil
+		}
+		req.NumHosts = 50
+		req.NumApps = 500
+		req.NumZones = 0
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		traffic := resp.Traffic
+		Expect(traffic.CrossZoneVolume).To(Equal(0.0))
+		Expect(traffic.HostLocalVolume + traffic.CrossHostVolume).To(BeNumerically("~", traffic.TotalVolume, 1e-6))
+		Expect(traffic.HostLocalFraction + traffic.CrossHostFraction).To(BeNumerically("~", 1, 1e-9))
+		Expect(traffic.HostLocalFraction).To(BeNumerically(">", 0))
+		Expect(traffic.CrossHostFraction).To(BeNumerically(">", 0))
+	})
+
+	Context("when policy volumes are sampled", func() {
+		BeforeEach(func() {
+			// app 0 on hosts 0 and 1, app 1 on host 0
+			sizes := []int{2, 1}
+			appSizeDistribution.SampleStub = func(_ context.Context, _ *rand.Rand, _ float64) (int, error) {
+				// every pass over the apps samples them again, in order
+				return sizes[(appSizeDistribution.SampleCallCount()-1)%len(sizes)], nil
+			}
+			req.NumHosts = 2
+			req.NumApps = 2
+			req.NumZones = 0
+			req.MeanPoliciesPerApp = 10
+			req.PolicyVolumeDistribution = "volume"
+			req.MeanPolicyVolume = 50
+		})
+
+		It("weights each policy's flows by its volume", func() {
+			resp, err := sim.Execute(context.Background(), logger, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, mean := volumeDistribution.SampleArgsForCall(0)
+			Expect(mean).To(Equal(50.0))
+
+			// fraction of each policy's flows that are local, by source and destination app
+			localFraction := [2][2]float64{{0, 0.5}, {0.5, 0}}
+			total, local := 0.0, 0.0
+			for _, policy := range resp.Policies {
+				Expect(policy.Volume).To(BeNumerically(">=", 1))
+				if policy.SourceAppId == 1 && policy.DestinationAppId == 1 {
+					continue // a single instance does not talk to itself
+				}
+				total += float64(policy.Volume)
+				local += float64(policy.Volume) * localFraction[policy.SourceAppId][policy.DestinationAppId]
+			}
+			Expect(resp.Traffic.TotalVolume).To(Equal(total))
+			Expect(resp.Traffic.HostLocalVolume).To(BeNumerically("~", local, 1e-9))
+			Expect(resp.Traffic.HostLocalFraction).To(BeNumerically("~", local/total, 1e-9))
+		})
+	})
+
+	Describe("validation", func() {
+		It("requires a known volume distribution", func() {
+			req.PolicyVolumeDistribution = "banana"
+			req.MeanPolicyVolume = 10
+			Expect(sim.Validate(req)).To(MatchError("PolicyVolumeDistribution must be one of: volume"))
+		})
+
+		It("requires a mean volume in range", func() {
+			req.PolicyVolumeDistribution = "volume"
+			Expect(sim.Validate(req)).To(MatchError("MeanPolicyVolume must be 1 - 1000"))
+
+			req.MeanPolicyVolume = 1001
+			Expect(sim.Validate(req)).To(MatchError("MeanPolicyVolume must be 1 - 1000"))
+		})
+
+		It("requires a volume distribution for a mean volume", func() {
+			req.MeanPolicyVolume = 10
+			Expect(sim.Validate(req)).To(MatchError("MeanPolicyVolume requires PolicyVolumeDistribution"))
+		})
+	})
+})
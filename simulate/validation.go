@@ -0,0 +1,73 @@
+package simulate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+func validateRange(noun string, value int, min, max int) error {
+	if value < min || value > max {
+		return rangeError(noun, value, float64(min), float64(max), fmt.Sprintf("%s must be %d - %d", noun, min, max))
+	}
+	return nil
+}
+
+func validateFloatRange(noun string, value float64, min, max float64) error {
+	if !(value >= min && value <= max) { // also rejects NaN
+		return rangeError(noun, value, min, max, fmt.Sprintf("%s must be %g - %g", noun, min, max))
+	}
+	return nil
+}
+
+func rangeError(noun string, got interface{}, min, max float64, message string) error {
+	return models.FieldError{
+		Field:      noun,
+		Constraint: "range",
+		Min:        &min,
+		Max:        &max,
+		Got:        jsonValue(got),
+		Message:    message,
+	}
+}
+
+// fieldError describes a violation of any other constraint.
+func fieldError(noun, constraint string, got interface{}, format string, args ...interface{}) error {
+	return models.FieldError{
+		Field:      noun,
+		Constraint: constraint,
+		Got:        jsonValue(got),
+		Message:    fmt.Sprintf(format, args...),
+	}
+}
+
+// jsonValue spells out the floats that JSON has no encoding for.
+func jsonValue(got interface{}) interface{} {
+	if value, ok := got.(float64); ok && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		return fmt.Sprint(value)
+	}
+	return got
+}
+
+// fieldErrors collects violations so that a request can be checked in full.
+type fieldErrors models.ValidationError
+
+func (e *fieldErrors) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case models.ValidationError:
+		*e = append(*e, err...)
+	case models.FieldError:
+		*e = append(*e, err)
+	default:
+		*e = append(*e, models.FieldError{Constraint: "invalid", Message: err.Error()})
+	}
+}
+
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return models.ValidationError(e)
+}
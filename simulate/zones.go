@@ -0,0 +1,173 @@
+package simulate
+
+import (
+	"container/heap"
+
+	"github.com/rosenhouse/cnsim/models"
+)
+
+const maxZones = 100
+
+// zoneHeap orders the hosts of one zone by load, like hostHeap.
+type zoneHeap []*hostEntry
+
+func (h zoneHeap) Len() int           { return len(h) }
+func (h zoneHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+func (h zoneHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].zoneIndex = i
+	h[j].zoneIndex = j
+}
+func (h *zoneHeap) Push(x interface{}) {
+	entry := x.(*hostEntry)
+	entry.zoneIndex = len(*h)
+	*h = append(*h, entry)
+}
+func (h *zoneHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// validateNumZones requires every zone to have at least one host.
+func validateNumZones(req models.SteadyStateRequest) error {
+	max := maxZones
+	if req.NumHosts < max {
+		max = req.NumHosts
+	}
+	return validateRange("NumZones", req.NumZones, 0, max)
+}
+
+func zoneOf(hostId, numZones int) int {
+	if numZones < 2 {
+		return 0
+	}
+	return hostId % numZones
+}
+
+// setZones assigns the hosts of a cluster, which must be empty, to zones.
+func (c *cluster) setZones(numZones int) {
+	if numZones < 2 {
+		return
+	}
+	c.byZone = make([]zoneHeap, numZones)
+	c.zoneLoads = make([]int, numZones)
+	c.appZones = make([]int, numZones)
+	for _, id := range c.hostIds {
+		entry := c.byHost[id]
+		entry.zone = zoneOf(id, numZones)
+		heap.Push(&c.byZone[entry.zone], entry)
+	}
+}
+
+func (c *cluster) addToZone(entry *hostEntry, delta int) {
+	if c.byZone == nil {
+		return
+	}
+	heap.Fix(&c.byZone[entry.zone], entry.zoneIndex)
+	c.zoneLoads[entry.zone] += delta
+}
+
+// zoneBalanced puts each instance in the zone with the fewest instances of
+// the same app, preferring the zone with the least load overall, and on the
+// least loaded host in that zone. Zones with no room are skipped.
+type zoneBalanced struct{}
+
+func (zoneBalanced) place(c *cluster, appId int) (int, bool) {
+	if c.byZone == nil {
+		return leastLoaded{}.place(c, appId)
+	}
+
+	_, appZones := c.appInstances(appId)
+	count := func(zone int) int {
+		if appZones == nil {
+			return 0
+		}
+		return appZones[zone]
+	}
+	fits := func(id int) bool {
+		return c.fits(id, appId)
+	}
+
+	var tried []bool // only needed once a zone turns out to be full
+	for range c.byZone {
+		best := -1
+		for zone := range c.byZone {
+			if (tried != nil && tried[zone]) || len(c.byZone[zone]) == 0 {
+				continue
+			}
+			if best < 0 || count(zone) < count(best) ||
+				(count(zone) == count(best) && c.zoneLoads[zone] < c.zoneLoads[best]) {
+				best = zone
+			}
+		}
+		if best < 0 {
+			break
+		}
+		if id, ok := leastLoadedIn(c.byZone[best], fits); ok {
+			return id, true
+		}
+		if tried == nil {
+			tried = make([]bool, len(c.byZone))
+		}
+		tried[best] = true
+	}
+	return 0, false
+}
+
+func (s *SteadyState) populateZones(instances *instanceSet, resp *models.SteadyStateResponse) {
+	req := resp.Request
+	numZones := req.NumZones
+
+	stats := &models.ZoneStats{
+		NumZones:         numZones,
+		HostsPerZone:     make([]int, numZones),
+		InstancesPerZone: make([]int, numZones),
+		ImbalancePerApp:  make([]int, req.NumApps),
+		AppsLostPerZone:  make([]int, numZones),
+	}
+	for id := 0; id < req.NumHosts; id++ {
+		stats.HostsPerZone[zoneOf(id, numZones)]++
+	}
+
+	perZone := make([]int, numZones)
+	for appId := 0; appId < instances.numApps(); appId++ {
+		for _, hostId := range instances.ofApp(appId) {
+			zone := zoneOf(int(hostId), numZones)
+			stats.InstancesPerZone[zone]++
+			perZone[zone]++
+		}
+
+		min, max, zonesUsed, lastZone := perZone[0], perZone[0], 0, 0
+		for zone, count := range perZone {
+			if count < min {
+				min = count
+			}
+			if count > max {
+				max = count
+			}
+			if count > 0 {
+				zonesUsed++
+				lastZone = zone
+			}
+			perZone[zone] = 0
+		}
+		stats.ImbalancePerApp[appId] = max - min
+		if max-min > 1 {
+			stats.UnbalancedApps++
+		}
+		if zonesUsed == 1 {
+			stats.AppsLostPerZone[lastZone]++
+		}
+	}
+
+	stats.Imbalance = summarize(stats.ImbalancePerApp)
+	for _, lost := range stats.AppsLostPerZone {
+		fraction := float64(lost) / float64(req.NumApps)
+		if fraction > stats.MaxFractionOfAppsLost {
+			stats.MaxFractionOfAppsLost = fraction
+		}
+	}
+	resp.Zones = stats
+}
@@ -0,0 +1,148 @@
+package simulate_test
+
+import (
+	"context"
+	"math/rand"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/fakes"
+	"github.com/rosenhouse/cnsim/models"
+	"github.com/rosenhouse/cnsim/simulate"
+)
+
+var _ = Describe("Availability zones", func() {
+	var (
+		appSizeDistribution *fakes.MeanParameterizedDiscreteDistribution
+		sim                 *simulate.SteadyState
+		logger              *lagertest.TestLogger
+		req                 models.SteadyStateRequest
+	)
+
+	BeforeEach(func() {
+		appSizeDistribution = &fakes.MeanParameterizedDiscreteDistribution{}
+		appSizeDistribution.SampleStub = func(_ context.Context, rng *rand.Rand, _ float64) (int, error) {
+			return 2 + rng.Intn(2*req.MeanInstancesPerApp-3), nil
+		}
+		sim = &simulate.SteadyState{
+			AppSizeDistribution: appSizeDistribution,
+		}
+		logger = lagertest.NewTestLogger("test")
+		req = models.SteadyStateRequest{
+			NumHosts:            10,
+			NumApps:             1000,
+			MeanInstancesPerApp: 5,
+			NumZones:            3,
+			PlacementStrategy:   "zone-balanced",
+		}
+	})
+
+	It("is skipped when no zones are requested", func() {
+		req.NumZones = 0
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Zones).To(BeNil())
+		for _, instance := range resp.Instances {
+			Expect(instance.Zone).To(Equal(0))
+		}
+	})
+
+	It("assigns hosts to zones in turn and records the zone of each instance", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Zones.NumZones).To(Equal(3))
+		Expect(resp.Zones.HostsPerZone).To(Equal([]int{4, 3, 3}))
+
+		perZone := make([]int, 3)
+		for _, instance := range resp.Instances {
+			Expect(instance.Zone).To(Equal(instance.HostId % 3))
+			perZone[instance.Zone]++
+		}
+		Expect(resp.Zones.InstancesPerZone).To(Equal(perZone))
+	})
+
+	It("spreads every app evenly across zones when zone-balanced", func() {
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Zones.ImbalancePerApp).To(HaveLen(1000))
+		Expect(resp.Zones.Imbalance.Max).To(BeNumerically("<=", 1))
+		Expect(resp.Zones.UnbalancedApps).To(Equal(0))
+
+		By("never losing an app with more than one instance to a single zone failure")
+		Expect(resp.Zones.AppsLostPerZone).To(Equal([]int{0, 0, 0}))
+		Expect(resp.Zones.MaxFractionOfAppsLost).To(Equal(0.0))
+
+		By("keeping the hosts within each zone evenly loaded")
+		for zone := 0; zone < 3; zone++ {
+			min, max := -1, 0
+			for id := zone; id < 10; id += 3 {
+				count := resp.HostStats.InstancesPerHost[id]
+				if min < 0 || count < min {
+					min = count
+				}
+				if count > max {
+					max = count
+				}
+			}
+			Expect(max - min).To(BeNumerically("<=", 1))
+		}
+	})
+
+	It("measures the imbalance left by other strategies", func() {
+		req.PlacementStrategy = "random"
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Zones.UnbalancedApps).To(BeNumerically(">", 0))
+
+		unbalanced := 0
+		for _, imbalance := range resp.Zones.ImbalancePerApp {
+			if imbalance > 1 {
+				unbalanced++
+			}
+		}
+		Expect(resp.Zones.UnbalancedApps).To(Equal(unbalanced))
+	})
+
+	It("counts the apps that would be lost if each zone failed", func() {
+		appSizeDistribution.SampleReturns(1, nil)
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		lost := resp.Zones.AppsLostPerZone
+		Expect(lost[0] + lost[1] + lost[2]).To(Equal(1000))
+		max := 0
+		for _, n := range lost {
+			if n > max {
+				max = n
+			}
+		}
+		Expect(resp.Zones.MaxFractionOfAppsLost).To(Equal(float64(max) / 1000))
+	})
+
+	It("skips zones that have no room", func() {
+		appSizeDistribution.SampleReturns(8, nil)
+		req.NumApps = 1
+		req.NumHosts = 0
+		req.NumZones = 2
+		req.HostClasses = []models.HostClass{
+			{Count: 1, Slots: 1},
+			{Count: 1, Slots: 10},
+			{Count: 1, Slots: 1},
+			{Count: 1, Slots: 10},
+		}
+
+		resp, err := sim.Execute(context.Background(), logger, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Capacity.UnplacedInstances).To(Equal(0))
+		Expect(resp.Zones.InstancesPerZone).To(Equal([]int{2, 6}))
+	})
+
+	It("requires every zone to have a host", func() {
+		req.NumZones = 10
+		Expect(sim.Validate(req)).To(Succeed())
+
+		req.NumZones = 11
+		Expect(sim.Validate(req)).To(MatchError("NumZones must be 0 - 10"))
+	})
+})
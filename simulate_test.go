@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rosenhouse/cnsim/models"
+)
+
+var _ = Describe("simulateCommand", func() {
+	var (
+		dir            string
+		stdout, stderr *bytes.Buffer
+		args           []string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cnsim-simulate")
+		Expect(err).NotTo(HaveOccurred())
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		args = []string{"-hosts", "10", "-apps", "30", "-mean-instances", "2", "-seed", "42"}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	run := func(extra ...string) int {
+		return simulateCommand(append(args, extra...), stdout, stderr)
+	}
+
+	// entries lists the names in dir, so that specs can check for leftovers.
+	entries := func() []string {
+		infos, err := ioutil.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+
+	It("writes the result as JSON to stdout", func() {
+		Expect(run()).To(Equal(0))
+		Expect(stderr.String()).To(BeEmpty())
+
+		var resp models.SteadyStateResponse
+		Expect(json.Unmarshal(stdout.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Request.NumApps).To(Equal(30))
+		Expect(resp.Seed).To(Equal(int64(42)))
+		Expect(resp.Instances).To(HaveLen(resp.TotalInstances))
+	})
+
+	It("writes the table that a format names", func() {
+		Expect(run("-format", "csv", "-table", "hosts")).To(Equal(0))
+		Expect(stdout.String()).To(ContainSubstring("\nId,Instances,DistinctApps,Rules\n"))
+	})
+
+	It("reads a request that the flags override", func() {
+		requestPath := filepath.Join(dir, "request.json")
+		Expect(ioutil.WriteFile(requestPath, []byte(`{"NumHosts": 10, "NumApps": 30, "MeanInstancesPerApp": 2}`), 0644)).To(Succeed())
+		args = []string{"-request", requestPath, "-apps", "50"}
+
+		Expect(run()).To(Equal(0))
+		var resp models.SteadyStateResponse
+		Expect(json.Unmarshal(stdout.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Request.NumHosts).To(Equal(10))
+		Expect(resp.Request.NumApps).To(Equal(50))
+	})
+
+	It("exits 2 given unexpected arguments", func() {
+		Expect(run("banana")).To(Equal(2))
+		Expect(stderr.String()).To(Equal("unexpected arguments: [banana]\n"))
+	})
+
+	It("exits 2 given an invalid request", func() {
+		args = []string{"-hosts", "0", "-apps", "30", "-mean-instances", "2"}
+		Expect(run()).To(Equal(2))
+		Expect(stderr.String()).To(HavePrefix("validation: "))
+		Expect(stdout.String()).To(BeEmpty())
+	})
+
+	Describe("writing to a file", func() {
+		var outputPath string
+
+		BeforeEach(func() {
+			outputPath = filepath.Join(dir, "result.json")
+		})
+
+		It("writes the result and leaves nothing else behind", func() {
+			Expect(run("-o", outputPath)).To(Equal(0))
+			Expect(stdout.String()).To(BeEmpty())
+
+			contents, err := ioutil.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			var resp models.SteadyStateResponse
+			Expect(json.Unmarshal(contents, &resp)).To(Succeed())
+			Expect(entries()).To(ConsistOf("result.json"))
+
+			info, err := os.Stat(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+		})
+
+		It("replaces a file that is already there", func() {
+			Expect(ioutil.WriteFile(outputPath, []byte("earlier"), 0644)).To(Succeed())
+			Expect(run("-o", outputPath)).To(Equal(0))
+
+			contents, err := ioutil.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(HavePrefix("{"))
+		})
+
+		Context("when the format is invalid", func() {
+			It("exits 2 and leaves a file that is already there alone", func() {
+				Expect(ioutil.WriteFile(outputPath, []byte("earlier"), 0644)).To(Succeed())
+				Expect(run("-format", "xml", "-o", outputPath)).To(Equal(2))
+				Expect(stderr.String()).To(Equal("format: format must be one of: csv, json, ndjson\n"))
+
+				contents, err := ioutil.ReadFile(outputPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("earlier"))
+				Expect(entries()).To(ConsistOf("result.json"))
+			})
+
+			It("creates no file", func() {
+				Expect(run("-format", "csv", "-table", "banana", "-o", outputPath)).To(Equal(2))
+				Expect(stderr.String()).To(HavePrefix("format: "))
+				Expect(entries()).To(BeEmpty())
+			})
+		})
+
+		Context("when the request is invalid", func() {
+			It("creates no file", func() {
+				args = []string{"-hosts", "0"}
+				Expect(run("-o", outputPath)).To(Equal(2))
+				Expect(entries()).To(BeEmpty())
+			})
+		})
+
+		Context("when the directory does not exist", func() {
+			It("exits 2", func() {
+				Expect(run("-o", filepath.Join(dir, "missing", "result.json"))).To(Equal(2))
+				Expect(stderr.String()).To(HavePrefix("output: "))
+			})
+		})
+
+		Context("when the result cannot be moved into place", func() {
+			It("exits 1 and removes what it wrote", func() {
+				Expect(os.Mkdir(outputPath, 0755)).To(Succeed())
+				Expect(run("-o", outputPath)).To(Equal(1))
+				Expect(stderr.String()).To(HavePrefix("output: "))
+				Expect(entries()).To(ConsistOf("result.json"))
+			})
+		})
+	})
+})